@@ -0,0 +1,136 @@
+// Package golden compares frames rendered by the demos against
+// reference PNG images kept in the testdata directory of a package.
+//
+// Run the tests with -update to record new reference images.
+// When a frame does not match, the rendered image and a diff image
+// are written next to the reference as <name>.actual.png and <name>.diff.png.
+package golden
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "record golden images instead of comparing with them")
+
+// Dir is the directory golden images are read from and written to.
+const Dir = "testdata"
+
+// Options control how strict the comparison is.
+type Options struct {
+	// Tolerance is the largest difference allowed in any color channel
+	// of a pixel before the pixel counts as mismatched.
+	Tolerance uint8
+	// MaxMismatched is the number of mismatched pixels allowed,
+	// it absorbs rasterization differences along edges between drivers.
+	MaxMismatched int
+}
+
+// Compare checks img against the golden image called name and fails t
+// when they differ or the golden image is missing. With -update the golden
+// image is rewritten instead.
+func Compare(t testing.TB, name string, img *image.RGBA, opt Options) {
+	t.Helper()
+	path := filepath.Join(Dir, name+".png")
+	if *update {
+		if err := writePNG(path, img); err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("updated %s", path)
+		return
+	}
+	want, err := readPNG(path)
+	if os.IsNotExist(err) {
+		t.Fatalf("no golden image %s, run the test with -update to record it", path)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if want.Bounds().Size() != img.Bounds().Size() {
+		t.Fatalf("%s: rendered %v, golden image is %v", name,
+			img.Bounds().Size(), want.Bounds().Size())
+	}
+	diff, mismatched := Diff(want, img, opt.Tolerance)
+	if mismatched <= opt.MaxMismatched {
+		return
+	}
+	actualPath := filepath.Join(Dir, name+".actual.png")
+	diffPath := filepath.Join(Dir, name+".diff.png")
+	if err := writePNG(actualPath, img); err != nil {
+		t.Error(err)
+	}
+	if err := writePNG(diffPath, diff); err != nil {
+		t.Error(err)
+	}
+	t.Errorf("%s: %d pixels differ by more than %d (%d allowed), see %s and %s",
+		name, mismatched, opt.Tolerance, opt.MaxMismatched, actualPath, diffPath)
+}
+
+// Diff compares two images of the same size pixel by pixel.
+// It returns an image where mismatched pixels are red and matching ones are
+// a faded copy of want, and the number of mismatched pixels.
+func Diff(want image.Image, got *image.RGBA, tolerance uint8) (*image.RGBA, int) {
+	bounds := got.Bounds()
+	offset := want.Bounds().Min.Sub(bounds.Min)
+	diff := image.NewRGBA(bounds)
+	var mismatched int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			w := color.RGBAModel.Convert(want.At(x+offset.X, y+offset.Y)).(color.RGBA)
+			g := got.RGBAAt(x, y)
+			if channelDiff(w.R, g.R) > tolerance || channelDiff(w.G, g.G) > tolerance ||
+				channelDiff(w.B, g.B) > tolerance || channelDiff(w.A, g.A) > tolerance {
+				mismatched++
+				diff.SetRGBA(x, y, color.RGBA{R: 0xff, A: 0xff})
+				continue
+			}
+			diff.SetRGBA(x, y, color.RGBA{
+				R: 0x80 + w.R/2,
+				G: 0x80 + w.G/2,
+				B: 0x80 + w.B/2,
+				A: 0xff,
+			})
+		}
+	}
+	return diff, mismatched
+}
+
+func channelDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func readPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("golden: failed to decode %s: %s", path, err)
+	}
+	return img, nil
+}
+
+func writePNG(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,33 @@
+package golden
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	want := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	got := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range want.Pix {
+		want.Pix[i] = 100
+		got.Pix[i] = 100
+	}
+	got.SetRGBA(1, 1, color.RGBA{R: 104, G: 100, B: 100, A: 100})
+	got.SetRGBA(2, 3, color.RGBA{R: 100, G: 100, B: 120, A: 100})
+
+	diff, mismatched := Diff(want, got, 4)
+	if mismatched != 1 {
+		t.Errorf("got %d mismatched pixels, want 1", mismatched)
+	}
+	if c := diff.RGBAAt(2, 3); c != (color.RGBA{R: 0xff, A: 0xff}) {
+		t.Errorf("mismatched pixel is %v in the diff image, want red", c)
+	}
+	if c := diff.RGBAAt(1, 1); c.G == 0 {
+		t.Errorf("matching pixel is %v in the diff image, want a faded copy", c)
+	}
+
+	if _, mismatched = Diff(want, got, 3); mismatched != 2 {
+		t.Errorf("got %d mismatched pixels with tolerance 3, want 2", mismatched)
+	}
+}
@@ -7,8 +7,8 @@ LOCAL_SRC_FILES := lib/libvulkancube.so
 
 include $(PREBUILT_SHARED_LIBRARY)
 
-# Enable Vulkan validation layers, you can obtain them at
-# 	https://github.com/LunarG/VulkanTools
-# 	mirror: https://github.com/vulkan-go/VulkanTools
+# Enable the Vulkan validation layer, put libVkLayer_khronos_validation.so
+# for each ABI into lib, you can obtain it at
+# 	https://github.com/KhronosGroup/Vulkan-ValidationLayers/releases
 
 # include $(LOCAL_PATH)/ValidationLayers.mk
@@ -4,9 +4,85 @@ import (
 	"log"
 	"unsafe"
 
+	"github.com/vulkan-go/demos/vulkanutil"
 	vk "github.com/vulkan-go/vulkan"
 )
 
+// validation enables the validation layer and the debug messenger or report
+// callback, as far as they are available. It is set by vulkanutil.ValidationEnv
+// or the -validate flag.
+var validation = vulkanutil.ValidationRequested()
+
+// debugMessages selects the messages logged with VK_EXT_debug_utils,
+// the VK_EXT_debug_report callback logs the warnings and errors.
+var debugMessages = vulkanutil.DefaultDebugMessageFilter
+
+// debugLayers returns the validation layer and the extension that reports
+// its messages to enable on the instance, nothing if validation is off.
+// The layer is also passed to vk.CreateDevice for older loaders.
+func debugLayers(existingExtensions []string) (layers, extensions []string) {
+	if !validation {
+		return nil, nil
+	}
+	existingLayers := getInstanceLayers()
+	log.Println("[INFO] Instance layers:", existingLayers)
+	layers = vulkanutil.SelectValidationLayers(existingLayers)
+
+	// the debug extensions may come from the layer instead, as on Android.
+	available := append([]string(nil), existingExtensions...)
+	for _, layer := range layers {
+		available = append(available, getLayerExtensions(layer)...)
+	}
+	// Nvidia Shield K1 fw 1.3.0 lacks VK_EXT_debug_report,
+	// on fw 1.2.0 it works fine.
+	if ext := vulkanutil.SelectDebugExtension(available); ext != "" {
+		extensions = []string{ext + "\x00"}
+	}
+	return layers, extensions
+}
+
+// chainDebugMessenger logs the messages of vk.CreateInstance and
+// vk.DestroyInstance with VK_EXT_debug_utils, call free once the instance
+// is created. debugExtensions are the ones returned by debugLayers.
+func chainDebugMessenger(info *vk.InstanceCreateInfo, debugExtensions []string) (free func()) {
+	if len(debugExtensions) == 0 || debugExtensions[0] != "VK_EXT_debug_utils\x00" {
+		return func() {}
+	}
+	return vulkanutil.ChainDebugMessenger(info, debugMessages)
+}
+
+// prepareDebugCallback reports validation messages to the log, call it
+// right after vk.CreateInstance. debugExtensions are the ones returned by
+// debugLayers.
+func (d *Demo) prepareDebugCallback(debugExtensions []string) {
+	if len(debugExtensions) == 0 {
+		return
+	}
+	if debugExtensions[0] == "VK_EXT_debug_utils\x00" {
+		var err error
+		d.dbgMessenger, err = vulkanutil.CreateDebugMessenger(d.instance, debugMessages)
+		if err != nil {
+			log.Println("[WARN]", err)
+		}
+		return
+	}
+	dbgCreateInfo := vk.DebugReportCallbackCreateInfo{
+		SType:       vk.StructureTypeDebugReportCallbackCreateInfo,
+		Flags:       vk.DebugReportFlags(vk.DebugReportErrorBit | vk.DebugReportWarningBit),
+		PfnCallback: dbgCallbackFunc,
+	}
+	err := vk.CreateDebugReportCallback(d.instance, &dbgCreateInfo, nil, &d.dbgCallback)
+	check(err, "vk.CreateDebugReportCallback")
+}
+
+// enableDebugUtils names and labels the objects of the device when the
+// debug messenger exists, call it once the tracker is created.
+func (d *Demo) enableDebugUtils() {
+	if d.dbgMessenger != vk.NullDebugUtilsMessenger {
+		d.tracker.EnableDebugUtils()
+	}
+}
+
 // dbgCallbackFunc is a Go alternative to the vk.DebugReportCallbackAndroid helper.
 func dbgCallbackFunc(flags vk.DebugReportFlags, objectType vk.DebugReportObjectType,
 	object uint64, location uint, messageCode int32, pLayerPrefix string,
@@ -18,7 +94,7 @@ func dbgCallbackFunc(flags vk.DebugReportFlags, objectType vk.DebugReportObjectT
 	case flags&vk.DebugReportFlags(vk.DebugReportWarningBit) != 0:
 		log.Printf("[Layer %s][WARN %d] %s", pLayerPrefix, messageCode, pMessage)
 	default:
-		log.Printf("[Layer %s][WARN] unknown debug message %d", pLayerPrefix, messageCode)
+		log.Printf("[Layer %s][INFO %d] %s", pLayerPrefix, messageCode, pMessage)
 	}
 	// Returning false tells the layer not to stop when the event occurs, so
 	// they see the same behavior with and without validation layers enabled.
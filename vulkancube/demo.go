@@ -2,35 +2,35 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	"image"
 	"image/draw"
 	"log"
-	"unsafe"
 
 	"github.com/lmittmann/ppm"
+	"github.com/vulkan-go/demos/vulkanutil"
 	vk "github.com/vulkan-go/vulkan"
-	"github.com/xlab/android-go/android"
 	"github.com/xlab/linmath"
 )
 
-// enableDebug is disabled by default since VK_EXT_debug_report
-// is not guaranteed to be present on a device.
-//
-// Nvidia Shield K1 fw 1.3.0 lacks this extension,
-// on fw 1.2.0 it works fine.
-const enableDebug = true
-
 const demoTextureCount = 1
 
+var appInfo = vk.ApplicationInfo{
+	SType:              vk.StructureTypeApplicationInfo,
+	ApiVersion:         vk.MakeVersion(1, 0, 0),
+	ApplicationVersion: vk.MakeVersion(1, 0, 0),
+	PApplicationName:   "VulkanCube\x00",
+	PEngineName:        "golang\x00",
+}
+
 // TextureObject tracks all objects related to a texture.
 type TextureObject struct {
 	sampler     vk.Sampler
 	image       vk.Image
 	imageLayout vk.ImageLayout
 
-	memAlloc vk.MemoryAllocateInfo
-	mem      vk.DeviceMemory
-	view     vk.ImageView
+	mem  vulkanutil.Allocation
+	view vk.ImageView
 
 	width  int
 	height int
@@ -55,17 +55,23 @@ type SwapchainBuffersInfo struct {
 type DepthInfo struct {
 	format vk.Format
 
-	image    vk.Image
-	memAlloc vk.MemoryAllocateInfo
-	mem      vk.DeviceMemory
-	view     vk.ImageView
+	image vk.Image
+	mem   vulkanutil.Allocation
+	view  vk.ImageView
+}
+
+// MSAAInfo is the multisampled color image the cube is drawn into,
+// it is resolved into the swapchain image at the end of the render pass.
+type MSAAInfo struct {
+	image vk.Image
+	mem   vulkanutil.Allocation
+	view  vk.ImageView
 }
 
 type UniformInfo struct {
-	buf      vk.Buffer
-	memAlloc vk.MemoryAllocateInfo
-	mem      vk.DeviceMemory
-	bufInfo  vk.DescriptorBufferInfo
+	buf     vk.Buffer
+	mem     vulkanutil.Allocation
+	bufInfo vk.DescriptorBufferInfo
 }
 
 type Demo struct {
@@ -73,11 +79,21 @@ type Demo struct {
 	prepared         bool
 	useStagingBuffer bool
 
+	// headless demos render into an image instead of a swapchain,
+	// see NewDemoHeadless.
+	headless bool
+	readback ReadbackInfo
+
 	instance vk.Instance
 	gpu      vk.PhysicalDevice
 	device   vk.Device
 	queue    vk.Queue
 
+	// allocator sub-allocates the memory of all buffers and images.
+	allocator *vulkanutil.Allocator
+	// tracker reports the objects left in Cleanup.
+	tracker *vulkanutil.Tracker
+
 	gpuProps   vk.PhysicalDeviceProperties
 	queueProps []vk.QueueFamilyProperties
 	memProps   vk.PhysicalDeviceMemoryProperties
@@ -96,6 +112,13 @@ type Demo struct {
 	swapchain              vk.Swapchain
 	graphicsQueueNodeIndex uint32
 	buffers                []SwapchainBuffersInfo
+	// presentComplete is signaled when the acquired image can be rendered to,
+	// it lives as long as the swapchain.
+	presentComplete vk.Semaphore
+
+	// samples per pixel of the depth and color attachments, see SetSamples.
+	samples vk.SampleCountFlagBits
+	msaa    MSAAInfo
 
 	cmdPool  vk.CommandPool
 	depth    DepthInfo
@@ -128,6 +151,8 @@ type Demo struct {
 	quit         bool
 
 	dbgCallback vk.DebugReportCallback
+	// dbgMessenger is used instead of dbgCallback with VK_EXT_debug_utils.
+	dbgMessenger vk.DebugUtilsMessenger
 
 	currentBuffer uint32
 	queueCount    int
@@ -203,6 +228,7 @@ func (d *Demo) beginCmdBuffer() {
 	err := vk.AllocateCommandBuffers(d.device, &allocateInfo, commandBuffers)
 	orPanic(err)
 	d.cmd = commandBuffers[0]
+	vulkanutil.SetObjectName(d.device, d.cmd, "setup command buffer")
 
 	beginInfo := vk.CommandBufferBeginInfo{
 		SType: vk.StructureTypeCommandBufferBeginInfo,
@@ -221,11 +247,15 @@ func (d *Demo) drawBuildCmd(cmdBuf vk.CommandBuffer) {
 			SType: vk.StructureTypeCommandBufferInheritanceInfo,
 		}},
 	}
-	clearValues := make([]vk.ClearValue, 2)
+	clearValues := make([]vk.ClearValue, 2, 3)
 	clearValues[1].SetDepthStencil(1, 0)
 	clearValues[0].SetColor([]float32{
 		0.2, 0.2, 0.2, 0.2,
 	})
+	if d.samples != vk.SampleCount1Bit {
+		// the multisampled color attachment comes last.
+		clearValues = append(clearValues, clearValues[0])
+	}
 	renderPassBeginInfo := vk.RenderPassBeginInfo{
 		SType:       vk.StructureTypeRenderPassBeginInfo,
 		RenderPass:  d.renderPass,
@@ -239,12 +269,13 @@ func (d *Demo) drawBuildCmd(cmdBuf vk.CommandBuffer) {
 				Height: d.height,
 			},
 		},
-		ClearValueCount: 2,
+		ClearValueCount: uint32(len(clearValues)),
 		PClearValues:    clearValues,
 	}
 	err := vk.BeginCommandBuffer(cmdBuf, &cmdBufferBeginInfo)
 	orPanic(err)
 
+	vulkanutil.BeginLabel(d.device, cmdBuf, "draw cube")
 	vk.CmdBeginRenderPass(cmdBuf, &renderPassBeginInfo, vk.SubpassContentsInline)
 	vk.CmdBindPipeline(cmdBuf, vk.PipelineBindPointGraphics, d.pipeline)
 
@@ -277,6 +308,14 @@ func (d *Demo) drawBuildCmd(cmdBuf vk.CommandBuffer) {
 
 	vk.CmdDraw(cmdBuf, 12*3, 1, 0, 0)
 	vk.CmdEndRenderPass(cmdBuf)
+	vulkanutil.EndLabel(d.device, cmdBuf)
+
+	if d.headless {
+		d.readbackBuildCmd(cmdBuf)
+		err = vk.EndCommandBuffer(cmdBuf)
+		orPanic(err)
+		return
+	}
 
 	prePresentBarrier := vk.ImageMemoryBarrier{
 		SType:               vk.StructureTypeImageMemoryBarrier,
@@ -315,29 +354,19 @@ func (d *Demo) updateDataBuffer() {
 	d.modelMat.Rotate(Model, 0, 1, 0, angle)
 	MVP.Mult(VP, d.modelMat)
 
-	var data unsafe.Pointer
-	err := vk.MapMemory(d.device, d.uniform.mem, 0, d.uniform.memAlloc.AllocationSize, 0, &data)
-	orPanic(err)
+	data := d.mapMemory(d.uniform.mem)
 
 	vertexData := MVP.Slice()
 	n := vk.MemCopyFloat32(data, vertexData)
 	if n != len(vertexData) {
 		log.Println("[WARN] failed to copy vertex data")
 	}
-	vk.UnmapMemory(d.device, d.uniform.mem)
+	d.allocator.Unmap(d.uniform.mem)
 }
 
 func (d *Demo) draw() {
-	var presentCompleteSemaphore vk.Semaphore
-	semaphoreCreateInfo := vk.SemaphoreCreateInfo{
-		SType: vk.StructureTypeSemaphoreCreateInfo,
-	}
-	err := vk.CreateSemaphore(d.device, &semaphoreCreateInfo, nil, &presentCompleteSemaphore)
-	orPanic(err)
-	defer vk.DestroySemaphore(d.device, presentCompleteSemaphore, nil)
-
-	err = vk.AcquireNextImage(d.device, d.swapchain, vk.MaxUint64,
-		presentCompleteSemaphore, vk.NullHandle, &d.currentBuffer)
+	err := vk.AcquireNextImage(d.device, d.swapchain, vk.MaxUint64,
+		d.presentComplete, vk.NullHandle, &d.currentBuffer)
 	switch err {
 	case vk.ErrorOutOfDate:
 		// d.swapchain is out of date (e.g. the window was resized) and
@@ -368,7 +397,7 @@ func (d *Demo) draw() {
 		SType:              vk.StructureTypeSubmitInfo,
 		WaitSemaphoreCount: 1,
 		PWaitSemaphores: []vk.Semaphore{
-			presentCompleteSemaphore,
+			d.presentComplete,
 		},
 		PWaitDstStageMask: []vk.PipelineStageFlags{
 			vk.PipelineStageFlags(vk.PipelineStageBottomOfPipeBit),
@@ -549,13 +578,14 @@ func (d *Demo) prepareSwapchain() {
 	}
 	err = vk.CreateSwapchain(d.device, &swapchainCreateInfo, nil, &d.swapchain)
 	orPanic(err)
+	vulkanutil.Track(d.device, d.swapchain)
 
 	// If we just re-created an existing swapchain, we should destroy the old
 	// swapchain at this point.
 	// Note: destroying the swapchain also cleans up all its associated
 	// presentable images once the platform is done with them.
 	if oldSwapchain != vk.NullHandle {
-		vk.DestroySwapchain(d.device, oldSwapchain, nil)
+		vulkanutil.Destroy(d.device, oldSwapchain)
 	}
 
 	var imgCount uint32
@@ -585,6 +615,7 @@ func (d *Demo) prepareSwapchain() {
 			},
 		}
 		d.buffers[i].image = swapchainImages[i]
+		vulkanutil.SetObjectName(d.device, d.buffers[i].image, fmt.Sprintf("swapchain image %d", i))
 		// Render loop will expect image to have been used before and in
 		// vk.ImageLayoutPresentSrc
 		// layout and will change to ColorAttachmentOptimal, so init the image
@@ -595,7 +626,17 @@ func (d *Demo) prepareSwapchain() {
 		viewCreateInfo.Image = d.buffers[i].image
 		err = vk.CreateImageView(d.device, &viewCreateInfo, nil, &d.buffers[i].view)
 		orPanic(err)
+		vulkanutil.Track(d.device, d.buffers[i].view)
 	}
+
+	// draw waits for the queue to go idle, so one semaphore is enough for
+	// all the frames rendered with this swapchain.
+	semaphoreCreateInfo := vk.SemaphoreCreateInfo{
+		SType: vk.StructureTypeSemaphoreCreateInfo,
+	}
+	err = vk.CreateSemaphore(d.device, &semaphoreCreateInfo, nil, &d.presentComplete)
+	orPanic(err)
+	vulkanutil.Track(d.device, d.presentComplete)
 }
 
 func (d *Demo) prepareDepth() {
@@ -613,30 +654,17 @@ func (d *Demo) prepareDepth() {
 		},
 		MipLevels:   1,
 		ArrayLayers: 1,
-		Samples:     vk.SampleCount1Bit,
+		Samples:     d.samples,
 		Tiling:      vk.ImageTilingOptimal,
 		Usage:       vk.ImageUsageFlags(vk.ImageUsageDepthStencilAttachmentBit),
 	}
 	err := vk.CreateImage(d.device, &imageInfo, nil, &d.depth.image)
 	orPanic(err)
+	vulkanutil.Track(d.device, d.depth.image)
+	vulkanutil.SetObjectName(d.device, d.depth.image, "depth image")
 
-	var memReqs vk.MemoryRequirements
-	vk.GetImageMemoryRequirements(d.device, d.depth.image, &memReqs)
-	memReqs.Deref()
-	d.depth.memAlloc = vk.MemoryAllocateInfo{
-		SType:           vk.StructureTypeMemoryAllocateInfo,
-		AllocationSize:  memReqs.Size,
-		MemoryTypeIndex: 0, // see below
-	}
-	// FindMemoryTypeIndex with no memory requirements
-	memTypeIdx, ok := vk.FindMemoryTypeIndex(d.gpu, memReqs.MemoryTypeBits, 0)
-	orPanicWith(ok, "FindMemoryTypeIndex failed")
-	d.depth.memAlloc.MemoryTypeIndex = memTypeIdx
-
-	err = vk.AllocateMemory(d.device, &d.depth.memAlloc, nil, &d.depth.mem)
-	orPanic(err)
-	err = vk.BindImageMemory(d.device, d.depth.image, d.depth.mem, 0)
-	orPanic(err)
+	// no memory requirements
+	d.depth.mem = d.allocImage(d.depth.image, vk.ImageTilingOptimal, 0)
 
 	d.setImageLayout(d.depth.image, vk.ImageAspectFlags(vk.ImageAspectDepthBit),
 		vk.ImageLayoutUndefined, vk.ImageLayoutDepthStencilAttachmentOptimal, 0)
@@ -654,6 +682,71 @@ func (d *Demo) prepareDepth() {
 	viewInfo.Image = d.depth.image
 	err = vk.CreateImageView(d.device, &viewInfo, nil, &d.depth.view)
 	orPanic(err)
+	vulkanutil.Track(d.device, d.depth.view)
+}
+
+// SetSamples sets the number of samples per pixel, call it before Prepare.
+// It is clamped to the sample counts the device supports for color and depth
+// framebuffer attachments.
+func (d *Demo) SetSamples(samples vk.SampleCountFlagBits) {
+	d.samples = vulkanutil.ClampSampleCount(d.gpu, samples, true)
+	if d.samples != samples {
+		log.Printf("[INFO] %d samples per pixel requested, using %d", samples, d.samples)
+	}
+}
+
+// prepareMSAA creates the multisampled color image when
+// more than one sample per pixel is used.
+func (d *Demo) prepareMSAA() {
+	if d.samples == vk.SampleCount1Bit {
+		return
+	}
+	imageInfo := vk.ImageCreateInfo{
+		SType:     vk.StructureTypeImageCreateInfo,
+		ImageType: vk.ImageType2d,
+		Format:    d.format,
+		Extent: vk.Extent3D{
+			Width:  d.width,
+			Height: d.height,
+			Depth:  1,
+		},
+		MipLevels:   1,
+		ArrayLayers: 1,
+		Samples:     d.samples,
+		Tiling:      vk.ImageTilingOptimal,
+		// only resolved, never stored, so the image can stay in tile memory.
+		Usage: vk.ImageUsageFlags(vk.ImageUsageColorAttachmentBit |
+			vk.ImageUsageTransientAttachmentBit),
+	}
+	err := vk.CreateImage(d.device, &imageInfo, nil, &d.msaa.image)
+	orPanic(err)
+	vulkanutil.Track(d.device, d.msaa.image)
+	vulkanutil.SetObjectName(d.device, d.msaa.image, "multisampled color image")
+
+	d.msaa.mem = d.allocImage(d.msaa.image, vk.ImageTilingOptimal, vk.MemoryPropertyDeviceLocalBit)
+
+	// the render pass moves it out of the undefined layout.
+	viewInfo := vk.ImageViewCreateInfo{
+		SType:    vk.StructureTypeImageViewCreateInfo,
+		Image:    d.msaa.image,
+		ViewType: vk.ImageViewType2d,
+		Format:   d.format,
+		SubresourceRange: vk.ImageSubresourceRange{
+			AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
+			LevelCount: 1,
+			LayerCount: 1,
+		},
+	}
+	err = vk.CreateImageView(d.device, &viewInfo, nil, &d.msaa.view)
+	orPanic(err)
+	vulkanutil.Track(d.device, d.msaa.view)
+}
+
+func (d *Demo) destroyMSAA() {
+	vulkanutil.Destroy(d.device, d.msaa.view)
+	vulkanutil.Destroy(d.device, d.msaa.image)
+	d.allocator.Free(d.msaa.mem)
+	d.msaa = MSAAInfo{}
 }
 
 func loadTextureSize(name string) (w int, h int, err error) {
@@ -710,22 +803,9 @@ func (d *Demo) prepareTextureImage(name string, tiling vk.ImageTiling,
 
 	err := vk.CreateImage(d.device, &imgCreateInfo, nil, &texObj.image)
 	orPanic(err)
-	var memReqs vk.MemoryRequirements
-	vk.GetImageMemoryRequirements(d.device, texObj.image, &memReqs)
-	memReqs.Deref()
-	texObj.memAlloc = vk.MemoryAllocateInfo{
-		SType:           vk.StructureTypeMemoryAllocateInfo,
-		AllocationSize:  memReqs.Size,
-		MemoryTypeIndex: 0, // see below
-	}
-	memTypeIdx, ok := vk.FindMemoryTypeIndex(d.gpu, memReqs.MemoryTypeBits, memProps)
-	orPanicWith(ok, "FindMemoryTypeIndex failed")
-	texObj.memAlloc.MemoryTypeIndex = memTypeIdx
-
-	err = vk.AllocateMemory(d.device, &texObj.memAlloc, nil, &texObj.mem)
-	orPanic(err)
-	err = vk.BindImageMemory(d.device, texObj.image, texObj.mem, 0)
-	orPanic(err)
+	vulkanutil.Track(d.device, texObj.image)
+	vulkanutil.SetObjectName(d.device, texObj.image, "texture "+name)
+	texObj.mem = d.allocImage(texObj.image, tiling, memProps)
 
 	memHostVisible := memProps&vk.MemoryPropertyHostVisibleBit != 0
 	if memHostVisible {
@@ -739,9 +819,7 @@ func (d *Demo) prepareTextureImage(name string, tiling vk.ImageTiling,
 		rgbaData, texErr := loadTextureData(name, layout)
 		orPanic(texErr)
 
-		var data unsafe.Pointer
-		err := vk.MapMemory(d.device, texObj.mem, 0, texObj.memAlloc.AllocationSize, 0, &data)
-		orPanic(err)
+		data := d.mapMemory(texObj.mem)
 
 		// TODO(xlab): this data could be read directly
 		n := vk.MemCopyByte(data, rgbaData)
@@ -750,7 +828,7 @@ func (d *Demo) prepareTextureImage(name string, tiling vk.ImageTiling,
 				texObj.width, texObj.height, name)
 		}
 
-		vk.UnmapMemory(d.device, texObj.mem)
+		d.allocator.Unmap(texObj.mem)
 	}
 
 	texObj.imageLayout = vk.ImageLayoutShaderReadOnlyOptimal
@@ -763,8 +841,8 @@ func (d *Demo) prepareTextureImage(name string, tiling vk.ImageTiling,
 }
 
 func (d *Demo) destroyTextureImage(obj TextureObject) {
-	vk.FreeMemory(d.device, obj.mem, nil)
-	vk.DestroyImage(d.device, obj.image, nil)
+	vulkanutil.Destroy(d.device, obj.image)
+	d.allocator.Free(obj.mem)
 }
 
 func (d *Demo) prepareTextures(names ...string) {
@@ -858,10 +936,12 @@ func (d *Demo) prepareTextures(names ...string) {
 		}
 		err := vk.CreateSampler(d.device, &samplerInfo, nil, &d.textures[i].sampler)
 		orPanic(err)
+		vulkanutil.Track(d.device, d.textures[i].sampler)
 
 		imageViewInfo.Image = d.textures[i].image
 		err = vk.CreateImageView(d.device, &imageViewInfo, nil, &d.textures[i].view)
 		orPanic(err)
+		vulkanutil.Track(d.device, d.textures[i].view)
 	}
 
 	// execute on all submitted texture names
@@ -899,36 +979,18 @@ func (d *Demo) prepareCubeDataBuffer() {
 	}
 	err := vk.CreateBuffer(d.device, &bufInfo, nil, &d.uniform.buf)
 	orPanic(err)
+	vulkanutil.Track(d.device, d.uniform.buf)
+	vulkanutil.SetObjectName(d.device, d.uniform.buf, "uniform buffer")
 
-	var memReqs vk.MemoryRequirements
-	vk.GetBufferMemoryRequirements(d.device, d.uniform.buf, &memReqs)
-	memReqs.Deref()
-
-	d.uniform.memAlloc = vk.MemoryAllocateInfo{
-		SType:           vk.StructureTypeMemoryAllocateInfo,
-		AllocationSize:  memReqs.Size,
-		MemoryTypeIndex: 0, // see below
-	}
-	memTypeIdx, ok := vk.FindMemoryTypeIndex(d.gpu, memReqs.MemoryTypeBits,
-		vk.MemoryPropertyHostVisibleBit)
-	orPanicWith(ok, "FindMemoryTypeIndex failed")
-	d.uniform.memAlloc.MemoryTypeIndex = memTypeIdx
-
-	err = vk.AllocateMemory(d.device, &d.uniform.memAlloc, nil, &d.uniform.mem)
-	orPanic(err)
-	var data unsafe.Pointer
-	err = vk.MapMemory(d.device, d.uniform.mem, 0, d.uniform.memAlloc.AllocationSize, 0, &data)
-	orPanic(err)
+	d.uniform.mem = d.allocBuffer(d.uniform.buf, vk.MemoryPropertyHostVisibleBit)
+	data := d.mapMemory(d.uniform.mem)
 
 	toCopy := bufData.Slice()
 	n := vk.MemCopyFloat32(data, toCopy)
 	if n != len(toCopy) {
 		log.Println("[WARN] failed to copy uniform data")
 	}
-	vk.UnmapMemory(d.device, d.uniform.mem)
-
-	err = vk.BindBufferMemory(d.device, d.uniform.buf, d.uniform.mem, 0)
-	orPanic(err)
+	d.allocator.Unmap(d.uniform.mem)
 
 	d.uniform.bufInfo.Free()
 	d.uniform.bufInfo = vk.DescriptorBufferInfo{
@@ -956,6 +1018,7 @@ func (d *Demo) prepareDescriptorLayout() {
 	}
 	err := vk.CreateDescriptorSetLayout(d.device, &descLayoutInfo, nil, &d.descLayout)
 	orPanic(err)
+	vulkanutil.Track(d.device, d.descLayout)
 
 	layouts := []vk.DescriptorSetLayout{
 		d.descLayout,
@@ -967,13 +1030,19 @@ func (d *Demo) prepareDescriptorLayout() {
 	}
 	err = vk.CreatePipelineLayout(d.device, &pipelineLayoutCreateInfo, nil, &d.pipelineLayout)
 	orPanic(err)
+	vulkanutil.Track(d.device, d.pipelineLayout)
 }
 
 func (d *Demo) prepareRenderPass() {
+	colorLoadOp := vk.AttachmentLoadOpClear
+	if d.samples != vk.SampleCount1Bit {
+		// fully overwritten by the resolve.
+		colorLoadOp = vk.AttachmentLoadOpDontCare
+	}
 	attachments := []vk.AttachmentDescription{{
 		Format:         d.format,
 		Samples:        vk.SampleCount1Bit,
-		LoadOp:         vk.AttachmentLoadOpClear,
+		LoadOp:         colorLoadOp,
 		StoreOp:        vk.AttachmentStoreOpStore,
 		StencilLoadOp:  vk.AttachmentLoadOpDontCare,
 		StencilStoreOp: vk.AttachmentStoreOpDontCare,
@@ -981,7 +1050,7 @@ func (d *Demo) prepareRenderPass() {
 		FinalLayout:    vk.ImageLayoutColorAttachmentOptimal,
 	}, {
 		Format:         d.depth.format,
-		Samples:        vk.SampleCount1Bit,
+		Samples:        d.samples,
 		LoadOp:         vk.AttachmentLoadOpClear,
 		StoreOp:        vk.AttachmentStoreOpDontCare,
 		StencilLoadOp:  vk.AttachmentLoadOpDontCare,
@@ -1001,15 +1070,33 @@ func (d *Demo) prepareRenderPass() {
 		PColorAttachments:       colorReferences,
 		PDepthStencilAttachment: depthReferences,
 	}}
+	if d.samples != vk.SampleCount1Bit {
+		// draw into the multisampled image, resolve into the swapchain image.
+		attachments = append(attachments, vk.AttachmentDescription{
+			Format:         d.format,
+			Samples:        d.samples,
+			LoadOp:         vk.AttachmentLoadOpClear,
+			StoreOp:        vk.AttachmentStoreOpDontCare,
+			StencilLoadOp:  vk.AttachmentLoadOpDontCare,
+			StencilStoreOp: vk.AttachmentStoreOpDontCare,
+			InitialLayout:  vk.ImageLayoutUndefined,
+			FinalLayout:    vk.ImageLayoutColorAttachmentOptimal,
+		})
+		subpasses[0].PColorAttachments = []vk.AttachmentReference{{
+			Attachment: 2, Layout: vk.ImageLayoutColorAttachmentOptimal,
+		}}
+		subpasses[0].PResolveAttachments = colorReferences
+	}
 	renderPassInfo := vk.RenderPassCreateInfo{
 		SType:           vk.StructureTypeRenderPassCreateInfo,
-		AttachmentCount: 2,
+		AttachmentCount: uint32(len(attachments)),
 		PAttachments:    attachments,
 		SubpassCount:    1,
 		PSubpasses:      subpasses,
 	}
 	err := vk.CreateRenderPass(d.device, &renderPassInfo, nil, &d.renderPass)
 	orPanic(err)
+	vulkanutil.Track(d.device, d.renderPass)
 }
 
 func loadShader(device vk.Device, name string) vk.ShaderModule {
@@ -1022,6 +1109,7 @@ func loadShader(device vk.Device, name string) vk.ShaderModule {
 	var module vk.ShaderModule
 	err := vk.CreateShaderModule(device, &shaderModuleInfo, nil, &module)
 	orPanic(err)
+	vulkanutil.Track(device, module)
 	return module
 }
 
@@ -1084,13 +1172,13 @@ func (d *Demo) preparePipeline(vsName, fsName string) {
 	}
 	pipelineMultisampleStateInfo := vk.PipelineMultisampleStateCreateInfo{
 		SType:                vk.StructureTypePipelineMultisampleStateCreateInfo,
-		RasterizationSamples: vk.SampleCount1Bit,
+		RasterizationSamples: d.samples,
 	}
 
 	vertexShader := loadShader(d.device, vsName)
-	defer vk.DestroyShaderModule(d.device, vertexShader, nil)
+	defer vulkanutil.Destroy(d.device, vertexShader)
 	fragmentShader := loadShader(d.device, fsName)
-	defer vk.DestroyShaderModule(d.device, fragmentShader, nil)
+	defer vulkanutil.Destroy(d.device, fragmentShader)
 
 	shaderStages := []vk.PipelineShaderStageCreateInfo{
 		{
@@ -1127,10 +1215,13 @@ func (d *Demo) preparePipeline(vsName, fsName string) {
 	}
 	err := vk.CreatePipelineCache(d.device, &pipelineCacheInfo, nil, &d.pipelineCache)
 	orPanic(err)
+	vulkanutil.Track(d.device, d.pipelineCache)
 
 	pipelines := make([]vk.Pipeline, 1)
 	err = vk.CreateGraphicsPipelines(d.device, d.pipelineCache, 1, pipelineInfos, nil, pipelines)
 	orPanic(err)
+	vulkanutil.Track(d.device, pipelines[0])
+	vulkanutil.SetObjectName(d.device, pipelines[0], "cube pipeline")
 	d.pipeline = pipelines[0]
 }
 
@@ -1149,6 +1240,7 @@ func (d *Demo) prepareDescriptorPool() {
 	}
 	err := vk.CreateDescriptorPool(d.device, &descriptorPoolInfo, nil, &d.descPool)
 	orPanic(err)
+	vulkanutil.Track(d.device, d.descPool)
 }
 
 func (d *Demo) prepareDescriptorSet() {
@@ -1190,26 +1282,33 @@ func (d *Demo) prepareDescriptorSet() {
 }
 
 func (d *Demo) prepareFramebuffers() {
+	attachments := []vk.ImageView{
+		vk.NullHandle, d.depth.view,
+	}
+	if d.samples != vk.SampleCount1Bit {
+		attachments = append(attachments, d.msaa.view)
+	}
 	framebufferCreateInfo := vk.FramebufferCreateInfo{
 		SType:           vk.StructureTypeFramebufferCreateInfo,
 		RenderPass:      d.renderPass,
-		AttachmentCount: 2,
-		PAttachments: []vk.ImageView{
-			vk.NullHandle, d.depth.view,
-		},
-		Width:  d.width,
-		Height: d.height,
+		AttachmentCount: uint32(len(attachments)),
+		PAttachments:    attachments,
+		Width:           d.width,
+		Height:          d.height,
 	}
 	d.framebuffers = make([]vk.Framebuffer, d.swapchainImageCount)
 	for i := range d.framebuffers {
 		framebufferCreateInfo.PAttachments[0] = d.buffers[i].view
 		err := vk.CreateFramebuffer(d.device, &framebufferCreateInfo, nil, &d.framebuffers[i])
 		orPanic(err)
+		vulkanutil.Track(d.device, d.framebuffers[i])
 	}
 }
 
 func (d *Demo) Prepare(vsName, fsName, texName string) {
-	d.prepareSurfaceCapabilities()
+	if !d.headless {
+		d.prepareSurfaceCapabilities()
+	}
 	vk.GetPhysicalDeviceMemoryProperties(d.gpu, &d.memProps)
 
 	cmdPoolInfo := vk.CommandPoolCreateInfo{
@@ -1218,14 +1317,23 @@ func (d *Demo) Prepare(vsName, fsName, texName string) {
 	}
 	err := vk.CreateCommandPool(d.device, &cmdPoolInfo, nil, &d.cmdPool)
 	orPanic(err)
+	vulkanutil.Track(d.device, d.cmdPool)
 
 	d.vsName = vsName
 	d.fsName = fsName
 	d.texName = texName
 	d.textures = make([]TextureObject, 1)
 
-	d.prepareSwapchain()
+	if d.headless {
+		d.prepareReadback()
+	} else {
+		d.prepareSwapchain()
+	}
+	if d.samples == 0 {
+		d.samples = vk.SampleCount1Bit
+	}
 	d.prepareDepth()
+	d.prepareMSAA()
 	d.prepareTextures(texName)
 	d.prepareCubeDataBuffer()
 
@@ -1244,6 +1352,7 @@ func (d *Demo) Prepare(vsName, fsName, texName string) {
 		err := vk.AllocateCommandBuffers(d.device, &cmdBufferAllocateInfo, buffers)
 		orPanic(err)
 		d.buffers[i].cmd = buffers[0]
+		vulkanutil.SetObjectName(d.device, buffers[0], fmt.Sprintf("draw command buffer %d", i))
 	}
 
 	d.prepareDescriptorPool()
@@ -1262,51 +1371,75 @@ func (d *Demo) Prepare(vsName, fsName, texName string) {
 	d.prepared = true
 }
 
-func (d *Demo) Cleanup() {
+// Cleanup destroys the demo. Objects still alive when the device is about
+// to be destroyed have leaked, they are destroyed too and reported as an error.
+func (d *Demo) Cleanup() error {
 	d.prepared = false
 	for i := 0; i < d.swapchainImageCount; i++ {
-		vk.DestroyFramebuffer(d.device, d.framebuffers[i], nil)
+		vulkanutil.Destroy(d.device, d.framebuffers[i])
 	}
 	d.framebuffers = nil
 
-	vk.DestroyDescriptorPool(d.device, d.descPool, nil)
-	vk.DestroyPipeline(d.device, d.pipeline, nil)
-	vk.DestroyPipelineCache(d.device, d.pipelineCache, nil)
-	vk.DestroyRenderPass(d.device, d.renderPass, nil)
-	vk.DestroyPipelineLayout(d.device, d.pipelineLayout, nil)
-	vk.DestroyDescriptorSetLayout(d.device, d.descLayout, nil)
+	vulkanutil.Destroy(d.device, d.descPool)
+	vulkanutil.Destroy(d.device, d.pipeline)
+	vulkanutil.Destroy(d.device, d.pipelineCache)
+	vulkanutil.Destroy(d.device, d.renderPass)
+	vulkanutil.Destroy(d.device, d.pipelineLayout)
+	vulkanutil.Destroy(d.device, d.descLayout)
 
 	for i := 0; i < demoTextureCount; i++ {
-		vk.DestroyImageView(d.device, d.textures[i].view, nil)
-		vk.DestroyImage(d.device, d.textures[i].image, nil)
-		vk.FreeMemory(d.device, d.textures[i].mem, nil)
-		vk.DestroySampler(d.device, d.textures[i].sampler, nil)
+		vulkanutil.Destroy(d.device, d.textures[i].view)
+		vulkanutil.Destroy(d.device, d.textures[i].image)
+		d.allocator.Free(d.textures[i].mem)
+		vulkanutil.Destroy(d.device, d.textures[i].sampler)
 	}
-	vk.DestroySwapchain(d.device, d.swapchain, nil)
-	vk.DestroyImageView(d.device, d.depth.view, nil)
-	vk.DestroyImage(d.device, d.depth.image, nil)
-	vk.FreeMemory(d.device, d.depth.mem, nil)
+	if !d.headless {
+		vulkanutil.Destroy(d.device, d.presentComplete)
+		vulkanutil.Destroy(d.device, d.swapchain)
+	}
+	vulkanutil.Destroy(d.device, d.depth.view)
+	vulkanutil.Destroy(d.device, d.depth.image)
+	d.allocator.Free(d.depth.mem)
+	d.destroyMSAA()
 
-	vk.DestroyBuffer(d.device, d.uniform.buf, nil)
-	vk.FreeMemory(d.device, d.uniform.mem, nil)
+	vulkanutil.Destroy(d.device, d.uniform.buf)
+	d.allocator.Free(d.uniform.mem)
 
 	for i := 0; i < d.swapchainImageCount; i++ {
-		vk.DestroyImageView(d.device, d.buffers[i].view, nil)
+		vulkanutil.Destroy(d.device, d.buffers[i].view)
 		vk.FreeCommandBuffers(d.device, d.cmdPool, 1, []vk.CommandBuffer{
 			d.buffers[i].cmd,
 		})
 	}
 	d.buffers = nil
 	d.queueProps = nil
+	if d.headless {
+		d.destroyReadback()
+	}
 
-	vk.DestroyCommandPool(d.device, d.cmdPool, nil)
+	vulkanutil.Destroy(d.device, d.cmdPool)
+	err := d.tracker.Close()
+	if err != nil {
+		log.Println("[WARN]", err)
+	}
+	if stats := d.allocator.Stats(); stats.Allocations > 0 {
+		log.Println("[WARN] device memory leaked:", stats)
+		if err == nil {
+			err = fmt.Errorf("device memory leaked: %s", stats)
+		}
+	}
+	d.allocator.Destroy()
 	vk.DestroyDevice(d.device, nil)
 
-	if enableDebug {
+	if d.dbgCallback != vk.NullDebugReportCallback {
 		vk.DestroyDebugReportCallback(d.instance, d.dbgCallback, nil)
 	}
-	vk.DestroySurface(d.instance, d.surface, nil)
+	vulkanutil.DestroyDebugMessenger(d.instance, d.dbgMessenger)
+	if d.surface != vk.NullSurface {
+		vk.DestroySurface(d.instance, d.surface, nil)
+	}
 	vk.DestroyInstance(d.instance, nil)
+	return err
 }
 
 func (d *Demo) resize() {
@@ -1322,37 +1455,40 @@ func (d *Demo) resize() {
 
 	d.prepared = false
 	for i := 0; i < d.swapchainImageCount; i++ {
-		vk.DestroyFramebuffer(d.device, d.framebuffers[i], nil)
+		vulkanutil.Destroy(d.device, d.framebuffers[i])
 	}
 	d.framebuffers = nil
 
-	vk.DestroyDescriptorPool(d.device, d.descPool, nil)
-	vk.DestroyPipeline(d.device, d.pipeline, nil)
-	vk.DestroyPipelineCache(d.device, d.pipelineCache, nil)
-	vk.DestroyRenderPass(d.device, d.renderPass, nil)
-	vk.DestroyPipelineLayout(d.device, d.pipelineLayout, nil)
-	vk.DestroyDescriptorSetLayout(d.device, d.descLayout, nil)
+	vulkanutil.Destroy(d.device, d.descPool)
+	vulkanutil.Destroy(d.device, d.pipeline)
+	vulkanutil.Destroy(d.device, d.pipelineCache)
+	vulkanutil.Destroy(d.device, d.renderPass)
+	vulkanutil.Destroy(d.device, d.pipelineLayout)
+	vulkanutil.Destroy(d.device, d.descLayout)
 
 	for i := 0; i < demoTextureCount; i++ {
-		vk.DestroyImageView(d.device, d.textures[i].view, nil)
-		vk.DestroyImage(d.device, d.textures[i].image, nil)
-		vk.FreeMemory(d.device, d.textures[i].mem, nil)
-		vk.DestroySampler(d.device, d.textures[i].sampler, nil)
+		vulkanutil.Destroy(d.device, d.textures[i].view)
+		vulkanutil.Destroy(d.device, d.textures[i].image)
+		d.allocator.Free(d.textures[i].mem)
+		vulkanutil.Destroy(d.device, d.textures[i].sampler)
 	}
-	vk.DestroyImageView(d.device, d.depth.view, nil)
-	vk.DestroyImage(d.device, d.depth.image, nil)
-	vk.FreeMemory(d.device, d.depth.mem, nil)
+	vulkanutil.Destroy(d.device, d.depth.view)
+	vulkanutil.Destroy(d.device, d.depth.image)
+	d.allocator.Free(d.depth.mem)
+	d.destroyMSAA()
 
-	vk.DestroyBuffer(d.device, d.uniform.buf, nil)
-	vk.FreeMemory(d.device, d.uniform.mem, nil)
+	vulkanutil.Destroy(d.device, d.uniform.buf)
+	d.allocator.Free(d.uniform.mem)
 
 	for i := 0; i < d.swapchainImageCount; i++ {
-		vk.DestroyImageView(d.device, d.buffers[i].view, nil)
+		vulkanutil.Destroy(d.device, d.buffers[i].view)
 		vk.FreeCommandBuffers(d.device, d.cmdPool, 1, []vk.CommandBuffer{
 			d.buffers[i].cmd,
 		})
 	}
 	d.buffers = nil
+	vulkanutil.Destroy(d.device, d.presentComplete)
+	d.presentComplete = vk.NullSemaphore
 
 	// Second, re-perform the Prepare() function, which will re-create the
 	// swapchain:
@@ -1380,109 +1516,12 @@ func (d *Demo) InitModel() {
 func (d *Demo) Step() {
 	vk.DeviceWaitIdle(d.device)
 	d.updateDataBuffer()
-	d.draw()
-	vk.DeviceWaitIdle(d.device)
-}
-
-func NewDemoForAndroid(appInfo vk.ApplicationInfo, window *android.NativeWindow) (d Demo) {
-	existingExtensions := getInstanceExtensions()
-	log.Println("[INFO] Instance extensions:", existingExtensions)
-
-	instanceExtensions := []string{
-		"VK_KHR_surface\x00",
-		"VK_KHR_android_surface\x00",
-	}
-	if enableDebug {
-		instanceExtensions = append(
-			instanceExtensions, "VK_EXT_debug_report\x00")
-	}
-
-	existingLayers := getInstanceLayers()
-	log.Println("[INFO] Instance layers:", existingLayers)
-
-	// these layers must be included in APK,
-	// see Android.mk and ValidationLayers.mk
-	instanceLayers := []string{
-		"VK_LAYER_GOOGLE_threading\x00",
-		"VK_LAYER_LUNARG_parameter_validation\x00",
-		"VK_LAYER_LUNARG_object_tracker\x00",
-		"VK_LAYER_LUNARG_core_validation\x00",
-		"VK_LAYER_LUNARG_api_dump\x00",
-		"VK_LAYER_LUNARG_image\x00",
-		"VK_LAYER_LUNARG_swapchain\x00",
-		"VK_LAYER_GOOGLE_unique_objects\x00",
-	}
-
-	instanceInfo := vk.InstanceCreateInfo{
-		SType:                   vk.StructureTypeInstanceCreateInfo,
-		PApplicationInfo:        &appInfo,
-		EnabledExtensionCount:   uint32(len(instanceExtensions)),
-		PpEnabledExtensionNames: instanceExtensions,
-		EnabledLayerCount:       uint32(len(instanceLayers)),
-		PpEnabledLayerNames:     instanceLayers,
-	}
-	err := vk.CreateInstance(&instanceInfo, nil, &d.instance)
-	orPanic(err)
-
-	surfaceCreateInfo := vk.AndroidSurfaceCreateInfo{
-		SType:  vk.StructureTypeAndroidSurfaceCreateInfo,
-		Window: (*vk.ANativeWindow)(window),
-	}
-	err = vk.CreateAndroidSurface(d.instance, &surfaceCreateInfo, nil, &d.surface)
-	orPanic(err)
-
-	gpuDevices := getPhysicalDevices(d.instance)
-	d.gpu = gpuDevices[0] // choose the firts GPU available
-
-	existingExtensions = getDeviceExtensions(d.gpu)
-	log.Println("[INFO] Device extensions:", existingExtensions)
-
-	existingLayers = getDeviceLayers(d.gpu)
-	log.Println("[INFO] Device layers:", existingLayers)
-
-	// these layers must be included in APK,
-	// see Android.mk and ValidationLayers.mk
-	deviceLayers := []string{
-		"VK_LAYER_GOOGLE_threading\x00",
-		"VK_LAYER_LUNARG_parameter_validation\x00",
-		"VK_LAYER_LUNARG_object_tracker\x00",
-		"VK_LAYER_LUNARG_core_validation\x00",
-		"VK_LAYER_LUNARG_api_dump\x00",
-		"VK_LAYER_LUNARG_image\x00",
-		"VK_LAYER_LUNARG_swapchain\x00",
-		"VK_LAYER_GOOGLE_unique_objects\x00",
-	}
-
-	deviceQueueInfos := []vk.DeviceQueueCreateInfo{{
-		SType:            vk.StructureTypeDeviceQueueCreateInfo,
-		QueueCount:       1,
-		PQueuePriorities: []float32{1.0},
-	}}
-	deviceExtensions := []string{
-		"VK_KHR_swapchain\x00",
-	}
-	deviceInfo := vk.DeviceCreateInfo{
-		SType:                   vk.StructureTypeDeviceCreateInfo,
-		QueueCreateInfoCount:    1,
-		PQueueCreateInfos:       deviceQueueInfos,
-		EnabledExtensionCount:   uint32(len(deviceExtensions)),
-		PpEnabledExtensionNames: deviceExtensions,
-		EnabledLayerCount:       uint32(len(deviceLayers)),
-		PpEnabledLayerNames:     deviceLayers,
-	}
-	err = vk.CreateDevice(d.gpu, &deviceInfo, nil, &d.device)
-	orPanic(err)
-
-	if enableDebug {
-		dbgCreateInfo := vk.DebugReportCallbackCreateInfo{
-			SType:       vk.StructureTypeDebugReportCallbackCreateInfo,
-			Flags:       vk.DebugReportFlags(vk.DebugReportErrorBit | vk.DebugReportWarningBit),
-			PfnCallback: dbgCallbackFunc,
-		}
-		err = vk.CreateDebugReportCallback(d.instance, &dbgCreateInfo, nil, &d.dbgCallback)
-		check(err, "vk.CreateDebugReportCallback failed with")
+	if d.headless {
+		d.drawHeadless()
+	} else {
+		d.draw()
 	}
-	return d
+	vk.DeviceWaitIdle(d.device)
 }
 
 func (d *Demo) prepareSurfaceCapabilities() {
@@ -1565,6 +1604,23 @@ func getInstanceExtensions() (extNames []string) {
 	return extNames
 }
 
+// getLayerExtensions lists the instance extensions provided by the layer,
+// layerName is NUL-terminated.
+func getLayerExtensions(layerName string) (extNames []string) {
+	var instanceExtLen uint32
+	err := vk.EnumerateInstanceExtensionProperties(layerName, &instanceExtLen, nil)
+	orPanic(err)
+	instanceExt := make([]vk.ExtensionProperties, instanceExtLen)
+	err = vk.EnumerateInstanceExtensionProperties(layerName, &instanceExtLen, instanceExt)
+	orPanic(err)
+	for _, ext := range instanceExt {
+		ext.Deref()
+		extNames = append(extNames,
+			vk.ToString(ext.ExtensionName[:]))
+	}
+	return extNames
+}
+
 func getDeviceExtensions(gpu vk.PhysicalDevice) (extNames []string) {
 	var deviceExtLen uint32
 	err := vk.EnumerateDeviceExtensionProperties(gpu, "", &deviceExtLen, nil)
@@ -0,0 +1,81 @@
+//go:build android
+// +build android
+
+package main
+
+import (
+	"log"
+
+	"github.com/vulkan-go/demos/vulkanutil"
+	vk "github.com/vulkan-go/vulkan"
+	"github.com/xlab/android-go/android"
+)
+
+func NewDemoForAndroid(appInfo vk.ApplicationInfo, window *android.NativeWindow) (d Demo) {
+	existingExtensions := getInstanceExtensions()
+	log.Println("[INFO] Instance extensions:", existingExtensions)
+
+	instanceLayers, debugExtensions := debugLayers(existingExtensions)
+	instanceExtensions := append([]string{
+		"VK_KHR_surface\x00",
+		"VK_KHR_android_surface\x00",
+	}, debugExtensions...)
+
+	instanceInfo := vk.InstanceCreateInfo{
+		SType:                   vk.StructureTypeInstanceCreateInfo,
+		PApplicationInfo:        &appInfo,
+		EnabledExtensionCount:   uint32(len(instanceExtensions)),
+		PpEnabledExtensionNames: instanceExtensions,
+		EnabledLayerCount:       uint32(len(instanceLayers)),
+		PpEnabledLayerNames:     instanceLayers,
+	}
+	free := chainDebugMessenger(&instanceInfo, debugExtensions)
+	err := vk.CreateInstance(&instanceInfo, nil, &d.instance)
+	free()
+	orPanic(err)
+	d.prepareDebugCallback(debugExtensions)
+
+	surfaceCreateInfo := vk.AndroidSurfaceCreateInfo{
+		SType:  vk.StructureTypeAndroidSurfaceCreateInfo,
+		Window: (*vk.ANativeWindow)(window),
+	}
+	err = vk.CreateAndroidSurface(d.instance, &surfaceCreateInfo, nil, &d.surface)
+	orPanic(err)
+
+	gpuDevices := getPhysicalDevices(d.instance)
+	d.gpu = gpuDevices[0] // choose the firts GPU available
+
+	existingExtensions = getDeviceExtensions(d.gpu)
+	log.Println("[INFO] Device extensions:", existingExtensions)
+
+	if validation {
+		log.Println("[INFO] Device layers:", getDeviceLayers(d.gpu))
+	}
+	// the validation layer must be included in APK,
+	// see Android.mk and ValidationLayers.mk
+	deviceLayers := instanceLayers
+
+	deviceQueueInfos := []vk.DeviceQueueCreateInfo{{
+		SType:            vk.StructureTypeDeviceQueueCreateInfo,
+		QueueCount:       1,
+		PQueuePriorities: []float32{1.0},
+	}}
+	deviceExtensions := []string{
+		"VK_KHR_swapchain\x00",
+	}
+	deviceInfo := vk.DeviceCreateInfo{
+		SType:                   vk.StructureTypeDeviceCreateInfo,
+		QueueCreateInfoCount:    1,
+		PQueueCreateInfos:       deviceQueueInfos,
+		EnabledExtensionCount:   uint32(len(deviceExtensions)),
+		PpEnabledExtensionNames: deviceExtensions,
+		EnabledLayerCount:       uint32(len(deviceLayers)),
+		PpEnabledLayerNames:     deviceLayers,
+	}
+	err = vk.CreateDevice(d.gpu, &deviceInfo, nil, &d.device)
+	orPanic(err)
+	d.allocator = vulkanutil.NewAllocator(d.gpu, d.device, 0)
+	d.tracker = vulkanutil.NewTracker(d.device)
+	d.enableDebugUtils()
+	return d
+}
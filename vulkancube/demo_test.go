@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/vulkan-go/demos/internal/golden"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// goldenOptions allow for small rasterization and filtering
+// differences between drivers.
+var goldenOptions = golden.Options{
+	Tolerance:     8,
+	MaxMismatched: 256,
+}
+
+func newTestDemo(t *testing.T, width, height uint32) (d Demo) {
+	if err := vk.SetDefaultGetInstanceProcAddr(); err != nil {
+		t.Skip("no Vulkan loader:", err)
+	}
+	if err := vk.Init(); err != nil {
+		t.Skip("no Vulkan loader:", err)
+	}
+	defer func() {
+		// the demo panics on errors, no device means nothing to test.
+		if err := recover(); err != nil {
+			t.Skip("no Vulkan device:", err)
+		}
+	}()
+	d = NewDemoHeadless(appInfo, width, height)
+	return d
+}
+
+func TestCubeGolden(t *testing.T) {
+	sizes := []vk.Extent2D{
+		{Width: 256, Height: 256},
+		{Width: 320, Height: 240},
+	}
+	angles := []float32{0, 30, 60, 135}
+
+	for _, size := range sizes {
+		t.Run(fmt.Sprintf("%dx%d", size.Width, size.Height), func(t *testing.T) {
+			d := newTestDemo(t, size.Width, size.Height)
+			d.InitModel()
+			d.Prepare(
+				"shaders/cube-vert.spv",
+				"shaders/cube-frag.spv",
+				"assets/lunarg.ppm")
+			defer func() {
+				// leaked objects fail the test
+				if err := d.Cleanup(); err != nil {
+					t.Error(err)
+				}
+			}()
+
+			for _, angle := range angles {
+				t.Run(fmt.Sprintf("%.0f", angle), func(t *testing.T) {
+					// InitModel resets the model matrix, so each frame
+					// is rotated by exactly angle degrees.
+					d.InitModel()
+					d.spinAngle = angle
+					d.Step()
+					name := fmt.Sprintf("cube_%dx%d_%03.0f", size.Width, size.Height, angle)
+					golden.Compare(t, name, d.Capture(), goldenOptions)
+				})
+			}
+		})
+	}
+}
+
+func TestCubeGoldenMSAA(t *testing.T) {
+	d := newTestDemo(t, 256, 256)
+	d.SetSamples(vk.SampleCount4Bit)
+	d.InitModel()
+	d.Prepare(
+		"shaders/cube-vert.spv",
+		"shaders/cube-frag.spv",
+		"assets/lunarg.ppm")
+	defer func() {
+		if err := d.Cleanup(); err != nil {
+			t.Error(err)
+		}
+	}()
+	if d.samples != vk.SampleCount4Bit {
+		t.Skip("4 samples are not supported")
+	}
+
+	d.spinAngle = 30
+	d.Step()
+	golden.Compare(t, "cube_256x256_030_msaa4", d.Capture(), goldenOptions)
+}
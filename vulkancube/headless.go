@@ -0,0 +1,252 @@
+package main
+
+import (
+	"image"
+	"log"
+
+	"github.com/vulkan-go/demos/vulkanutil"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// ReadbackInfo tracks the color image of a headless demo
+// and the host visible buffer each frame is copied to.
+type ReadbackInfo struct {
+	image   vk.Image
+	mem     vulkanutil.Allocation
+	buf     vk.Buffer
+	bufMem  vulkanutil.Allocation
+	bufSize vk.DeviceSize
+}
+
+// NewDemoHeadless creates a demo without a surface, frames are rendered
+// into an image of the given size and can be read back with Capture.
+func NewDemoHeadless(appInfo vk.ApplicationInfo, width, height uint32) (d Demo) {
+	d.headless = true
+	d.width = width
+	d.height = height
+	d.format = vk.FormatR8g8b8a8Unorm
+
+	// no surface extensions are needed, debugLayers leaves out VK_EXT_debug_report
+	// if it is missing on the machines running the tests.
+	instanceLayers, debugExtensions := debugLayers(getInstanceExtensions())
+	instanceInfo := vk.InstanceCreateInfo{
+		SType:                   vk.StructureTypeInstanceCreateInfo,
+		PApplicationInfo:        &appInfo,
+		EnabledExtensionCount:   uint32(len(debugExtensions)),
+		PpEnabledExtensionNames: debugExtensions,
+		EnabledLayerCount:       uint32(len(instanceLayers)),
+		PpEnabledLayerNames:     instanceLayers,
+	}
+	free := chainDebugMessenger(&instanceInfo, debugExtensions)
+	err := vk.CreateInstance(&instanceInfo, nil, &d.instance)
+	free()
+	orPanic(err)
+	d.prepareDebugCallback(debugExtensions)
+
+	gpuDevices := getPhysicalDevices(d.instance)
+	d.gpu = gpuDevices[0] // choose the firts GPU available
+
+	var queueCount uint32
+	vk.GetPhysicalDeviceQueueFamilyProperties(d.gpu, &queueCount, nil)
+	d.queueCount = int(queueCount)
+	d.queueProps = make([]vk.QueueFamilyProperties, d.queueCount)
+	vk.GetPhysicalDeviceQueueFamilyProperties(d.gpu, &queueCount, d.queueProps)
+
+	gfxQueueIdx := -1
+	for i := 0; i < d.queueCount; i++ {
+		props := d.queueProps[i]
+		props.Deref()
+		if props.QueueFlags&vk.QueueFlags(vk.QueueGraphicsBit) != 0 {
+			gfxQueueIdx = i
+			break
+		}
+	}
+	orPanicWith(gfxQueueIdx >= 0, "Cannot find queue with graphics support")
+	d.graphicsQueueNodeIndex = uint32(gfxQueueIdx)
+
+	deviceQueueInfos := []vk.DeviceQueueCreateInfo{{
+		SType:            vk.StructureTypeDeviceQueueCreateInfo,
+		QueueFamilyIndex: d.graphicsQueueNodeIndex,
+		QueueCount:       1,
+		PQueuePriorities: []float32{1.0},
+	}}
+	deviceInfo := vk.DeviceCreateInfo{
+		SType:                vk.StructureTypeDeviceCreateInfo,
+		QueueCreateInfoCount: 1,
+		PQueueCreateInfos:    deviceQueueInfos,
+		EnabledLayerCount:    uint32(len(instanceLayers)),
+		PpEnabledLayerNames:  instanceLayers,
+	}
+	err = vk.CreateDevice(d.gpu, &deviceInfo, nil, &d.device)
+	orPanic(err)
+	d.allocator = vulkanutil.NewAllocator(d.gpu, d.device, 0)
+	d.tracker = vulkanutil.NewTracker(d.device)
+	d.enableDebugUtils()
+
+	var queue vk.Queue
+	vk.GetDeviceQueue(d.device, d.graphicsQueueNodeIndex, 0, &queue)
+	d.queue = queue
+	return d
+}
+
+// prepareReadback replaces prepareSwapchain for headless demos:
+// it creates a single color image and the buffer frames are copied to.
+func (d *Demo) prepareReadback() {
+	imageInfo := vk.ImageCreateInfo{
+		SType:     vk.StructureTypeImageCreateInfo,
+		ImageType: vk.ImageType2d,
+		Format:    d.format,
+		Extent: vk.Extent3D{
+			Width:  d.width,
+			Height: d.height,
+			Depth:  1,
+		},
+		MipLevels:   1,
+		ArrayLayers: 1,
+		Samples:     vk.SampleCount1Bit,
+		Tiling:      vk.ImageTilingOptimal,
+		Usage: vk.ImageUsageFlags(vk.ImageUsageColorAttachmentBit |
+			vk.ImageUsageTransferSrcBit),
+	}
+	err := vk.CreateImage(d.device, &imageInfo, nil, &d.readback.image)
+	orPanic(err)
+	vulkanutil.Track(d.device, d.readback.image)
+	vulkanutil.SetObjectName(d.device, d.readback.image, "offscreen image")
+
+	d.readback.mem = d.allocImage(d.readback.image, vk.ImageTilingOptimal, vk.MemoryPropertyDeviceLocalBit)
+
+	// The render pass expects ColorAttachmentOptimal and readbackBuildCmd
+	// returns the image to that layout after each copy.
+	d.setImageLayout(d.readback.image, vk.ImageAspectFlags(vk.ImageAspectColorBit),
+		vk.ImageLayoutUndefined, vk.ImageLayoutColorAttachmentOptimal, 0)
+
+	viewInfo := vk.ImageViewCreateInfo{
+		SType:    vk.StructureTypeImageViewCreateInfo,
+		Image:    d.readback.image,
+		ViewType: vk.ImageViewType2d,
+		Format:   d.format,
+		Components: vk.ComponentMapping{
+			R: vk.ComponentSwizzleR,
+			G: vk.ComponentSwizzleG,
+			B: vk.ComponentSwizzleB,
+			A: vk.ComponentSwizzleA,
+		},
+		SubresourceRange: vk.ImageSubresourceRange{
+			AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
+			LevelCount: 1,
+			LayerCount: 1,
+		},
+	}
+	d.swapchainImageCount = 1
+	d.buffers = make([]SwapchainBuffersInfo, 1)
+	d.buffers[0].image = d.readback.image
+	err = vk.CreateImageView(d.device, &viewInfo, nil, &d.buffers[0].view)
+	orPanic(err)
+	vulkanutil.Track(d.device, d.buffers[0].view)
+
+	d.readback.bufSize = vk.DeviceSize(d.width * d.height * 4)
+	bufInfo := vk.BufferCreateInfo{
+		SType: vk.StructureTypeBufferCreateInfo,
+		Usage: vk.BufferUsageFlags(vk.BufferUsageTransferDstBit),
+		Size:  d.readback.bufSize,
+	}
+	err = vk.CreateBuffer(d.device, &bufInfo, nil, &d.readback.buf)
+	orPanic(err)
+	vulkanutil.Track(d.device, d.readback.buf)
+	vulkanutil.SetObjectName(d.device, d.readback.buf, "readback buffer")
+
+	d.readback.bufMem = d.allocBuffer(d.readback.buf,
+		vk.MemoryPropertyHostVisibleBit|vk.MemoryPropertyHostCoherentBit)
+}
+
+// readbackBuildCmd records the copy of the rendered image into the readback
+// buffer, it takes the place of the pre-present barrier in drawBuildCmd.
+func (d *Demo) readbackBuildCmd(cmdBuf vk.CommandBuffer) {
+	subresourceRange := vk.ImageSubresourceRange{
+		AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
+		LevelCount: 1,
+		LayerCount: 1,
+	}
+	preCopyBarrier := vk.ImageMemoryBarrier{
+		SType:               vk.StructureTypeImageMemoryBarrier,
+		SrcAccessMask:       vk.AccessFlags(vk.AccessColorAttachmentWriteBit),
+		DstAccessMask:       vk.AccessFlags(vk.AccessTransferReadBit),
+		OldLayout:           vk.ImageLayoutColorAttachmentOptimal,
+		NewLayout:           vk.ImageLayoutTransferSrcOptimal,
+		SrcQueueFamilyIndex: vk.QueueFamilyIgnored,
+		DstQueueFamilyIndex: vk.QueueFamilyIgnored,
+		Image:               d.readback.image,
+		SubresourceRange:    subresourceRange,
+	}
+	vk.CmdPipelineBarrier(cmdBuf,
+		vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+		vk.PipelineStageFlags(vk.PipelineStageTransferBit),
+		0, 0, nil, 0, nil, 1, []vk.ImageMemoryBarrier{preCopyBarrier})
+
+	copyRegions := []vk.BufferImageCopy{{
+		ImageSubresource: vk.ImageSubresourceLayers{
+			AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
+			LayerCount: 1,
+		},
+		ImageExtent: vk.Extent3D{
+			Width:  d.width,
+			Height: d.height,
+			Depth:  1,
+		},
+	}}
+	vk.CmdCopyImageToBuffer(cmdBuf, d.readback.image, vk.ImageLayoutTransferSrcOptimal,
+		d.readback.buf, 1, copyRegions)
+
+	postCopyBarrier := vk.ImageMemoryBarrier{
+		SType:               vk.StructureTypeImageMemoryBarrier,
+		SrcAccessMask:       vk.AccessFlags(vk.AccessTransferReadBit),
+		DstAccessMask:       vk.AccessFlags(vk.AccessColorAttachmentWriteBit),
+		OldLayout:           vk.ImageLayoutTransferSrcOptimal,
+		NewLayout:           vk.ImageLayoutColorAttachmentOptimal,
+		SrcQueueFamilyIndex: vk.QueueFamilyIgnored,
+		DstQueueFamilyIndex: vk.QueueFamilyIgnored,
+		Image:               d.readback.image,
+		SubresourceRange:    subresourceRange,
+	}
+	vk.CmdPipelineBarrier(cmdBuf,
+		vk.PipelineStageFlags(vk.PipelineStageTransferBit),
+		vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+		0, 0, nil, 0, nil, 1, []vk.ImageMemoryBarrier{postCopyBarrier})
+}
+
+func (d *Demo) drawHeadless() {
+	submitInfos := []vk.SubmitInfo{{
+		SType:              vk.StructureTypeSubmitInfo,
+		CommandBufferCount: 1,
+		PCommandBuffers: []vk.CommandBuffer{
+			d.buffers[0].cmd,
+		},
+	}}
+	err := vk.QueueSubmit(d.queue, 1, submitInfos, vk.NullHandle)
+	orPanic(err)
+	err = vk.QueueWaitIdle(d.queue)
+	orPanic(err)
+}
+
+// Capture returns the last frame rendered by a headless demo.
+func (d *Demo) Capture() *image.RGBA {
+	orPanicWith(d.headless, "Capture is only supported by headless demos")
+
+	data := d.mapMemory(d.readback.bufMem)
+
+	img := image.NewRGBA(image.Rect(0, 0, int(d.width), int(d.height)))
+	size := int(d.readback.bufSize)
+	n := copy(img.Pix, (*[1 << 30]byte)(data)[:size:size])
+	if n != len(img.Pix) {
+		log.Println("[WARN] failed to copy frame data")
+	}
+	d.allocator.Unmap(d.readback.bufMem)
+	return img
+}
+
+func (d *Demo) destroyReadback() {
+	vulkanutil.Destroy(d.device, d.readback.buf)
+	d.allocator.Free(d.readback.bufMem)
+	vulkanutil.Destroy(d.device, d.readback.image)
+	d.allocator.Free(d.readback.mem)
+}
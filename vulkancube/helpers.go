@@ -6,6 +6,7 @@ import (
 	"strings"
 	"unsafe"
 
+	"github.com/vulkan-go/demos/vulkanutil"
 	vk "github.com/vulkan-go/vulkan"
 )
 
@@ -34,6 +35,29 @@ func orPanic(err interface{}) {
 	}
 }
 
+// allocImage allocates and binds memory for image, see vulkanutil.Allocator.
+func (d *Demo) allocImage(image vk.Image, tiling vk.ImageTiling,
+	props vk.MemoryPropertyFlagBits) vulkanutil.Allocation {
+
+	mem, err := d.allocator.AllocImage(image, tiling, props)
+	orPanic(err)
+	return mem
+}
+
+// allocBuffer allocates and binds memory for buf, see vulkanutil.Allocator.
+func (d *Demo) allocBuffer(buf vk.Buffer, props vk.MemoryPropertyFlagBits) vulkanutil.Allocation {
+	mem, err := d.allocator.AllocBuffer(buf, props)
+	orPanic(err)
+	return mem
+}
+
+// mapMemory maps host visible memory, release it with d.allocator.Unmap.
+func (d *Demo) mapMemory(mem vulkanutil.Allocation) unsafe.Pointer {
+	data, err := d.allocator.Map(mem)
+	orPanic(err)
+	return data
+}
+
 func orPanicWith(err interface{}, notes ...string) {
 	getNotes := func() string {
 		return strings.Join(notes, " ")
@@ -1,3 +1,6 @@
+//go:build android
+// +build android
+
 package main
 
 import (
@@ -12,14 +15,6 @@ func init() {
 	app.SetLogTag("VulkanCube")
 }
 
-var appInfo = vk.ApplicationInfo{
-	SType:              vk.StructureTypeApplicationInfo,
-	ApiVersion:         vk.MakeVersion(1, 0, 0),
-	ApplicationVersion: vk.MakeVersion(1, 0, 0),
-	PApplicationName:   "VulkanCube\x00",
-	PEngineName:        "golang\x00",
-}
-
 func main() {
 	nativeWindowEvents := make(chan app.NativeWindowEvent)
 	inputQueueEvents := make(chan app.InputQueueEvent, 1)
@@ -57,6 +52,7 @@ func main() {
 					err := vk.Init()
 					orPanic(err)
 					demo = NewDemoForAndroid(appInfo, event.Window)
+					demo.SetSamples(vk.SampleCount4Bit)
 					demo.InitModel()
 					demo.Prepare(
 						"shaders/cube-vert.spv",
@@ -0,0 +1,55 @@
+//go:build !android
+// +build !android
+
+package main
+
+import (
+	"flag"
+	"image/png"
+	"log"
+	"os"
+
+	"github.com/vulkan-go/demos/vulkanutil"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+var (
+	width    = flag.Uint("width", 640, "frame width")
+	height   = flag.Uint("height", 640, "frame height")
+	angle    = flag.Float64("angle", 30, "spin angle of the cube in degrees")
+	output   = flag.String("o", "cube.png", "PNG file to write the frame to")
+	samples  = flag.Int("samples", 1, "samples per pixel for multisample anti-aliasing, e.g. 4")
+	validate = flag.Bool("validate", validation, "enable the validation layer if installed, also set by "+vulkanutil.ValidationEnv+"=1")
+	severity = flag.String("validate-severity", "warning", "least severe validation message logged: verbose, info, warning or error")
+	msgTypes = flag.String("validate-types", "general,validation,performance", "validation message types logged, comma separated")
+)
+
+// main renders a single frame headless, the full demo runs on Android only.
+func main() {
+	flag.Parse()
+	validation = *validate
+	filter, err := vulkanutil.ParseDebugMessageFilter(*severity, *msgTypes)
+	orPanic(err)
+	debugMessages = filter
+	orPanic(vk.SetDefaultGetInstanceProcAddr())
+	orPanic(vk.Init())
+
+	demo := NewDemoHeadless(appInfo, uint32(*width), uint32(*height))
+	demo.SetSamples(vk.SampleCountFlagBits(*samples))
+	demo.InitModel()
+	demo.Prepare(
+		"shaders/cube-vert.spv",
+		"shaders/cube-frag.spv",
+		"assets/lunarg.ppm")
+	defer demo.Cleanup()
+
+	demo.spinAngle = float32(*angle)
+	demo.Step()
+	img := demo.Capture()
+
+	f, err := os.Create(*output)
+	orPanic(err)
+	defer f.Close()
+	orPanic(png.Encode(f, img))
+	log.Println("[INFO] frame saved to", *output)
+}
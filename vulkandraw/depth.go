@@ -0,0 +1,47 @@
+package vulkandraw
+
+import (
+	"fmt"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// depthFormats are the depth formats tried by CreateRenderer, most precise first.
+var depthFormats = []vk.Format{
+	vk.FormatD32Sfloat,
+	vk.FormatD24UnormS8Uint,
+	vk.FormatD16Unorm,
+}
+
+// findDepthFormat returns the first of depthFormats the device can use
+// as an optimally tiled depth attachment.
+func findDepthFormat(gpu vk.PhysicalDevice) (vk.Format, error) {
+	for _, format := range depthFormats {
+		var props vk.FormatProperties
+		vk.GetPhysicalDeviceFormatProperties(gpu, format, &props)
+		props.Deref()
+		if props.OptimalTilingFeatures&
+			vk.FormatFeatureFlags(vk.FormatFeatureDepthStencilAttachmentBit) != 0 {
+			return format, nil
+		}
+	}
+	err := fmt.Errorf("vulkandraw: no supported depth format")
+	return vk.FormatUndefined, err
+}
+
+func depthAspect(format vk.Format) vk.ImageAspectFlags {
+	if format == vk.FormatD24UnormS8Uint {
+		return vk.ImageAspectFlags(vk.ImageAspectDepthBit | vk.ImageAspectStencilBit)
+	}
+	return vk.ImageAspectFlags(vk.ImageAspectDepthBit)
+}
+
+// createDepthImage creates a depth image of the given size in the depth format
+// of r. A renderer without depth gives an empty image whose view is vk.NullImageView.
+func (r *VulkanRenderInfo) createDepthImage(size vk.Extent2D) (attachmentImage, error) {
+	if r.DepthFormat == vk.FormatUndefined {
+		return attachmentImage{}, nil
+	}
+	return r.createAttachmentImage("depth image", r.DepthFormat, size,
+		vk.ImageUsageDepthStencilAttachmentBit, depthAspect(r.DepthFormat))
+}
@@ -0,0 +1,227 @@
+package vulkandraw
+
+import (
+	"fmt"
+	"log"
+	"unsafe"
+
+	"github.com/vulkan-go/demos/vulkanutil"
+	vk "github.com/vulkan-go/vulkan"
+	"github.com/xlab/linmath"
+)
+
+// VertexAttribute is one attribute of an interleaved vertex,
+// Location matches the layout location in the vertex shader.
+type VertexAttribute struct {
+	Location uint32
+	Format   vk.Format
+	Offset   uint32
+}
+
+// VertexLayout declares the vertices of a mesh: all attributes are
+// interleaved in a single buffer, Stride bytes per vertex.
+type VertexLayout struct {
+	Stride     uint32
+	Attributes []VertexAttribute
+}
+
+func (l VertexLayout) bindingDescriptions() []vk.VertexInputBindingDescription {
+	return []vk.VertexInputBindingDescription{{
+		Binding:   0,
+		Stride:    l.Stride,
+		InputRate: vk.VertexInputRateVertex,
+	}}
+}
+
+func (l VertexLayout) attributeDescriptions() []vk.VertexInputAttributeDescription {
+	descriptions := make([]vk.VertexInputAttributeDescription, 0, len(l.Attributes))
+	for _, attr := range l.Attributes {
+		descriptions = append(descriptions, vk.VertexInputAttributeDescription{
+			Binding:  0,
+			Location: attr.Location,
+			Format:   attr.Format,
+			Offset:   attr.Offset,
+		})
+	}
+	return descriptions
+}
+
+// vertexFormatSizes are the sizes in bytes of the formats accepted
+// for vertex attributes.
+var vertexFormatSizes = map[vk.Format]uint32{
+	vk.FormatR8g8b8a8Unorm:          4,
+	vk.FormatR8g8b8a8Snorm:          4,
+	vk.FormatR8g8b8a8Uint:           4,
+	vk.FormatR8g8b8a8Sint:           4,
+	vk.FormatB8g8r8a8Unorm:          4,
+	vk.FormatA2b10g10r10UnormPack32: 4,
+	vk.FormatA2b10g10r10SnormPack32: 4,
+	vk.FormatR16g16Sfloat:           4,
+	vk.FormatR16g16b16a16Sfloat:     8,
+	vk.FormatR32Uint:                4,
+	vk.FormatR32Sint:                4,
+	vk.FormatR32Sfloat:              4,
+	vk.FormatR32g32Uint:             8,
+	vk.FormatR32g32Sint:             8,
+	vk.FormatR32g32Sfloat:           8,
+	vk.FormatR32g32b32Uint:          12,
+	vk.FormatR32g32b32Sint:          12,
+	vk.FormatR32g32b32Sfloat:        12,
+	vk.FormatR32g32b32a32Uint:       16,
+	vk.FormatR32g32b32a32Sint:       16,
+	vk.FormatR32g32b32a32Sfloat:     16,
+}
+
+// validate checks that every attribute lies within a vertex.
+func (l VertexLayout) validate() error {
+	if l.Stride == 0 {
+		err := fmt.Errorf("vulkandraw: vertex layout has no stride")
+		return err
+	}
+	for _, attr := range l.Attributes {
+		size, ok := vertexFormatSizes[attr.Format]
+		if !ok {
+			err := fmt.Errorf("vulkandraw: attribute at location %d has unsupported format %d",
+				attr.Location, attr.Format)
+			return err
+		}
+		if uint64(attr.Offset)+uint64(size) > uint64(l.Stride) {
+			err := fmt.Errorf("vulkandraw: attribute at location %d of %d bytes at offset %d exceeds the %d bytes stride",
+				attr.Location, size, attr.Offset, l.Stride)
+			return err
+		}
+	}
+	return nil
+}
+
+// Mesh is the data uploaded by CreateMesh. At most one of Indices16 and
+// Indices32 may be set, without indices the vertices are drawn in order.
+type Mesh struct {
+	Layout   VertexLayout
+	Vertices []byte
+
+	Indices16 []uint16
+	Indices32 []uint32
+
+	// HostVisible keeps the buffers in host visible memory instead of
+	// copying them into device local memory through a staging buffer.
+	HostVisible bool
+}
+
+// PositionLayout is a single vec3 position at location 0,
+// the layout expected by the triangle shaders.
+var PositionLayout = VertexLayout{
+	Stride: 3 * 4, // 4 = sizeof(float32)
+	Attributes: []VertexAttribute{{
+		Location: 0,
+		Format:   vk.FormatR32g32b32Sfloat,
+		Offset:   0,
+	}},
+}
+
+// TriangleMesh is the triangle drawn by the demo.
+var TriangleMesh = Mesh{
+	Layout: PositionLayout,
+	Vertices: Float32Bytes([]float32{
+		-1, -1, 0,
+		1, -1, 0,
+		0, 1, 0,
+	}),
+}
+
+// Float32Bytes returns the bytes of data, for filling Mesh.Vertices.
+func Float32Bytes(data []float32) []byte {
+	return linmath.ArrayFloat32(data).Data()
+}
+
+func rawBytes(ptr unsafe.Pointer, size int) []byte {
+	if size == 0 {
+		return nil
+	}
+	return (*[1 << 30]byte)(ptr)[:size:size]
+}
+
+// validate checks the layout and that the vertices are whole vertices of it.
+func (m *Mesh) validate() error {
+	if err := m.Layout.validate(); err != nil {
+		return err
+	}
+	if len(m.Vertices) == 0 {
+		err := fmt.Errorf("vulkandraw: mesh has no vertices")
+		return err
+	}
+	if len(m.Vertices)%int(m.Layout.Stride) != 0 {
+		err := fmt.Errorf("vulkandraw: %d bytes of vertices are not a multiple of the %d bytes stride",
+			len(m.Vertices), m.Layout.Stride)
+		return err
+	}
+	return nil
+}
+
+func (m *Mesh) indexData() ([]byte, vk.IndexType, uint32, error) {
+	switch {
+	case len(m.Indices16) > 0 && len(m.Indices32) > 0:
+		err := fmt.Errorf("vulkandraw: mesh has both 16 and 32-bit indices")
+		return nil, 0, 0, err
+	case len(m.Indices16) > 0:
+		data := rawBytes(unsafe.Pointer(&m.Indices16[0]), len(m.Indices16)*2)
+		return data, vk.IndexTypeUint16, uint32(len(m.Indices16)), nil
+	case len(m.Indices32) > 0:
+		data := rawBytes(unsafe.Pointer(&m.Indices32[0]), len(m.Indices32)*4)
+		return data, vk.IndexTypeUint32, uint32(len(m.Indices32)), nil
+	}
+	return nil, 0, 0, nil
+}
+
+// CreateMesh uploads the vertices and indices of mesh into buffers,
+// draw it with a pipeline created for mesh.Layout, see CreateGraphicsPipeline.
+func (v VulkanDeviceInfo) CreateMesh(mesh Mesh) (VulkanBufferInfo, error) {
+	buffer := VulkanBufferInfo{
+		device:    v.Device,
+		allocator: v.allocator,
+		Layout:    mesh.Layout,
+	}
+	if err := mesh.validate(); err != nil {
+		return buffer, err
+	}
+	indices, indexType, indexCount, err := mesh.indexData()
+	if err != nil {
+		return buffer, err
+	}
+
+	vertexBuffer, vertexMemory, err := v.createMeshBuffer(&mesh, vk.BufferUsageVertexBufferBit, mesh.Vertices)
+	if err != nil {
+		return buffer, err
+	}
+	buffer.vertexBuffers = []vk.Buffer{vertexBuffer}
+	buffer.memory = append(buffer.memory, vertexMemory)
+	buffer.VertexCount = uint32(len(mesh.Vertices)) / mesh.Layout.Stride
+
+	if indexCount > 0 {
+		indexBuffer, indexMemory, err := v.createMeshBuffer(&mesh, vk.BufferUsageIndexBufferBit, indices)
+		if err != nil {
+			buffer.Destroy()
+			return buffer, err
+		}
+		buffer.indexBuffer = indexBuffer
+		buffer.memory = append(buffer.memory, indexMemory)
+		buffer.indexType = indexType
+		buffer.IndexCount = indexCount
+	}
+	return buffer, nil
+}
+
+// createMeshBuffer uploads data into device local memory, unless the mesh asks
+// for host visible memory or the staging upload fails.
+func (v *VulkanDeviceInfo) createMeshBuffer(mesh *Mesh, usage vk.BufferUsageFlagBits,
+	data []byte) (vk.Buffer, vulkanutil.Allocation, error) {
+
+	if !mesh.HostVisible {
+		buffer, memory, err := v.createDeviceLocalBuffer(usage, data)
+		if err == nil {
+			return buffer, memory, nil
+		}
+		log.Printf("[WARN] staging upload failed, using host visible memory: %s", err)
+	}
+	return v.createHostBuffer(usage, data)
+}
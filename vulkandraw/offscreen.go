@@ -0,0 +1,307 @@
+package vulkandraw
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/vulkan-go/demos/vulkanutil"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// OffscreenFormat is the color format of offscreen targets,
+// it matches the memory layout of image.RGBA.
+const OffscreenFormat = vk.FormatR8g8b8a8Unorm
+
+// VulkanOffscreenInfo is a render target backed by a device image
+// instead of a swapchain, so the demo can run without a display.
+type VulkanOffscreenInfo struct {
+	device    vk.Device
+	allocator *vulkanutil.Allocator
+
+	Size        vk.Extent2D
+	Format      vk.Format
+	Framebuffer vk.Framebuffer
+	View        vk.ImageView
+
+	image          vk.Image
+	imageMemory    vulkanutil.Allocation
+	readback       vk.Buffer
+	readbackMemory vulkanutil.Allocation
+	targets        renderTargets
+}
+
+// CreateOffscreen creates a color image of the given size and
+// a host visible buffer the image is copied to after rendering.
+func (v *VulkanDeviceInfo) CreateOffscreen(width, height uint32) (VulkanOffscreenInfo, error) {
+	o := VulkanOffscreenInfo{
+		device:    v.Device,
+		allocator: v.allocator,
+		Size: vk.Extent2D{
+			Width:  width,
+			Height: height,
+		},
+		Format: OffscreenFormat,
+	}
+
+	// Phase 1: vk.CreateImage
+	//			create the color image in device local memory
+
+	imageCreateInfo := vk.ImageCreateInfo{
+		SType:     vk.StructureTypeImageCreateInfo,
+		ImageType: vk.ImageType2d,
+		Format:    o.Format,
+		Extent: vk.Extent3D{
+			Width:  width,
+			Height: height,
+			Depth:  1,
+		},
+		MipLevels:     1,
+		ArrayLayers:   1,
+		Samples:       vk.SampleCount1Bit,
+		Tiling:        vk.ImageTilingOptimal,
+		Usage:         vk.ImageUsageFlags(vk.ImageUsageColorAttachmentBit | vk.ImageUsageTransferSrcBit),
+		SharingMode:   vk.SharingModeExclusive,
+		InitialLayout: vk.ImageLayoutUndefined,
+	}
+	err := vk.Error(vk.CreateImage(v.Device, &imageCreateInfo, nil, &o.image))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateImage failed with %s", err)
+		return o, err
+	}
+	vulkanutil.Track(v.Device, o.image)
+	vulkanutil.SetObjectName(v.Device, o.image, "offscreen image")
+	o.imageMemory, err = v.allocator.AllocImage(o.image, vk.ImageTilingOptimal, vk.MemoryPropertyDeviceLocalBit)
+	if err != nil {
+		o.Destroy()
+		return o, err
+	}
+
+	// Phase 2: vk.CreateImageView
+
+	viewCreateInfo := vk.ImageViewCreateInfo{
+		SType:    vk.StructureTypeImageViewCreateInfo,
+		Image:    o.image,
+		ViewType: vk.ImageViewType2d,
+		Format:   o.Format,
+		Components: vk.ComponentMapping{
+			R: vk.ComponentSwizzleR,
+			G: vk.ComponentSwizzleG,
+			B: vk.ComponentSwizzleB,
+			A: vk.ComponentSwizzleA,
+		},
+		SubresourceRange: vk.ImageSubresourceRange{
+			AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
+			LevelCount: 1,
+			LayerCount: 1,
+		},
+	}
+	err = vk.Error(vk.CreateImageView(v.Device, &viewCreateInfo, nil, &o.View))
+	if err != nil {
+		o.View = vk.NullImageView // undefined after a failed create
+		o.Destroy()
+		err = fmt.Errorf("vk.CreateImageView failed with %s", err)
+		return o, err
+	}
+	vulkanutil.Track(v.Device, o.View)
+
+	// Phase 3: vk.CreateBuffer
+	//			create the readback buffer in host visible memory
+
+	bufferCreateInfo := vk.BufferCreateInfo{
+		SType:       vk.StructureTypeBufferCreateInfo,
+		Size:        vk.DeviceSize(o.byteSize()),
+		Usage:       vk.BufferUsageFlags(vk.BufferUsageTransferDstBit),
+		SharingMode: vk.SharingModeExclusive,
+	}
+	err = vk.Error(vk.CreateBuffer(v.Device, &bufferCreateInfo, nil, &o.readback))
+	if err != nil {
+		o.readback = vk.NullBuffer
+		o.Destroy()
+		err = fmt.Errorf("vk.CreateBuffer failed with %s", err)
+		return o, err
+	}
+	vulkanutil.Track(v.Device, o.readback)
+	vulkanutil.SetObjectName(v.Device, o.readback, "readback buffer")
+	// cached memory is faster to read from, where there is any.
+	o.readbackMemory, err = v.allocator.AllocBuffer(o.readback,
+		vk.MemoryPropertyHostVisibleBit|vk.MemoryPropertyHostCachedBit)
+	if err != nil {
+		o.readbackMemory, err = v.allocator.AllocBuffer(o.readback, vk.MemoryPropertyHostVisibleBit)
+	}
+	if err != nil {
+		o.Destroy()
+		return o, err
+	}
+	return o, nil
+}
+
+func (o *VulkanOffscreenInfo) byteSize() int {
+	return int(o.Size.Width) * int(o.Size.Height) * 4
+}
+
+// CreateFramebuffer wraps the offscreen image into a framebuffer compatible
+// with the render pass of r, adding the depth and multisampled color images
+// when r has those attachments.
+func (o *VulkanOffscreenInfo) CreateFramebuffer(r *VulkanRenderInfo) error {
+	var err error
+	o.targets, err = r.createRenderTargets(o.Size)
+	if err != nil {
+		return err
+	}
+	attachments := o.targets.attachments(o.View)
+	fbCreateInfo := vk.FramebufferCreateInfo{
+		SType:           vk.StructureTypeFramebufferCreateInfo,
+		RenderPass:      r.RenderPass,
+		Layers:          1,
+		AttachmentCount: uint32(len(attachments)),
+		PAttachments:    attachments,
+		Width:           o.Size.Width,
+		Height:          o.Size.Height,
+	}
+	err = vk.Error(vk.CreateFramebuffer(o.device, &fbCreateInfo, nil, &o.Framebuffer))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateFramebuffer failed with %s", err)
+		return err
+	}
+	vulkanutil.Track(o.device, o.Framebuffer)
+	return nil
+}
+
+// RenderOffscreen draws a single frame into the offscreen target,
+// waits for the queue and reads the image back. The renderer must
+// be created with RendererOptions.Offscreen.
+func RenderOffscreen(v *VulkanDeviceInfo, o *VulkanOffscreenInfo,
+	r *VulkanRenderInfo, b *VulkanBufferInfo, gfx *VulkanGfxPipelineInfo) (*image.RGBA, error) {
+
+	if r.finalLayout != vk.ImageLayoutTransferSrcOptimal {
+		err := fmt.Errorf("vulkandraw: the renderer is not created for offscreen rendering")
+		return nil, err
+	}
+
+	// Phase 1: vk.AllocateCommandBuffers
+	//			record the draw followed by a copy into the readback buffer
+
+	cmdBuffers := make([]vk.CommandBuffer, 1)
+	cmdBufferAllocateInfo := vk.CommandBufferAllocateInfo{
+		SType:              vk.StructureTypeCommandBufferAllocateInfo,
+		CommandPool:        r.cmdPool,
+		Level:              vk.CommandBufferLevelPrimary,
+		CommandBufferCount: 1,
+	}
+	err := vk.Error(vk.AllocateCommandBuffers(v.Device, &cmdBufferAllocateInfo, cmdBuffers))
+	if err != nil {
+		err = fmt.Errorf("vk.AllocateCommandBuffers failed with %s", err)
+		return nil, err
+	}
+	defer vk.FreeCommandBuffers(v.Device, r.cmdPool, 1, cmdBuffers)
+	cmd := cmdBuffers[0]
+	vulkanutil.SetObjectName(v.Device, cmd, "offscreen command buffer")
+
+	cmdBufferBeginInfo := vk.CommandBufferBeginInfo{
+		SType: vk.StructureTypeCommandBufferBeginInfo,
+		Flags: vk.CommandBufferUsageFlags(vk.CommandBufferUsageOneTimeSubmitBit),
+	}
+	err = vk.Error(vk.BeginCommandBuffer(cmd, &cmdBufferBeginInfo))
+	if err != nil {
+		err = fmt.Errorf("vk.BeginCommandBuffer failed with %s", err)
+		return nil, err
+	}
+	// the render pass leaves the image ready for the copy.
+	recordDraw(cmd, r, o.Framebuffer, o.Size, b, gfx)
+	regions := []vk.BufferImageCopy{{
+		ImageSubresource: vk.ImageSubresourceLayers{
+			AspectMask: vk.ImageAspectFlags(vk.ImageAspectColorBit),
+			LayerCount: 1,
+		},
+		ImageExtent: vk.Extent3D{
+			Width:  o.Size.Width,
+			Height: o.Size.Height,
+			Depth:  1,
+		},
+	}}
+	vk.CmdCopyImageToBuffer(cmd, o.image, vk.ImageLayoutTransferSrcOptimal, o.readback, 1, regions)
+	// the fence alone does not make the copy visible to the host.
+	readbackBarrier := vk.BufferMemoryBarrier{
+		SType:               vk.StructureTypeBufferMemoryBarrier,
+		SrcAccessMask:       vk.AccessFlags(vk.AccessTransferWriteBit),
+		DstAccessMask:       vk.AccessFlags(vk.AccessHostReadBit),
+		SrcQueueFamilyIndex: vk.QueueFamilyIgnored,
+		DstQueueFamilyIndex: vk.QueueFamilyIgnored,
+		Buffer:              o.readback,
+		Size:                vk.DeviceSize(vk.WholeSize),
+	}
+	vk.CmdPipelineBarrier(cmd,
+		vk.PipelineStageFlags(vk.PipelineStageTransferBit),
+		vk.PipelineStageFlags(vk.PipelineStageHostBit),
+		0, 0, nil, 1, []vk.BufferMemoryBarrier{readbackBarrier}, 0, nil)
+	err = vk.Error(vk.EndCommandBuffer(cmd))
+	if err != nil {
+		err = fmt.Errorf("vk.EndCommandBuffer failed with %s", err)
+		return nil, err
+	}
+
+	// Phase 2: vk.QueueSubmit
+	//			vk.WaitForFences
+
+	var fence vk.Fence
+	fenceCreateInfo := vk.FenceCreateInfo{
+		SType: vk.StructureTypeFenceCreateInfo,
+	}
+	err = vk.Error(vk.CreateFence(v.Device, &fenceCreateInfo, nil, &fence))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateFence failed with %s", err)
+		return nil, err
+	}
+	vulkanutil.Track(v.Device, fence)
+	defer vulkanutil.Destroy(v.Device, fence)
+	submitInfo := []vk.SubmitInfo{{
+		SType:              vk.StructureTypeSubmitInfo,
+		CommandBufferCount: 1,
+		PCommandBuffers:    cmdBuffers,
+	}}
+	err = vk.Error(vk.QueueSubmit(v.Queue, 1, submitInfo, fence))
+	if err != nil {
+		err = fmt.Errorf("vk.QueueSubmit failed with %s", err)
+		return nil, err
+	}
+	const timeoutNano = 10 * 1000 * 1000 * 1000 // 10 sec
+	err = vk.Error(vk.WaitForFences(v.Device, 1, []vk.Fence{fence}, vk.True, timeoutNano))
+	if err != nil {
+		err = fmt.Errorf("vk.WaitForFences failed with %s", err)
+		return nil, err
+	}
+
+	// Phase 3: map the readback memory
+	//			copy the pixels into an image.RGBA
+
+	size := o.byteSize()
+	data, err := v.allocator.Map(o.readbackMemory)
+	if err != nil {
+		return nil, err
+	}
+	defer v.allocator.Unmap(o.readbackMemory)
+	// memory that is not host coherent must be invalidated before the read.
+	if err := v.allocator.Invalidate(o.readbackMemory); err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(image.Rect(0, 0, int(o.Size.Width), int(o.Size.Height)))
+	copy(img.Pix, (*[1 << 30]byte)(data)[:size:size])
+	return img, nil
+}
+
+func (o *VulkanOffscreenInfo) Destroy() {
+	if o == nil {
+		return
+	}
+	vulkanutil.Destroy(o.device, o.Framebuffer)
+	o.targets.destroy()
+	vulkanutil.Destroy(o.device, o.View)
+	vulkanutil.Destroy(o.device, o.image)
+	o.allocator.Free(o.imageMemory)
+	vulkanutil.Destroy(o.device, o.readback)
+	o.allocator.Free(o.readbackMemory)
+	o.imageMemory = vulkanutil.Allocation{}
+	o.readbackMemory = vulkanutil.Allocation{}
+	o.Framebuffer = vk.NullFramebuffer
+	o.View = vk.NullImageView
+}
@@ -0,0 +1,144 @@
+package vulkandraw
+
+import (
+	"fmt"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// QueueFamilies are the queue family indices a device uses for each kind of work.
+// Families a device does not have are set to vk.QueueFamilyIgnored.
+type QueueFamilies struct {
+	Graphics uint32
+	// Present supports presenting to the surface, it equals Graphics
+	// whenever possible and on headless devices.
+	Present uint32
+	// Compute prefers a family without graphics for async compute.
+	Compute uint32
+	// Transfer prefers a dedicated DMA family, it falls back to Graphics.
+	Transfer uint32
+}
+
+// Shared reports whether graphics and present use different families,
+// so images presented must be shared between them.
+func (q QueueFamilies) Shared() bool {
+	return q.Graphics != q.Present
+}
+
+// Unique lists the distinct families, one queue is created from each.
+func (q QueueFamilies) Unique() []uint32 {
+	var families []uint32
+	for _, idx := range []uint32{q.Graphics, q.Present, q.Compute, q.Transfer} {
+		if idx == vk.QueueFamilyIgnored {
+			continue
+		}
+		seen := false
+		for _, f := range families {
+			if f == idx {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			families = append(families, idx)
+		}
+	}
+	return families
+}
+
+// findQueueFamilies inspects the queue families of gpu, the present
+// support is checked with vk.GetPhysicalDeviceSurfaceSupport unless surface is null.
+func findQueueFamilies(gpu vk.PhysicalDevice, surface vk.Surface) (QueueFamilies, error) {
+	q := QueueFamilies{
+		Graphics: vk.QueueFamilyIgnored,
+		Present:  vk.QueueFamilyIgnored,
+		Compute:  vk.QueueFamilyIgnored,
+		Transfer: vk.QueueFamilyIgnored,
+	}
+	var count uint32
+	vk.GetPhysicalDeviceQueueFamilyProperties(gpu, &count, nil)
+	props := make([]vk.QueueFamilyProperties, count)
+	vk.GetPhysicalDeviceQueueFamilyProperties(gpu, &count, props)
+
+	flags := make([]vk.QueueFlags, count)
+	supportsPresent := make([]bool, count)
+	for i := range props {
+		props[i].Deref()
+		if props[i].QueueCount == 0 {
+			continue
+		}
+		flags[i] = props[i].QueueFlags
+		if surface != vk.NullSurface {
+			var supported vk.Bool32
+			err := vk.Error(vk.GetPhysicalDeviceSurfaceSupport(gpu, uint32(i), surface, &supported))
+			if err != nil {
+				err = fmt.Errorf("vk.GetPhysicalDeviceSurfaceSupport failed with %s", err)
+				return q, err
+			}
+			supportsPresent[i] = supported == vk.True
+		}
+	}
+	has := func(i int, bit vk.QueueFlagBits) bool {
+		return flags[i]&vk.QueueFlags(bit) != 0
+	}
+
+	// Graphics and present: one family doing both is preferred.
+	for i := range flags {
+		if !has(i, vk.QueueGraphicsBit) {
+			continue
+		}
+		if q.Graphics == vk.QueueFamilyIgnored {
+			q.Graphics = uint32(i)
+		}
+		if supportsPresent[i] {
+			q.Graphics = uint32(i)
+			q.Present = uint32(i)
+			break
+		}
+	}
+	if q.Graphics == vk.QueueFamilyIgnored {
+		return q, fmt.Errorf("vulkandraw: no queue family supports graphics")
+	}
+	if surface == vk.NullSurface {
+		q.Present = q.Graphics
+	} else if q.Present == vk.QueueFamilyIgnored {
+		for i := range supportsPresent {
+			if supportsPresent[i] {
+				q.Present = uint32(i)
+				break
+			}
+		}
+		if q.Present == vk.QueueFamilyIgnored {
+			return q, fmt.Errorf("vulkandraw: no queue family can present to the surface")
+		}
+	}
+
+	// Compute: a family without graphics first, then any with compute.
+	for i := range flags {
+		if has(i, vk.QueueComputeBit) && !has(i, vk.QueueGraphicsBit) {
+			q.Compute = uint32(i)
+			break
+		}
+	}
+	if q.Compute == vk.QueueFamilyIgnored && has(int(q.Graphics), vk.QueueComputeBit) {
+		q.Compute = q.Graphics
+	}
+	if q.Compute == vk.QueueFamilyIgnored {
+		for i := range flags {
+			if has(i, vk.QueueComputeBit) {
+				q.Compute = uint32(i)
+				break
+			}
+		}
+	}
+
+	// Transfer: a transfer only family first, graphics always can transfer.
+	q.Transfer = q.Graphics
+	for i := range flags {
+		if has(i, vk.QueueTransferBit) && !has(i, vk.QueueGraphicsBit) && !has(i, vk.QueueComputeBit) {
+			q.Transfer = uint32(i)
+			break
+		}
+	}
+	return q, nil
+}
@@ -0,0 +1,161 @@
+package vulkandraw
+
+import (
+	"fmt"
+
+	"github.com/vulkan-go/demos/vulkanutil"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// createDeviceLocalBuffer creates a buffer in device local memory and
+// fills it with data through a host visible staging buffer.
+func (v *VulkanDeviceInfo) createDeviceLocalBuffer(usage vk.BufferUsageFlagBits,
+	data []byte) (vk.Buffer, vulkanutil.Allocation, error) {
+
+	var buffer vk.Buffer
+	var memory vulkanutil.Allocation
+
+	// Phase 1: vk.CreateBuffer
+	//			create the staging buffer with the data
+
+	staging, stagingMemory, err := v.createHostBuffer(vk.BufferUsageTransferSrcBit, data)
+	if err != nil {
+		return buffer, memory, err
+	}
+	defer v.allocator.Free(stagingMemory)
+	defer vulkanutil.Destroy(v.Device, staging)
+
+	// Phase 2: vk.CreateBuffer
+	//			create the destination buffer in device local memory
+
+	bufferCreateInfo := vk.BufferCreateInfo{
+		SType:       vk.StructureTypeBufferCreateInfo,
+		Size:        vk.DeviceSize(len(data)),
+		Usage:       vk.BufferUsageFlags(usage | vk.BufferUsageTransferDstBit),
+		SharingMode: vk.SharingModeExclusive,
+	}
+	transferFamily, transferQueue := v.Families.Graphics, v.Queue
+	if v.TransferQueue != nil && v.Families.Transfer != v.Families.Graphics {
+		// the copy runs on the transfer queue, the draws on the graphics one.
+		transferFamily, transferQueue = v.Families.Transfer, v.TransferQueue
+		bufferCreateInfo.SharingMode = vk.SharingModeConcurrent
+		bufferCreateInfo.QueueFamilyIndexCount = 2
+		bufferCreateInfo.PQueueFamilyIndices = []uint32{v.Families.Graphics, v.Families.Transfer}
+	}
+	err = vk.Error(vk.CreateBuffer(v.Device, &bufferCreateInfo, nil, &buffer))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateBuffer failed with %s", err)
+		return buffer, memory, err
+	}
+	vulkanutil.Track(v.Device, buffer)
+	vulkanutil.SetObjectName(v.Device, buffer, bufferName(usage))
+	memory, err = v.allocator.AllocBuffer(buffer, vk.MemoryPropertyDeviceLocalBit)
+	if err != nil {
+		vulkanutil.Destroy(v.Device, buffer)
+		return vk.NullBuffer, memory, err
+	}
+
+	// Phase 3: vk.CmdCopyBuffer
+	//			copy from the staging buffer and wait for it
+
+	err = v.submitOneShot(transferFamily, transferQueue, func(cmd vk.CommandBuffer) {
+		regions := []vk.BufferCopy{{
+			Size: vk.DeviceSize(len(data)),
+		}}
+		vk.CmdCopyBuffer(cmd, staging, buffer, 1, regions)
+	})
+	if err != nil {
+		vulkanutil.Destroy(v.Device, buffer)
+		v.allocator.Free(memory)
+		return vk.NullBuffer, vulkanutil.Allocation{}, err
+	}
+	return buffer, memory, nil
+}
+
+// submitOneShot records commands with record into a transient command buffer
+// of the queue family, submits it to queue and waits until it has completed.
+func (v *VulkanDeviceInfo) submitOneShot(family uint32, queue vk.Queue,
+	record func(cmd vk.CommandBuffer)) error {
+
+	// Phase 1: vk.CreateCommandPool
+	//			vk.AllocateCommandBuffers
+
+	var cmdPool vk.CommandPool
+	cmdPoolCreateInfo := vk.CommandPoolCreateInfo{
+		SType:            vk.StructureTypeCommandPoolCreateInfo,
+		Flags:            vk.CommandPoolCreateFlags(vk.CommandPoolCreateTransientBit),
+		QueueFamilyIndex: family,
+	}
+	err := vk.Error(vk.CreateCommandPool(v.Device, &cmdPoolCreateInfo, nil, &cmdPool))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateCommandPool failed with %s", err)
+		return err
+	}
+	vulkanutil.Track(v.Device, cmdPool)
+	defer vulkanutil.Destroy(v.Device, cmdPool)
+
+	cmdBuffers := make([]vk.CommandBuffer, 1)
+	cmdBufferAllocateInfo := vk.CommandBufferAllocateInfo{
+		SType:              vk.StructureTypeCommandBufferAllocateInfo,
+		CommandPool:        cmdPool,
+		Level:              vk.CommandBufferLevelPrimary,
+		CommandBufferCount: 1,
+	}
+	err = vk.Error(vk.AllocateCommandBuffers(v.Device, &cmdBufferAllocateInfo, cmdBuffers))
+	if err != nil {
+		err = fmt.Errorf("vk.AllocateCommandBuffers failed with %s", err)
+		return err
+	}
+	vulkanutil.SetObjectName(v.Device, cmdBuffers[0], "one-shot command buffer")
+
+	// Phase 2: vk.BeginCommandBuffer
+	//			vk.EndCommandBuffer
+
+	cmdBufferBeginInfo := vk.CommandBufferBeginInfo{
+		SType: vk.StructureTypeCommandBufferBeginInfo,
+		Flags: vk.CommandBufferUsageFlags(vk.CommandBufferUsageOneTimeSubmitBit),
+	}
+	err = vk.Error(vk.BeginCommandBuffer(cmdBuffers[0], &cmdBufferBeginInfo))
+	if err != nil {
+		err = fmt.Errorf("vk.BeginCommandBuffer failed with %s", err)
+		return err
+	}
+	record(cmdBuffers[0])
+	err = vk.Error(vk.EndCommandBuffer(cmdBuffers[0]))
+	if err != nil {
+		err = fmt.Errorf("vk.EndCommandBuffer failed with %s", err)
+		return err
+	}
+
+	// Phase 3: vk.QueueSubmit
+	//			vk.WaitForFences
+
+	var fence vk.Fence
+	fenceCreateInfo := vk.FenceCreateInfo{
+		SType: vk.StructureTypeFenceCreateInfo,
+	}
+	err = vk.Error(vk.CreateFence(v.Device, &fenceCreateInfo, nil, &fence))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateFence failed with %s", err)
+		return err
+	}
+	vulkanutil.Track(v.Device, fence)
+	defer vulkanutil.Destroy(v.Device, fence)
+
+	submitInfo := []vk.SubmitInfo{{
+		SType:              vk.StructureTypeSubmitInfo,
+		CommandBufferCount: 1,
+		PCommandBuffers:    cmdBuffers,
+	}}
+	err = vk.Error(vk.QueueSubmit(queue, 1, submitInfo, fence))
+	if err != nil {
+		err = fmt.Errorf("vk.QueueSubmit failed with %s", err)
+		return err
+	}
+	err = vk.Error(vk.WaitForFences(v.Device, 1, []vk.Fence{fence}, vk.True, vk.MaxUint64))
+	if err != nil {
+		err = fmt.Errorf("vk.WaitForFences failed with %s", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package vulkandraw
+
+import (
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// SurfaceFormat is a format and colorspace pair of a swapchain image.
+type SurfaceFormat struct {
+	Format     vk.Format
+	ColorSpace vk.ColorSpace
+}
+
+// SwapchainOptions configure CreateSwapchain. Every option falls back to
+// what the surface supports, so the zero value is always usable.
+type SwapchainOptions struct {
+	// PresentModes in order of preference, e.g. mailbox, immediate or
+	// fifo-relaxed. FIFO is used when none of them is supported.
+	PresentModes []vk.PresentMode
+	// ImageCount is the desired number of swapchain images, it is clamped
+	// to the surface limits. Zero asks for one more than the minimum.
+	ImageCount uint32
+	// Formats in order of preference. When none is supported a surface
+	// format with the same vk.Format is taken regardless of its colorspace,
+	// and at last the first format of the surface.
+	// Empty means B8G8R8A8 or R8G8B8A8 UNORM, see DefaultSurfaceFormats.
+	Formats []SurfaceFormat
+	// CompositeAlpha is used if supported, otherwise the first supported of
+	// opaque, inherit, pre-multiplied and post-multiplied is chosen.
+	CompositeAlpha vk.CompositeAlphaFlagBits
+	// PreTransform is used if supported. Zero and unsupported transforms
+	// give identity if possible and the current transform of the surface otherwise.
+	PreTransform vk.SurfaceTransformFlagBits
+	// FramebufferSize reports the size of the window in pixels. It is asked
+	// when the surface leaves the extent to the swapchain, e.g. on Wayland,
+	// and the result is clamped to the surface limits.
+	FramebufferSize func() (width, height int)
+}
+
+// DefaultSurfaceFormats are the formats picked when SwapchainOptions has none.
+var DefaultSurfaceFormats = []SurfaceFormat{
+	{Format: vk.FormatB8g8r8a8Unorm, ColorSpace: vk.ColorSpaceSrgbNonlinear},
+	{Format: vk.FormatR8g8b8a8Unorm, ColorSpace: vk.ColorSpaceSrgbNonlinear},
+}
+
+// SRGBSurfaceFormats prefer sRGB formats so the presentation engine applies
+// the gamma curve, with the UNORM ones as a fallback.
+var SRGBSurfaceFormats = []SurfaceFormat{
+	{Format: vk.FormatB8g8r8a8Srgb, ColorSpace: vk.ColorSpaceSrgbNonlinear},
+	{Format: vk.FormatR8g8b8a8Srgb, ColorSpace: vk.ColorSpaceSrgbNonlinear},
+	{Format: vk.FormatB8g8r8a8Unorm, ColorSpace: vk.ColorSpaceSrgbNonlinear},
+	{Format: vk.FormatR8g8b8a8Unorm, ColorSpace: vk.ColorSpaceSrgbNonlinear},
+}
+
+func (opt *SwapchainOptions) chooseFormat(available []SurfaceFormat) (SurfaceFormat, bool) {
+	preferred := opt.Formats
+	if len(preferred) == 0 {
+		preferred = DefaultSurfaceFormats
+	}
+	if len(available) == 0 {
+		return SurfaceFormat{}, false
+	}
+	// a single undefined format means the surface has no preference.
+	if len(available) == 1 && available[0].Format == vk.FormatUndefined {
+		return preferred[0], true
+	}
+	for _, want := range preferred {
+		for _, f := range available {
+			if f == want {
+				return f, true
+			}
+		}
+	}
+	for _, want := range preferred {
+		for _, f := range available {
+			if f.Format == want.Format {
+				return f, true
+			}
+		}
+	}
+	return available[0], true
+}
+
+func (opt *SwapchainOptions) choosePresentMode(available []vk.PresentMode) vk.PresentMode {
+	for _, want := range opt.PresentModes {
+		for _, mode := range available {
+			if mode == want {
+				return mode
+			}
+		}
+	}
+	// FIFO support is required by the spec.
+	return vk.PresentModeFifo
+}
+
+func (opt *SwapchainOptions) chooseImageCount(caps *vk.SurfaceCapabilities) uint32 {
+	count := opt.ImageCount
+	if count == 0 {
+		count = caps.MinImageCount + 1
+	}
+	if count < caps.MinImageCount {
+		count = caps.MinImageCount
+	}
+	// zero MaxImageCount means there is no limit.
+	if caps.MaxImageCount > 0 && count > caps.MaxImageCount {
+		count = caps.MaxImageCount
+	}
+	return count
+}
+
+func (opt *SwapchainOptions) chooseCompositeAlpha(supported vk.CompositeAlphaFlags) vk.CompositeAlphaFlagBits {
+	if opt.CompositeAlpha != 0 && supported&vk.CompositeAlphaFlags(opt.CompositeAlpha) != 0 {
+		return opt.CompositeAlpha
+	}
+	for _, alpha := range []vk.CompositeAlphaFlagBits{
+		vk.CompositeAlphaOpaqueBit,
+		vk.CompositeAlphaInheritBit,
+		vk.CompositeAlphaPreMultipliedBit,
+		vk.CompositeAlphaPostMultipliedBit,
+	} {
+		if supported&vk.CompositeAlphaFlags(alpha) != 0 {
+			return alpha
+		}
+	}
+	return vk.CompositeAlphaOpaqueBit
+}
+
+func (opt *SwapchainOptions) choosePreTransform(caps *vk.SurfaceCapabilities) vk.SurfaceTransformFlagBits {
+	supported := caps.SupportedTransforms
+	if opt.PreTransform != 0 && supported&vk.SurfaceTransformFlags(opt.PreTransform) != 0 {
+		return opt.PreTransform
+	}
+	if supported&vk.SurfaceTransformFlags(vk.SurfaceTransformIdentityBit) != 0 {
+		return vk.SurfaceTransformIdentityBit
+	}
+	return caps.CurrentTransform
+}
+
+// undefinedExtent is the current extent of a surface whose size is
+// determined by the extent of the swapchain.
+const undefinedExtent = 0xFFFFFFFF
+
+func (opt *SwapchainOptions) chooseExtent(caps *vk.SurfaceCapabilities) vk.Extent2D {
+	if caps.CurrentExtent.Width != undefinedExtent {
+		return caps.CurrentExtent
+	}
+	var width, height int
+	if opt.FramebufferSize != nil {
+		width, height = opt.FramebufferSize()
+	}
+	if width <= 0 || height <= 0 {
+		// a minimized window, the swapchain can't be created now.
+		return vk.Extent2D{}
+	}
+	return vk.Extent2D{
+		Width:  clampUint32(uint32(width), caps.MinImageExtent.Width, caps.MaxImageExtent.Width),
+		Height: clampUint32(uint32(height), caps.MinImageExtent.Height, caps.MaxImageExtent.Height),
+	}
+}
+
+func clampUint32(v, min, max uint32) uint32 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
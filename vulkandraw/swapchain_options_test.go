@@ -0,0 +1,158 @@
+package vulkandraw
+
+import (
+	"testing"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+func TestChooseFormat(t *testing.T) {
+	var (
+		bgraUnorm = SurfaceFormat{vk.FormatB8g8r8a8Unorm, vk.ColorSpaceSrgbNonlinear}
+		rgbaUnorm = SurfaceFormat{vk.FormatR8g8b8a8Unorm, vk.ColorSpaceSrgbNonlinear}
+		bgraSrgb  = SurfaceFormat{vk.FormatB8g8r8a8Srgb, vk.ColorSpaceSrgbNonlinear}
+		bgraP3    = SurfaceFormat{vk.FormatB8g8r8a8Unorm, vk.ColorSpaceDisplayP3Nonlinear}
+		rgbaP3    = SurfaceFormat{vk.FormatR8g8b8a8Unorm, vk.ColorSpaceDisplayP3Nonlinear}
+		undefined = SurfaceFormat{vk.FormatUndefined, vk.ColorSpaceSrgbNonlinear}
+	)
+	cases := []struct {
+		name      string
+		preferred []SurfaceFormat
+		available []SurfaceFormat
+		want      SurfaceFormat
+		ok        bool
+	}{
+		{"none available", nil, nil, SurfaceFormat{}, false},
+		{"no preference of the surface", nil, []SurfaceFormat{undefined}, bgraUnorm, true},
+		{"no preference of the surface, preferred", SRGBSurfaceFormats, []SurfaceFormat{undefined}, bgraSrgb, true},
+		{"default", nil, []SurfaceFormat{rgbaUnorm, bgraUnorm}, bgraUnorm, true},
+		{"preferred", SRGBSurfaceFormats, []SurfaceFormat{bgraUnorm, bgraSrgb}, bgraSrgb, true},
+		{"preferred not supported", SRGBSurfaceFormats, []SurfaceFormat{rgbaUnorm}, rgbaUnorm, true},
+		// an exact match wins over a format in another colorspace.
+		{"exact match first", nil, []SurfaceFormat{bgraP3, rgbaUnorm}, rgbaUnorm, true},
+		{"other colorspace", nil, []SurfaceFormat{rgbaP3, bgraP3}, bgraP3, true},
+		{"first available", []SurfaceFormat{bgraSrgb}, []SurfaceFormat{rgbaP3, bgraUnorm}, rgbaP3, true},
+	}
+	for _, c := range cases {
+		opt := SwapchainOptions{Formats: c.preferred}
+		got, ok := opt.chooseFormat(c.available)
+		if got != c.want || ok != c.ok {
+			t.Errorf("%s: chooseFormat = %v, %v, want %v, %v", c.name, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestChoosePresentMode(t *testing.T) {
+	cases := []struct {
+		name      string
+		preferred []vk.PresentMode
+		available []vk.PresentMode
+		want      vk.PresentMode
+	}{
+		{"default", nil, []vk.PresentMode{vk.PresentModeMailbox, vk.PresentModeFifo}, vk.PresentModeFifo},
+		{"preferred", []vk.PresentMode{vk.PresentModeMailbox},
+			[]vk.PresentMode{vk.PresentModeImmediate, vk.PresentModeMailbox, vk.PresentModeFifo}, vk.PresentModeMailbox},
+		{"in order of preference", []vk.PresentMode{vk.PresentModeMailbox, vk.PresentModeImmediate},
+			[]vk.PresentMode{vk.PresentModeImmediate, vk.PresentModeMailbox}, vk.PresentModeMailbox},
+		{"second preference", []vk.PresentMode{vk.PresentModeMailbox, vk.PresentModeImmediate},
+			[]vk.PresentMode{vk.PresentModeFifo, vk.PresentModeImmediate}, vk.PresentModeImmediate},
+		{"not supported", []vk.PresentMode{vk.PresentModeMailbox, vk.PresentModeFifoRelaxed},
+			[]vk.PresentMode{vk.PresentModeFifo}, vk.PresentModeFifo},
+		{"nothing reported", []vk.PresentMode{vk.PresentModeMailbox}, nil, vk.PresentModeFifo},
+	}
+	for _, c := range cases {
+		opt := SwapchainOptions{PresentModes: c.preferred}
+		if got := opt.choosePresentMode(c.available); got != c.want {
+			t.Errorf("%s: choosePresentMode = %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestChooseImageCount(t *testing.T) {
+	cases := []struct {
+		name     string
+		count    uint32
+		min, max uint32
+		want     uint32
+	}{
+		{"default", 0, 2, 8, 3},
+		{"default at the limit", 0, 2, 2, 2},
+		{"default without limit", 0, 3, 0, 4},
+		{"requested", 3, 2, 8, 3},
+		{"below the minimum", 1, 2, 8, 2},
+		{"above the maximum", 16, 2, 8, 8},
+		{"without limit", 16, 2, 0, 16},
+	}
+	for _, c := range cases {
+		opt := SwapchainOptions{ImageCount: c.count}
+		caps := vk.SurfaceCapabilities{MinImageCount: c.min, MaxImageCount: c.max}
+		if got := opt.chooseImageCount(&caps); got != c.want {
+			t.Errorf("%s: chooseImageCount = %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestChooseCompositeAlpha(t *testing.T) {
+	cases := []struct {
+		name      string
+		preferred vk.CompositeAlphaFlagBits
+		supported vk.CompositeAlphaFlagBits
+		want      vk.CompositeAlphaFlagBits
+	}{
+		{"default", 0, vk.CompositeAlphaOpaqueBit | vk.CompositeAlphaInheritBit, vk.CompositeAlphaOpaqueBit},
+		{"preferred", vk.CompositeAlphaPreMultipliedBit,
+			vk.CompositeAlphaOpaqueBit | vk.CompositeAlphaPreMultipliedBit, vk.CompositeAlphaPreMultipliedBit},
+		{"preferred not supported", vk.CompositeAlphaPostMultipliedBit,
+			vk.CompositeAlphaOpaqueBit | vk.CompositeAlphaPreMultipliedBit, vk.CompositeAlphaOpaqueBit},
+		{"inherit before pre-multiplied", 0,
+			vk.CompositeAlphaPreMultipliedBit | vk.CompositeAlphaInheritBit, vk.CompositeAlphaInheritBit},
+		{"pre-multiplied before post-multiplied", 0,
+			vk.CompositeAlphaPostMultipliedBit | vk.CompositeAlphaPreMultipliedBit, vk.CompositeAlphaPreMultipliedBit},
+		{"post-multiplied only", vk.CompositeAlphaOpaqueBit,
+			vk.CompositeAlphaPostMultipliedBit, vk.CompositeAlphaPostMultipliedBit},
+		{"nothing reported", 0, 0, vk.CompositeAlphaOpaqueBit},
+	}
+	for _, c := range cases {
+		opt := SwapchainOptions{CompositeAlpha: c.preferred}
+		if got := opt.chooseCompositeAlpha(vk.CompositeAlphaFlags(c.supported)); got != c.want {
+			t.Errorf("%s: chooseCompositeAlpha = %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestChooseExtent(t *testing.T) {
+	limits := vk.SurfaceCapabilities{
+		CurrentExtent:  vk.Extent2D{Width: undefinedExtent, Height: undefinedExtent},
+		MinImageExtent: vk.Extent2D{Width: 16, Height: 16},
+		MaxImageExtent: vk.Extent2D{Width: 4096, Height: 2048},
+	}
+	cases := []struct {
+		name          string
+		current       vk.Extent2D
+		width, height int
+		want          vk.Extent2D
+	}{
+		{"current", vk.Extent2D{Width: 640, Height: 480}, 800, 600, vk.Extent2D{Width: 640, Height: 480}},
+		{"minimized", vk.Extent2D{}, 800, 600, vk.Extent2D{}},
+		{"window", limits.CurrentExtent, 800, 600, vk.Extent2D{Width: 800, Height: 600}},
+		{"window too small", limits.CurrentExtent, 8, 600, vk.Extent2D{Width: 16, Height: 600}},
+		{"window too large", limits.CurrentExtent, 5000, 3000, vk.Extent2D{Width: 4096, Height: 2048}},
+		{"window minimized", limits.CurrentExtent, 0, 0, vk.Extent2D{}},
+	}
+	for _, c := range cases {
+		caps := limits
+		caps.CurrentExtent = c.current
+		width, height := c.width, c.height
+		opt := SwapchainOptions{
+			FramebufferSize: func() (int, int) { return width, height },
+		}
+		if got := opt.chooseExtent(&caps); got != c.want {
+			t.Errorf("%s: chooseExtent = %v, want %v", c.name, got, c.want)
+		}
+	}
+	caps := limits
+	var opt SwapchainOptions
+	if got := opt.chooseExtent(&caps); got != (vk.Extent2D{}) {
+		t.Errorf("chooseExtent without the window size = %v, want none", got)
+	}
+}
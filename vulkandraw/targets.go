@@ -0,0 +1,146 @@
+package vulkandraw
+
+import (
+	"fmt"
+
+	"github.com/vulkan-go/demos/vulkanutil"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// attachmentImage is an image only the render pass uses, with its view.
+type attachmentImage struct {
+	device    vk.Device
+	allocator *vulkanutil.Allocator
+
+	image  vk.Image
+	memory vulkanutil.Allocation
+	view   vk.ImageView
+}
+
+// renderTargets are the images a framebuffer needs besides the one it
+// presents or reads back: the depth buffer and the multisampled color image.
+// Those the render pass has no attachment for are empty.
+type renderTargets struct {
+	depth attachmentImage
+	color attachmentImage
+}
+
+// createRenderTargets creates the depth and multisampled color images
+// of the given size that the render pass of r needs.
+func (r *VulkanRenderInfo) createRenderTargets(size vk.Extent2D) (renderTargets, error) {
+	var t renderTargets
+	var err error
+	t.depth, err = r.createDepthImage(size)
+	if err != nil {
+		return t, err
+	}
+	if r.Samples != vk.SampleCount1Bit {
+		// only resolved, never stored, so the image can stay in tile memory.
+		t.color, err = r.createAttachmentImage("multisampled color image", r.colorFormat, size,
+			vk.ImageUsageColorAttachmentBit|vk.ImageUsageTransientAttachmentBit,
+			vk.ImageAspectFlags(vk.ImageAspectColorBit))
+		if err != nil {
+			t.destroy()
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+// attachments lists view and the render targets in the attachment
+// order of the render pass, see CreateRenderer.
+func (t *renderTargets) attachments(view vk.ImageView) []vk.ImageView {
+	attachments := []vk.ImageView{view}
+	if t.depth.view != vk.NullImageView {
+		attachments = append(attachments, t.depth.view)
+	}
+	if t.color.view != vk.NullImageView {
+		attachments = append(attachments, t.color.view)
+	}
+	return attachments
+}
+
+func (t *renderTargets) destroy() {
+	t.depth.destroy()
+	t.color.destroy()
+}
+
+// createAttachmentImage creates an image with its view, name is shown
+// for both in the validation messages.
+func (r *VulkanRenderInfo) createAttachmentImage(name string, format vk.Format, size vk.Extent2D,
+	usage vk.ImageUsageFlagBits, aspect vk.ImageAspectFlags) (attachmentImage, error) {
+
+	a := attachmentImage{
+		device:    r.device,
+		allocator: r.allocator,
+	}
+
+	// Phase 1: vk.CreateImage
+	//			create the image in device local memory
+
+	imageCreateInfo := vk.ImageCreateInfo{
+		SType:     vk.StructureTypeImageCreateInfo,
+		ImageType: vk.ImageType2d,
+		Format:    format,
+		Extent: vk.Extent3D{
+			Width:  size.Width,
+			Height: size.Height,
+			Depth:  1,
+		},
+		MipLevels:     1,
+		ArrayLayers:   1,
+		Samples:       r.Samples,
+		Tiling:        vk.ImageTilingOptimal,
+		Usage:         vk.ImageUsageFlags(usage),
+		SharingMode:   vk.SharingModeExclusive,
+		InitialLayout: vk.ImageLayoutUndefined,
+	}
+	err := vk.Error(vk.CreateImage(a.device, &imageCreateInfo, nil, &a.image))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateImage failed with %s", err)
+		return a, err
+	}
+	vulkanutil.Track(a.device, a.image)
+	vulkanutil.SetObjectName(a.device, a.image, name)
+	a.memory, err = a.allocator.AllocImage(a.image, vk.ImageTilingOptimal, vk.MemoryPropertyDeviceLocalBit)
+	if err != nil {
+		a.destroy()
+		return a, err
+	}
+
+	// Phase 2: vk.CreateImageView
+
+	viewCreateInfo := vk.ImageViewCreateInfo{
+		SType:    vk.StructureTypeImageViewCreateInfo,
+		Image:    a.image,
+		ViewType: vk.ImageViewType2d,
+		Format:   format,
+		SubresourceRange: vk.ImageSubresourceRange{
+			AspectMask: aspect,
+			LevelCount: 1,
+			LayerCount: 1,
+		},
+	}
+	err = vk.Error(vk.CreateImageView(a.device, &viewCreateInfo, nil, &a.view))
+	if err != nil {
+		a.view = vk.NullImageView // undefined after a failed create
+		a.destroy()
+		err = fmt.Errorf("vk.CreateImageView failed with %s", err)
+		return a, err
+	}
+	vulkanutil.Track(a.device, a.view)
+	vulkanutil.SetObjectName(a.device, a.view, name+" view")
+	return a, nil
+}
+
+func (a *attachmentImage) destroy() {
+	if a.image == vk.NullImage {
+		return
+	}
+	vulkanutil.Destroy(a.device, a.view)
+	vulkanutil.Destroy(a.device, a.image)
+	a.allocator.Free(a.memory)
+	a.view = vk.NullImageView
+	a.image = vk.NullImage
+	a.memory = vulkanutil.Allocation{}
+}
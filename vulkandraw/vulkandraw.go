@@ -3,27 +3,50 @@ package vulkandraw
 import (
 	"fmt"
 	"log"
+	"strings"
 	"unsafe"
 
+	"github.com/vulkan-go/demos/vulkanutil"
 	vk "github.com/vulkan-go/vulkan"
-	"github.com/xlab/linmath"
 )
 
-// enableDebug is disabled by default since VK_EXT_debug_report
-// is not guaranteed to be present on a device.
-//
-// Nvidia Shield K1 fw 1.3.0 lacks this extension,
-// on fw 1.2.0 it works fine.
-const enableDebug = false
+// Validation enables the validation layer and the debug report callback in
+// NewVulkanDevice, as far as they are available. It is off unless the
+// vulkanutil.ValidationEnv environment variable is set.
+var Validation = vulkanutil.ValidationRequested()
+
+// DebugMessages selects the validation messages logged when the instance
+// supports VK_EXT_debug_utils, the older VK_EXT_debug_report callback
+// logs the warnings and errors.
+var DebugMessages = vulkanutil.DefaultDebugMessageFilter
 
 type VulkanDeviceInfo struct {
 	gpuDevices []vk.PhysicalDevice
+	gpu        vk.PhysicalDevice
+
+	dbg          vk.DebugReportCallback
+	dbgMessenger vk.DebugUtilsMessenger
+	Instance     vk.Instance
+	Surface      vk.Surface
+	Device       vk.Device
+
+	Families QueueFamilies
+	// Queue is the graphics queue, the others may be the same queue
+	// when their families match.
+	Queue         vk.Queue
+	PresentQueue  vk.Queue
+	ComputeQueue  vk.Queue
+	TransferQueue vk.Queue
+
+	// allocator sub-allocates the memory of all buffers and images.
+	allocator *vulkanutil.Allocator
+	// tracker reports the objects left when the device is destroyed.
+	tracker *vulkanutil.Tracker
+}
 
-	dbg      vk.DebugReportCallback
-	Instance vk.Instance
-	Surface  vk.Surface
-	Queue    vk.Queue
-	Device   vk.Device
+// MemoryStats reports the device memory held by the allocator.
+func (v *VulkanDeviceInfo) MemoryStats() vulkanutil.MemoryStats {
+	return v.allocator.Stats()
 }
 
 type VulkanSwapchainInfo struct {
@@ -37,6 +60,10 @@ type VulkanSwapchainInfo struct {
 
 	Framebuffers []vk.Framebuffer
 	DisplayViews []vk.ImageView
+
+	// options are used again when recreating.
+	options SwapchainOptions
+	targets renderTargets
 }
 
 func (v *VulkanSwapchainInfo) DefaultSwapchain() vk.Swapchain {
@@ -47,9 +74,21 @@ func (v *VulkanSwapchainInfo) DefaultSwapchainLen() uint32 {
 	return v.SwapchainLen[0]
 }
 
+// VulkanBufferInfo holds the buffers of a mesh, see CreateMesh.
 type VulkanBufferInfo struct {
 	device        vk.Device
+	allocator     *vulkanutil.Allocator
 	vertexBuffers []vk.Buffer
+	indexBuffer   vk.Buffer
+	indexType     vk.IndexType
+	memory        []vulkanutil.Allocation
+
+	// Layout is the vertex layout the pipeline must be created with.
+	Layout VertexLayout
+	// VertexCount is drawn when the mesh has no indices.
+	VertexCount uint32
+	// IndexCount is the number of indices, zero if there are none.
+	IndexCount uint32
 }
 
 func (v *VulkanBufferInfo) DefaultVertexBuffer() vk.Buffer {
@@ -64,129 +103,278 @@ type VulkanGfxPipelineInfo struct {
 	pipeline vk.Pipeline
 }
 
+// MaxFramesInFlight is the number of frames the CPU may record and submit
+// before waiting for the GPU to finish the oldest one.
+const MaxFramesInFlight = 2
+
 type VulkanRenderInfo struct {
-	device vk.Device
+	device    vk.Device
+	allocator *vulkanutil.Allocator
 
 	RenderPass vk.RenderPass
+	// DepthFormat is the format of the depth attachment,
+	// vk.FormatUndefined when the render pass has none.
+	DepthFormat vk.Format
+	// Samples is the sample count of the depth and multisampled color
+	// attachments, see RendererOptions.
+	Samples     vk.SampleCountFlagBits
+	colorFormat vk.Format
+	// finalLayout is the layout the target image is left in.
+	finalLayout vk.ImageLayout
+
 	cmdPool    vk.CommandPool
 	cmdBuffers []vk.CommandBuffer
-	semaphores []vk.Semaphore
-	fences     []vk.Fence
+
+	// per frame in flight
+	imageAvailable []vk.Semaphore
+	fences         []vk.Fence
+	frame          int
+
+	// per swapchain image, a present holds on to the semaphore
+	// until the image is acquired again.
+	renderFinished []vk.Semaphore
+	// fence of the frame that last rendered into each swapchain image
+	imageFences []vk.Fence
 }
 
+// DefaultFence returns the fence of the current frame in flight.
 func (v *VulkanRenderInfo) DefaultFence() vk.Fence {
-	return v.fences[0]
+	return v.fences[v.frame]
 }
 
+// DefaultSemaphore returns the image available semaphore
+// of the current frame in flight.
 func (v *VulkanRenderInfo) DefaultSemaphore() vk.Semaphore {
-	return v.semaphores[0]
+	return v.imageAvailable[v.frame]
 }
 
 func VulkanInit(v *VulkanDeviceInfo, s *VulkanSwapchainInfo,
 	r *VulkanRenderInfo, b *VulkanBufferInfo, gfx *VulkanGfxPipelineInfo) {
 
-	clearValues := []vk.ClearValue{
-		vk.NewClearValue([]float32{0.098, 0.71, 0.996, 1}),
+	recordCommandBuffers(s, r, b, gfx)
+	// fences start signaled, so the first wait on each frame returns at once.
+	fenceCreateInfo := vk.FenceCreateInfo{
+		SType: vk.StructureTypeFenceCreateInfo,
+		Flags: vk.FenceCreateFlags(vk.FenceCreateSignaledBit),
+	}
+	semaphoreCreateInfo := vk.SemaphoreCreateInfo{
+		SType: vk.StructureTypeSemaphoreCreateInfo,
+	}
+	r.fences = make([]vk.Fence, MaxFramesInFlight)
+	r.imageAvailable = make([]vk.Semaphore, MaxFramesInFlight)
+	for i := 0; i < MaxFramesInFlight; i++ {
+		// failed creates leave null handles, which are neither tracked nor destroyed.
+		ret := vk.CreateFence(v.Device, &fenceCreateInfo, nil, &r.fences[i])
+		if check(ret, "vk.CreateFence") {
+			r.fences[i] = vk.NullFence
+		}
+		ret = vk.CreateSemaphore(v.Device, &semaphoreCreateInfo, nil, &r.imageAvailable[i])
+		if check(ret, "vk.CreateSemaphore") {
+			r.imageAvailable[i] = vk.NullSemaphore
+		}
+		vulkanutil.Track(v.Device, r.fences[i], r.imageAvailable[i])
+	}
+	r.createImageSyncObjects()
+	r.frame = 0
+}
+
+// createImageSyncObjects creates the render finished semaphore
+// of each swapchain image, one per command buffer.
+func (r *VulkanRenderInfo) createImageSyncObjects() {
+	semaphoreCreateInfo := vk.SemaphoreCreateInfo{
+		SType: vk.StructureTypeSemaphoreCreateInfo,
+	}
+	r.renderFinished = make([]vk.Semaphore, len(r.cmdBuffers))
+	for i := range r.renderFinished {
+		ret := vk.CreateSemaphore(r.device, &semaphoreCreateInfo, nil, &r.renderFinished[i])
+		if check(ret, "vk.CreateSemaphore") {
+			r.renderFinished[i] = vk.NullSemaphore
+		}
+		vulkanutil.Track(r.device, r.renderFinished[i])
+	}
+	r.imageFences = make([]vk.Fence, len(r.cmdBuffers))
+}
+
+func (r *VulkanRenderInfo) destroyImageSyncObjects() {
+	for i := range r.renderFinished {
+		vulkanutil.Destroy(r.device, r.renderFinished[i])
+	}
+	r.renderFinished = nil
+	r.imageFences = nil
+}
+
+func (r *VulkanRenderInfo) destroySyncObjects() {
+	for i := range r.fences {
+		vulkanutil.Destroy(r.device, r.fences[i])
+		vulkanutil.Destroy(r.device, r.imageAvailable[i])
 	}
+	r.fences = nil
+	r.imageAvailable = nil
+	r.destroyImageSyncObjects()
+}
+
+// recordCommandBuffers records the draw into
+// the command buffer of each swapchain image.
+func recordCommandBuffers(s *VulkanSwapchainInfo,
+	r *VulkanRenderInfo, b *VulkanBufferInfo, gfx *VulkanGfxPipelineInfo) {
+
 	for i := range r.cmdBuffers {
 		cmdBufferBeginInfo := vk.CommandBufferBeginInfo{
 			SType: vk.StructureTypeCommandBufferBeginInfo,
 		}
-		renderPassBeginInfo := vk.RenderPassBeginInfo{
-			SType:       vk.StructureTypeRenderPassBeginInfo,
-			RenderPass:  r.RenderPass,
-			Framebuffer: s.Framebuffers[i],
-			RenderArea: vk.Rect2D{
-				Offset: vk.Offset2D{
-					X: 0, Y: 0,
-				},
-				Extent: s.DisplaySize,
-			},
-			ClearValueCount: 1,
-			PClearValues:    clearValues,
-		}
 		ret := vk.BeginCommandBuffer(r.cmdBuffers[i], &cmdBufferBeginInfo)
 		check(ret, "vk.BeginCommandBuffer")
 
-		vk.CmdBeginRenderPass(r.cmdBuffers[i], &renderPassBeginInfo, vk.SubpassContentsInline)
-		vk.CmdBindPipeline(r.cmdBuffers[i], vk.PipelineBindPointGraphics, gfx.pipeline)
-		offsets := make([]vk.DeviceSize, len(b.vertexBuffers))
-		vk.CmdBindVertexBuffers(r.cmdBuffers[i], 0, 1, b.vertexBuffers, offsets)
-		vk.CmdDraw(r.cmdBuffers[i], 3, 1, 0, 0)
-		vk.CmdEndRenderPass(r.cmdBuffers[i])
+		recordDraw(r.cmdBuffers[i], r, s.Framebuffers[i], s.DisplaySize, b, gfx)
 
 		ret = vk.EndCommandBuffer(r.cmdBuffers[i])
 		check(ret, "vk.EndCommandBuffer")
 	}
-	fenceCreateInfo := vk.FenceCreateInfo{
-		SType: vk.StructureTypeFenceCreateInfo,
-	}
-	semaphoreCreateInfo := vk.SemaphoreCreateInfo{
-		SType: vk.StructureTypeSemaphoreCreateInfo,
+}
+
+// recordDraw records the render pass that clears the framebuffer
+// and draws the mesh.
+func recordDraw(cmd vk.CommandBuffer, r *VulkanRenderInfo, framebuffer vk.Framebuffer,
+	extent vk.Extent2D, b *VulkanBufferInfo, gfx *VulkanGfxPipelineInfo) {
+
+	// one per attachment, see CreateRenderer for their order.
+	clearColor := vk.NewClearValue([]float32{0.098, 0.71, 0.996, 1})
+	clearValues := []vk.ClearValue{clearColor}
+	if r.DepthFormat != vk.FormatUndefined {
+		clearValues = append(clearValues, vk.NewClearDepthStencil(1, 0))
+	}
+	if r.Samples != vk.SampleCount1Bit {
+		clearValues = append(clearValues, clearColor)
+	}
+	renderPassBeginInfo := vk.RenderPassBeginInfo{
+		SType:       vk.StructureTypeRenderPassBeginInfo,
+		RenderPass:  r.RenderPass,
+		Framebuffer: framebuffer,
+		RenderArea: vk.Rect2D{
+			Offset: vk.Offset2D{
+				X: 0, Y: 0,
+			},
+			Extent: extent,
+		},
+		ClearValueCount: uint32(len(clearValues)),
+		PClearValues:    clearValues,
+	}
+	vulkanutil.BeginLabel(r.device, cmd, "draw mesh")
+	vk.CmdBeginRenderPass(cmd, &renderPassBeginInfo, vk.SubpassContentsInline)
+	vk.CmdBindPipeline(cmd, vk.PipelineBindPointGraphics, gfx.pipeline)
+	offsets := make([]vk.DeviceSize, len(b.vertexBuffers))
+	vk.CmdBindVertexBuffers(cmd, 0, uint32(len(b.vertexBuffers)), b.vertexBuffers, offsets)
+	if b.IndexCount > 0 {
+		vk.CmdBindIndexBuffer(cmd, b.indexBuffer, 0, b.indexType)
+		vk.CmdDrawIndexed(cmd, b.IndexCount, 1, 0, 0, 0)
+	} else {
+		vk.CmdDraw(cmd, b.VertexCount, 1, 0, 0)
 	}
-	r.fences = make([]vk.Fence, 1)
-	ret := vk.CreateFence(v.Device, &fenceCreateInfo, nil, &r.fences[0])
-	check(ret, "vk.CreateFence")
-	r.semaphores = make([]vk.Semaphore, 1)
-	ret = vk.CreateSemaphore(v.Device, &semaphoreCreateInfo, nil, &r.semaphores[0])
-	check(ret, "vk.CreateSemaphore")
+	vk.CmdEndRenderPass(cmd)
+	vulkanutil.EndLabel(r.device, cmd)
 }
 
-func VulkanDrawFrame(v VulkanDeviceInfo,
-	s VulkanSwapchainInfo, r VulkanRenderInfo) bool {
+// VulkanDrawFrame renders and presents the next frame. Up to MaxFramesInFlight
+// frames are queued, it only blocks when the oldest one is still being rendered.
+// An out of date or suboptimal swapchain is recreated, see Recreate.
+// It reports whether a frame has been presented.
+func VulkanDrawFrame(v *VulkanDeviceInfo, s *VulkanSwapchainInfo,
+	r *VulkanRenderInfo, b *VulkanBufferInfo, gfx *VulkanGfxPipelineInfo) bool {
 	var nextIdx uint32
+	frame := r.frame
+	const timeoutNano = 10 * 1000 * 1000 * 1000 // 10 sec
 
-	// Phase 1: vk.AcquireNextImage
+	// Phase 1: vk.WaitForFences
+	//			wait until the GPU is done with the previous use of this frame
+
+	err := vk.Error(vk.WaitForFences(v.Device, 1, r.fences[frame:], vk.True, timeoutNano))
+	if err != nil {
+		err = fmt.Errorf("vk.WaitForFences failed with %s", err)
+		log.Println("[WARN]", err)
+		return false
+	}
+
+	// Phase 2: vk.AcquireNextImage
 	// 			get the framebuffer index we should draw in
 	//
 	//			N.B. non-infinite timeouts may be not yet implemented
 	//			by your Vulkan driver
 
-	err := vk.Error(vk.AcquireNextImage(v.Device, s.DefaultSwapchain(),
-		vk.MaxUint64, r.DefaultSemaphore(), vk.NullFence, &nextIdx))
-	if err != nil {
+	ret := vk.AcquireNextImage(v.Device, s.DefaultSwapchain(),
+		vk.MaxUint64, r.imageAvailable[frame], vk.NullFence, &nextIdx)
+	if ret == vk.ErrorOutOfDate {
+		// the semaphore is not signaled, nothing to draw into.
+		recreateSwapchain(v, s, r, b, gfx)
+		return false
+	}
+	// vk.Suboptimal still acquires an image, it is recreated after present.
+	suboptimal := ret == vk.Suboptimal
+	if err = vk.Error(ret); err != nil && !suboptimal {
 		err = fmt.Errorf("vk.AcquireNextImage failed with %s", err)
 		log.Println("[WARN]", err)
 		return false
 	}
+	// the command buffer of this image may still be used by another frame.
+	if imageFence := r.imageFences[nextIdx]; imageFence != vk.NullFence && imageFence != r.fences[frame] {
+		err = vk.Error(vk.WaitForFences(v.Device, 1, []vk.Fence{imageFence}, vk.True, timeoutNano))
+		if err != nil {
+			err = fmt.Errorf("vk.WaitForFences failed with %s", err)
+			log.Println("[WARN]", err)
+			return false
+		}
+	}
+	r.imageFences[nextIdx] = r.fences[frame]
 
-	// Phase 2: vk.QueueSubmit
-	//			vk.WaitForFences
+	// Phase 3: vk.QueueSubmit
+	//			signal the render finished semaphore of the image and the frame fence
 
-	vk.ResetFences(v.Device, 1, r.fences)
+	vk.ResetFences(v.Device, 1, r.fences[frame:])
 	submitInfo := []vk.SubmitInfo{{
 		SType:              vk.StructureTypeSubmitInfo,
 		WaitSemaphoreCount: 1,
-		PWaitSemaphores:    r.semaphores,
-		CommandBufferCount: 1,
-		PCommandBuffers:    r.cmdBuffers[nextIdx:],
+		PWaitSemaphores:    r.imageAvailable[frame:],
+		PWaitDstStageMask: []vk.PipelineStageFlags{
+			vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+		},
+		CommandBufferCount:   1,
+		PCommandBuffers:      r.cmdBuffers[nextIdx:],
+		SignalSemaphoreCount: 1,
+		PSignalSemaphores:    r.renderFinished[nextIdx:],
 	}}
-	err = vk.Error(vk.QueueSubmit(v.Queue, 1, submitInfo, r.DefaultFence()))
+	err = vk.Error(vk.QueueSubmit(v.Queue, 1, submitInfo, r.fences[frame]))
 	if err != nil {
 		err = fmt.Errorf("vk.QueueSubmit failed with %s", err)
 		log.Println("[WARN]", err)
+		// an empty batch still consumes the acquire semaphore and signals
+		// the fence, or the next wait on this frame would never return.
+		submitInfo[0].CommandBufferCount = 0
+		submitInfo[0].PCommandBuffers = nil
+		submitInfo[0].SignalSemaphoreCount = 0
+		submitInfo[0].PSignalSemaphores = nil
+		ret = vk.QueueSubmit(v.Queue, 1, submitInfo, r.fences[frame])
+		check(ret, "vk.QueueSubmit")
 		return false
 	}
+	r.frame = (frame + 1) % len(r.fences)
 
-	const timeoutNano = 10 * 1000 * 1000 * 1000 // 10 sec
-	err = vk.Error(vk.WaitForFences(v.Device, 1, r.fences, vk.True, timeoutNano))
-	if err != nil {
-		err = fmt.Errorf("vk.WaitForFences failed with %s", err)
-		log.Println("[WARN]", err)
-		return false
-	}
-
-	// Phase 3: vk.QueuePresent
+	// Phase 4: vk.QueuePresent
+	//			wait for the render finished semaphore
 
 	imageIndices := []uint32{nextIdx}
 	presentInfo := vk.PresentInfo{
-		SType:          vk.StructureTypePresentInfo,
-		SwapchainCount: 1,
-		PSwapchains:    s.Swapchains,
-		PImageIndices:  imageIndices,
+		SType:              vk.StructureTypePresentInfo,
+		WaitSemaphoreCount: 1,
+		PWaitSemaphores:    r.renderFinished[nextIdx:],
+		SwapchainCount:     1,
+		PSwapchains:        s.Swapchains,
+		PImageIndices:      imageIndices,
 	}
-	err = vk.Error(vk.QueuePresent(v.Queue, &presentInfo))
-	if err != nil {
+	ret = vk.QueuePresent(v.PresentQueue, &presentInfo)
+	if ret == vk.ErrorOutOfDate || ret == vk.Suboptimal || suboptimal {
+		recreateSwapchain(v, s, r, b, gfx)
+		return ret != vk.ErrorOutOfDate
+	}
+	if err = vk.Error(ret); err != nil {
 		err = fmt.Errorf("vk.QueuePresent failed with %s", err)
 		log.Println("[WARN]", err)
 		return false
@@ -194,6 +382,14 @@ func VulkanDrawFrame(v VulkanDeviceInfo,
 	return true
 }
 
+func recreateSwapchain(v *VulkanDeviceInfo, s *VulkanSwapchainInfo,
+	r *VulkanRenderInfo, b *VulkanBufferInfo, gfx *VulkanGfxPipelineInfo) {
+
+	if err := s.Recreate(v, r, b, gfx); err != nil {
+		log.Println("[WARN]", err)
+	}
+}
+
 func (r *VulkanRenderInfo) CreateCommandBuffers(n uint32) error {
 	r.cmdBuffers = make([]vk.CommandBuffer, n)
 	cmdBufferAllocateInfo := vk.CommandBufferAllocateInfo{
@@ -207,19 +403,73 @@ func (r *VulkanRenderInfo) CreateCommandBuffers(n uint32) error {
 		err = fmt.Errorf("vk.AllocateCommandBuffers failed with %s", err)
 		return err
 	}
+	for i, cmd := range r.cmdBuffers {
+		vulkanutil.SetObjectName(r.device, cmd, fmt.Sprintf("draw command buffer %d", i))
+	}
 	return nil
 }
 
-func CreateRenderer(device vk.Device, displayFormat vk.Format) (VulkanRenderInfo, error) {
+// RendererOptions configure CreateRenderer.
+type RendererOptions struct {
+	// Depth adds a depth attachment in the most precise of D32, D24S8 and D16
+	// supported by the device, and enables the depth test in the pipeline.
+	Depth bool
+	// Samples is the number of samples per pixel, clamped to what the device
+	// supports for framebuffers. With more than one sample the frame is drawn
+	// into a multisampled color image and resolved into the target image.
+	// Zero means a single sample.
+	Samples vk.SampleCountFlagBits
+	// Offscreen leaves the rendered image ready to be copied, see RenderOffscreen,
+	// instead of ready to be presented.
+	Offscreen bool
+}
+
+// CreateRenderer creates the render pass and a command pool
+// for the graphics queue family, see QueueFamilies.
+func CreateRenderer(v *VulkanDeviceInfo, displayFormat vk.Format, opt RendererOptions) (VulkanRenderInfo, error) {
+	r := VulkanRenderInfo{
+		device:      v.Device,
+		allocator:   v.allocator,
+		DepthFormat: vk.FormatUndefined,
+		Samples:     vk.SampleCount1Bit,
+		colorFormat: displayFormat,
+	}
+	if opt.Depth {
+		format, err := findDepthFormat(v.gpu)
+		if err != nil {
+			return r, err
+		}
+		r.DepthFormat = format
+		log.Println("[INFO] depth format", format)
+	}
+	if opt.Samples > vk.SampleCount1Bit {
+		r.Samples = vulkanutil.ClampSampleCount(v.gpu, opt.Samples, opt.Depth)
+		log.Printf("[INFO] %d samples per pixel (%d requested)", r.Samples, opt.Samples)
+	}
+
+	// Phase 1: vk.CreateRenderPass
+	//			the target color attachment, an optional depth attachment
+	//			and the multisampled color attachment resolved into the target
+
+	colorLoadOp := vk.AttachmentLoadOpClear
+	if r.Samples != vk.SampleCount1Bit {
+		// fully overwritten by the resolve.
+		colorLoadOp = vk.AttachmentLoadOpDontCare
+	}
+	r.finalLayout = vk.ImageLayoutPresentSrc
+	if opt.Offscreen {
+		r.finalLayout = vk.ImageLayoutTransferSrcOptimal
+	}
 	attachmentDescriptions := []vk.AttachmentDescription{{
 		Format:         displayFormat,
 		Samples:        vk.SampleCount1Bit,
-		LoadOp:         vk.AttachmentLoadOpClear,
+		LoadOp:         colorLoadOp,
 		StoreOp:        vk.AttachmentStoreOpStore,
 		StencilLoadOp:  vk.AttachmentLoadOpDontCare,
 		StencilStoreOp: vk.AttachmentStoreOpDontCare,
-		InitialLayout:  vk.ImageLayoutColorAttachmentOptimal,
-		FinalLayout:    vk.ImageLayoutColorAttachmentOptimal,
+		// the previous contents are cleared or resolved over.
+		InitialLayout: vk.ImageLayoutUndefined,
+		FinalLayout:   r.finalLayout,
 	}}
 	colorAttachments := []vk.AttachmentReference{{
 		Attachment: 0,
@@ -230,57 +480,141 @@ func CreateRenderer(device vk.Device, displayFormat vk.Format) (VulkanRenderInfo
 		ColorAttachmentCount: 1,
 		PColorAttachments:    colorAttachments,
 	}}
+	// The color attachment is written once the acquire semaphore, waited on
+	// at the color attachment output stage, is signaled. The layout transition
+	// from undefined must wait for it too, so it happens in that stage.
+	acquireDependency := vk.SubpassDependency{
+		SrcSubpass:    vk.SubpassExternal,
+		DstSubpass:    0,
+		SrcStageMask:  vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+		DstStageMask:  vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+		DstAccessMask: vk.AccessFlags(vk.AccessColorAttachmentWriteBit),
+	}
+	if r.DepthFormat != vk.FormatUndefined {
+		attachmentDescriptions = append(attachmentDescriptions, vk.AttachmentDescription{
+			Format:         r.DepthFormat,
+			Samples:        r.Samples,
+			LoadOp:         vk.AttachmentLoadOpClear,
+			StoreOp:        vk.AttachmentStoreOpDontCare,
+			StencilLoadOp:  vk.AttachmentLoadOpDontCare,
+			StencilStoreOp: vk.AttachmentStoreOpDontCare,
+			InitialLayout:  vk.ImageLayoutUndefined,
+			FinalLayout:    vk.ImageLayoutDepthStencilAttachmentOptimal,
+		})
+		subpassDescriptions[0].PDepthStencilAttachment = []vk.AttachmentReference{{
+			Attachment: uint32(len(attachmentDescriptions) - 1),
+			Layout:     vk.ImageLayoutDepthStencilAttachmentOptimal,
+		}}
+		// frames in flight share the depth image, the clear of a frame
+		// must wait for the depth tests of the previous one.
+		depthStages := vk.PipelineStageFlags(vk.PipelineStageEarlyFragmentTestsBit |
+			vk.PipelineStageLateFragmentTestsBit)
+		acquireDependency.SrcStageMask |= depthStages
+		acquireDependency.DstStageMask |= depthStages
+		acquireDependency.SrcAccessMask |= vk.AccessFlags(vk.AccessDepthStencilAttachmentWriteBit)
+		acquireDependency.DstAccessMask |= vk.AccessFlags(vk.AccessDepthStencilAttachmentReadBit |
+			vk.AccessDepthStencilAttachmentWriteBit)
+	}
+	if r.Samples != vk.SampleCount1Bit {
+		attachmentDescriptions = append(attachmentDescriptions, vk.AttachmentDescription{
+			Format:         displayFormat,
+			Samples:        r.Samples,
+			LoadOp:         vk.AttachmentLoadOpClear,
+			StoreOp:        vk.AttachmentStoreOpDontCare,
+			StencilLoadOp:  vk.AttachmentLoadOpDontCare,
+			StencilStoreOp: vk.AttachmentStoreOpDontCare,
+			InitialLayout:  vk.ImageLayoutUndefined,
+			FinalLayout:    vk.ImageLayoutColorAttachmentOptimal,
+		})
+		// draw into the multisampled image, resolve into the target.
+		subpassDescriptions[0].PColorAttachments = []vk.AttachmentReference{{
+			Attachment: uint32(len(attachmentDescriptions) - 1),
+			Layout:     vk.ImageLayoutColorAttachmentOptimal,
+		}}
+		subpassDescriptions[0].PResolveAttachments = colorAttachments
+		// the multisampled image is shared by the frames in flight too.
+		acquireDependency.SrcAccessMask |= vk.AccessFlags(vk.AccessColorAttachmentWriteBit)
+	}
+	dependencies := []vk.SubpassDependency{acquireDependency}
+	if opt.Offscreen {
+		// the copy after the render pass reads what the subpass has written.
+		dependencies = append(dependencies, vk.SubpassDependency{
+			SrcSubpass:    0,
+			DstSubpass:    vk.SubpassExternal,
+			SrcStageMask:  vk.PipelineStageFlags(vk.PipelineStageColorAttachmentOutputBit),
+			DstStageMask:  vk.PipelineStageFlags(vk.PipelineStageTransferBit),
+			SrcAccessMask: vk.AccessFlags(vk.AccessColorAttachmentWriteBit),
+			DstAccessMask: vk.AccessFlags(vk.AccessTransferReadBit),
+		})
+	}
 	renderPassCreateInfo := vk.RenderPassCreateInfo{
 		SType:           vk.StructureTypeRenderPassCreateInfo,
-		AttachmentCount: 1,
+		AttachmentCount: uint32(len(attachmentDescriptions)),
 		PAttachments:    attachmentDescriptions,
 		SubpassCount:    1,
 		PSubpasses:      subpassDescriptions,
+		DependencyCount: uint32(len(dependencies)),
+		PDependencies:   dependencies,
 	}
-	cmdPoolCreateInfo := vk.CommandPoolCreateInfo{
-		SType:            vk.StructureTypeCommandPoolCreateInfo,
-		Flags:            vk.CommandPoolCreateFlags(vk.CommandPoolCreateResetCommandBufferBit),
-		QueueFamilyIndex: 0,
-	}
-	var r VulkanRenderInfo
-	err := vk.Error(vk.CreateRenderPass(device, &renderPassCreateInfo, nil, &r.RenderPass))
+	err := vk.Error(vk.CreateRenderPass(v.Device, &renderPassCreateInfo, nil, &r.RenderPass))
 	if err != nil {
 		err = fmt.Errorf("vk.CreateRenderPass failed with %s", err)
 		return r, err
 	}
-	err = vk.Error(vk.CreateCommandPool(device, &cmdPoolCreateInfo, nil, &r.cmdPool))
+	vulkanutil.Track(v.Device, r.RenderPass)
+
+	// Phase 2: vk.CreateCommandPool
+
+	cmdPoolCreateInfo := vk.CommandPoolCreateInfo{
+		SType:            vk.StructureTypeCommandPoolCreateInfo,
+		Flags:            vk.CommandPoolCreateFlags(vk.CommandPoolCreateResetCommandBufferBit),
+		QueueFamilyIndex: v.Families.Graphics,
+	}
+	err = vk.Error(vk.CreateCommandPool(v.Device, &cmdPoolCreateInfo, nil, &r.cmdPool))
 	if err != nil {
 		err = fmt.Errorf("vk.CreateCommandPool failed with %s", err)
 		return r, err
 	}
-	r.device = device
+	vulkanutil.Track(v.Device, r.cmdPool)
 	return r, nil
 }
 
-func NewVulkanDevice(appInfo *vk.ApplicationInfo, window uintptr) (VulkanDeviceInfo, error) {
+// NewVulkanDevice creates a logical device on the physical device chosen
+// by vulkanutil.SelectPhysicalDevice with the given filters.
+// A zero window gives a headless device for offscreen rendering.
+func NewVulkanDevice(appInfo *vk.ApplicationInfo, window uintptr,
+	filters ...vulkanutil.DeviceFilter) (VulkanDeviceInfo, error) {
 	// Phase 1: vk.CreateInstance with vk.InstanceCreateInfo
 
 	existingExtensions := getInstanceExtensions()
 	log.Println("[INFO] Instance extensions:", existingExtensions)
 
 	instanceExtensions := vk.GetRequiredInstanceExtensions()
-	if enableDebug {
-		instanceExtensions = append(instanceExtensions,
-			"VK_EXT_debug_report\x00")
-	}
-
-	// ANDROID:
-	// these layers must be included in APK,
-	// see Android.mk and ValidationLayers.mk
-	instanceLayers := []string{
-	// "VK_LAYER_GOOGLE_threading\x00",
-	// "VK_LAYER_LUNARG_parameter_validation\x00",
-	// "VK_LAYER_LUNARG_object_tracker\x00",
-	// "VK_LAYER_LUNARG_core_validation\x00",
-	// "VK_LAYER_LUNARG_api_dump\x00",
-	// "VK_LAYER_LUNARG_image\x00",
-	// "VK_LAYER_LUNARG_swapchain\x00",
-	// "VK_LAYER_GOOGLE_unique_objects\x00",
+	if window == 0 {
+		// no surface, use only the extensions that are available.
+		instanceExtensions = availableExtensions(instanceExtensions, existingExtensions)
+	}
+	var instanceLayers []string
+	var debugExtension string
+	if Validation {
+		// ANDROID:
+		// the layer must be included in APK,
+		// see Android.mk and ValidationLayers.mk
+		existingLayers := getInstanceLayers()
+		log.Println("[INFO] Instance layers:", existingLayers)
+		instanceLayers = vulkanutil.SelectValidationLayers(existingLayers)
+
+		// the debug extensions may come from the layer instead, as on Android.
+		available := append([]string(nil), existingExtensions...)
+		for _, layer := range instanceLayers {
+			available = append(available, getLayerExtensions(layer)...)
+		}
+		// Nvidia Shield K1 fw 1.3.0 lacks VK_EXT_debug_report,
+		// on fw 1.2.0 it works fine.
+		debugExtension = vulkanutil.SelectDebugExtension(available)
+		if debugExtension != "" {
+			instanceExtensions = append(instanceExtensions, debugExtension+"\x00")
+		}
 	}
 
 	instanceCreateInfo := vk.InstanceCreateInfo{
@@ -291,6 +625,10 @@ func NewVulkanDevice(appInfo *vk.ApplicationInfo, window uintptr) (VulkanDeviceI
 		EnabledLayerCount:       uint32(len(instanceLayers)),
 		PpEnabledLayerNames:     instanceLayers,
 	}
+	if debugExtension == "VK_EXT_debug_utils" {
+		free := vulkanutil.ChainDebugMessenger(&instanceCreateInfo, DebugMessages)
+		defer free()
+	}
 	var v VulkanDeviceInfo
 	err := vk.Error(vk.CreateInstance(&instanceCreateInfo, nil, &v.Instance))
 	if err != nil {
@@ -300,48 +638,76 @@ func NewVulkanDevice(appInfo *vk.ApplicationInfo, window uintptr) (VulkanDeviceI
 		vk.InitInstance(v.Instance)
 	}
 
-	// Phase 2: vk.CreateAndroidSurface with vk.AndroidSurfaceCreateInfo
+	// Phase 2: the debug messenger or report callback
+	//			created first so the messages about the device are logged
 
-	err = vk.Error(vk.CreateWindowSurface(v.Instance, window, nil, &v.Surface))
-	if err != nil {
-		vk.DestroyInstance(v.Instance, nil)
-		err = fmt.Errorf("vkCreateWindowSurface failed with %s", err)
-		return v, err
+	v.createDebugCallback(debugExtension)
+
+	// Phase 3: vk.CreateAndroidSurface with vk.AndroidSurfaceCreateInfo
+
+	if window != 0 {
+		err = vk.Error(vk.CreateWindowSurface(v.Instance, window, nil, &v.Surface))
+		if err != nil {
+			v.destroyInstance()
+			err = fmt.Errorf("vkCreateWindowSurface failed with %s", err)
+			return v, err
+		}
 	}
 	if v.gpuDevices, err = getPhysicalDevices(v.Instance); err != nil {
 		v.gpuDevices = nil
-		vk.DestroySurface(v.Instance, v.Surface, nil)
-		vk.DestroyInstance(v.Instance, nil)
+		v.destroyInstance()
 		return v, err
 	}
+	if window != 0 {
+		// devices that can't present to the window are never candidates,
+		// so another GPU is picked instead of failing in vk.CreateDevice.
+		filters = append([]vulkanutil.DeviceFilter{
+			vulkanutil.WithExtensions("VK_KHR_swapchain"),
+			vulkanutil.WithPresentSupport(v.Surface),
+		}, filters...)
+	}
+	gpuInfo, err := vulkanutil.SelectPhysicalDevice(v.gpuDevices, filters...)
+	if err != nil {
+		v.gpuDevices = nil
+		v.destroyInstance()
+		return v, err
+	}
+	v.gpu = gpuInfo.Device
+	log.Println("[INFO] Selected physical device", gpuInfo)
 
-	existingExtensions = getDeviceExtensions(v.gpuDevices[0])
+	existingExtensions = getDeviceExtensions(v.gpu)
 	log.Println("[INFO] Device extensions:", existingExtensions)
 
-	// Phase 3: vk.CreateDevice with vk.DeviceCreateInfo (a logical device)
-
-	// ANDROID:
-	// these layers must be included in APK,
-	// see Android.mk and ValidationLayers.mk
-	deviceLayers := []string{
-	// "VK_LAYER_GOOGLE_threading\x00",
-	// "VK_LAYER_LUNARG_parameter_validation\x00",
-	// "VK_LAYER_LUNARG_object_tracker\x00",
-	// "VK_LAYER_LUNARG_core_validation\x00",
-	// "VK_LAYER_LUNARG_api_dump\x00",
-	// "VK_LAYER_LUNARG_image\x00",
-	// "VK_LAYER_LUNARG_swapchain\x00",
-	// "VK_LAYER_GOOGLE_unique_objects\x00",
-	}
-
-	queueCreateInfos := []vk.DeviceQueueCreateInfo{{
-		SType:            vk.StructureTypeDeviceQueueCreateInfo,
-		QueueCount:       1,
-		PQueuePriorities: []float32{1.0},
-	}}
+	v.Families, err = findQueueFamilies(v.gpu, v.Surface)
+	if err != nil {
+		v.gpuDevices = nil
+		v.destroyInstance()
+		return v, err
+	}
+	log.Printf("[INFO] Queue families: graphics %d, present %d, compute %d, transfer %d",
+		v.Families.Graphics, v.Families.Present, v.Families.Compute, v.Families.Transfer)
+
+	// Phase 4: vk.CreateDevice with vk.DeviceCreateInfo (a logical device)
+
+	// device layers are ignored by current loaders,
+	// older ones expect the instance layers here too.
+	deviceLayers := instanceLayers
+
+	var queueCreateInfos []vk.DeviceQueueCreateInfo
+	for _, idx := range v.Families.Unique() {
+		queueCreateInfos = append(queueCreateInfos, vk.DeviceQueueCreateInfo{
+			SType:            vk.StructureTypeDeviceQueueCreateInfo,
+			QueueFamilyIndex: idx,
+			QueueCount:       1,
+			PQueuePriorities: []float32{1.0},
+		})
+	}
 	deviceExtensions := []string{
 		"VK_KHR_swapchain\x00",
 	}
+	if window == 0 {
+		deviceExtensions = availableExtensions(deviceExtensions, existingExtensions)
+	}
 	deviceCreateInfo := vk.DeviceCreateInfo{
 		SType:                   vk.StructureTypeDeviceCreateInfo,
 		QueueCreateInfoCount:    uint32(len(queueCreateInfos)),
@@ -351,39 +717,73 @@ func NewVulkanDevice(appInfo *vk.ApplicationInfo, window uintptr) (VulkanDeviceI
 		EnabledLayerCount:       uint32(len(deviceLayers)),
 		PpEnabledLayerNames:     deviceLayers,
 	}
-	var device vk.Device // we choose the first GPU available for this device
-	err = vk.Error(vk.CreateDevice(v.gpuDevices[0], &deviceCreateInfo, nil, &device))
+	var device vk.Device
+	err = vk.Error(vk.CreateDevice(v.gpu, &deviceCreateInfo, nil, &device))
 	if err != nil {
 		v.gpuDevices = nil
-		vk.DestroySurface(v.Instance, v.Surface, nil)
-		vk.DestroyInstance(v.Instance, nil)
+		v.destroyInstance()
 		err = fmt.Errorf("vk.CreateDevice failed with %s", err)
 		return v, err
 	} else {
 		v.Device = device
-		var queue vk.Queue
-		vk.GetDeviceQueue(device, 0, 0, &queue)
-		v.Queue = queue
+		v.Queue = getDeviceQueue(device, v.Families.Graphics)
+		v.PresentQueue = getDeviceQueue(device, v.Families.Present)
+		v.ComputeQueue = getDeviceQueue(device, v.Families.Compute)
+		v.TransferQueue = getDeviceQueue(device, v.Families.Transfer)
+		v.allocator = vulkanutil.NewAllocator(v.gpu, device, 0)
+		v.tracker = vulkanutil.NewTracker(device)
+		if v.dbgMessenger != vk.NullDebugUtilsMessenger {
+			v.tracker.EnableDebugUtils()
+		}
 	}
+	return v, nil
+}
 
-	if enableDebug {
-		// Phase 4: vk.CreateDebugReportCallback
-
+// createDebugCallback logs the validation messages through debugExtension,
+// failing to do so is only a warning.
+func (v *VulkanDeviceInfo) createDebugCallback(debugExtension string) {
+	switch debugExtension {
+	case "VK_EXT_debug_utils":
+		messenger, err := vulkanutil.CreateDebugMessenger(v.Instance, DebugMessages)
+		if err != nil {
+			log.Println("[WARN]", err)
+			return
+		}
+		v.dbgMessenger = messenger
+	case "VK_EXT_debug_report":
 		dbgCreateInfo := vk.DebugReportCallbackCreateInfo{
 			SType:       vk.StructureTypeDebugReportCallbackCreateInfo,
 			Flags:       vk.DebugReportFlags(vk.DebugReportErrorBit | vk.DebugReportWarningBit),
 			PfnCallback: dbgCallbackFunc,
 		}
 		var dbg vk.DebugReportCallback
-		err = vk.Error(vk.CreateDebugReportCallback(v.Instance, &dbgCreateInfo, nil, &dbg))
+		err := vk.Error(vk.CreateDebugReportCallback(v.Instance, &dbgCreateInfo, nil, &dbg))
 		if err != nil {
 			err = fmt.Errorf("vk.CreateDebugReportCallback failed with %s", err)
 			log.Println("[WARN]", err)
-			return v, nil
+			return
 		}
 		v.dbg = dbg
 	}
-	return v, nil
+}
+
+// destroyInstance destroys the surface, the debug callbacks and the
+// instance when NewVulkanDevice fails.
+func (v *VulkanDeviceInfo) destroyInstance() {
+	vk.DestroySurface(v.Instance, v.Surface, nil)
+	if v.dbg != vk.NullDebugReportCallback {
+		vk.DestroyDebugReportCallback(v.Instance, v.dbg, nil)
+	}
+	vulkanutil.DestroyDebugMessenger(v.Instance, v.dbgMessenger)
+	vk.DestroyInstance(v.Instance, nil)
+}
+
+func getDeviceQueue(device vk.Device, family uint32) vk.Queue {
+	var queue vk.Queue
+	if family != vk.QueueFamilyIgnored {
+		vk.GetDeviceQueue(device, family, 0, &queue)
+	}
+	return queue
 }
 
 func getInstanceExtensions() (extNames []string) {
@@ -401,6 +801,38 @@ func getInstanceExtensions() (extNames []string) {
 	return extNames
 }
 
+// getLayerExtensions lists the instance extensions provided by the layer,
+// layerName is NUL-terminated.
+func getLayerExtensions(layerName string) (extNames []string) {
+	var instanceExtLen uint32
+	ret := vk.EnumerateInstanceExtensionProperties(layerName, &instanceExtLen, nil)
+	check(ret, "vk.EnumerateInstanceExtensionProperties")
+	instanceExt := make([]vk.ExtensionProperties, instanceExtLen)
+	ret = vk.EnumerateInstanceExtensionProperties(layerName, &instanceExtLen, instanceExt)
+	check(ret, "vk.EnumerateInstanceExtensionProperties")
+	for _, ext := range instanceExt {
+		ext.Deref()
+		extNames = append(extNames,
+			vk.ToString(ext.ExtensionName[:]))
+	}
+	return extNames
+}
+
+func getInstanceLayers() (layerNames []string) {
+	var instanceLayerLen uint32
+	ret := vk.EnumerateInstanceLayerProperties(&instanceLayerLen, nil)
+	check(ret, "vk.EnumerateInstanceLayerProperties")
+	instanceLayers := make([]vk.LayerProperties, instanceLayerLen)
+	ret = vk.EnumerateInstanceLayerProperties(&instanceLayerLen, instanceLayers)
+	check(ret, "vk.EnumerateInstanceLayerProperties")
+	for _, layer := range instanceLayers {
+		layer.Deref()
+		layerNames = append(layerNames,
+			vk.ToString(layer.LayerName[:]))
+	}
+	return layerNames
+}
+
 func getDeviceExtensions(gpu vk.PhysicalDevice) (extNames []string) {
 	var deviceExtLen uint32
 	ret := vk.EnumerateDeviceExtensionProperties(gpu, "", &deviceExtLen, nil)
@@ -416,6 +848,21 @@ func getDeviceExtensions(gpu vk.PhysicalDevice) (extNames []string) {
 	return extNames
 }
 
+// availableExtensions filters the NUL-terminated wanted names
+// down to those present in the list.
+func availableExtensions(wanted, available []string) []string {
+	var names []string
+	for _, name := range wanted {
+		for _, ext := range available {
+			if ext == strings.TrimRight(name, "\x00") {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	return names
+}
+
 func dbgCallbackFunc(flags vk.DebugReportFlags, objectType vk.DebugReportObjectType,
 	object uint64, location uint, messageCode int32, pLayerPrefix string,
 	pMessage string, pUserData unsafe.Pointer) vk.Bool32 {
@@ -426,7 +873,7 @@ func dbgCallbackFunc(flags vk.DebugReportFlags, objectType vk.DebugReportObjectT
 	case flags&vk.DebugReportFlags(vk.DebugReportWarningBit) != 0:
 		log.Printf("[WARN %d] %s on layer %s", messageCode, pMessage, pLayerPrefix)
 	default:
-		log.Printf("[WARN] unknown debug message %d (layer %s)", messageCode, pLayerPrefix)
+		log.Printf("[INFO %d] %s on layer %s", messageCode, pMessage, pLayerPrefix)
 	}
 	return vk.Bool32(vk.False)
 }
@@ -451,18 +898,50 @@ func getPhysicalDevices(instance vk.Instance) ([]vk.PhysicalDevice, error) {
 	return gpuList, nil
 }
 
-func (v *VulkanDeviceInfo) CreateSwapchain() (VulkanSwapchainInfo, error) {
-	gpu := v.gpuDevices[0]
+// CreateSwapchain creates a swapchain for the surface,
+// see SwapchainOptions for the defaults and fallbacks.
+func (v *VulkanDeviceInfo) CreateSwapchain(opt SwapchainOptions) (VulkanSwapchainInfo, error) {
+	s := VulkanSwapchainInfo{
+		options: opt,
+	}
+	err := s.create(v, vk.NullSwapchain)
+	return s, err
+}
+
+// getSurfaceCapabilities queries the capabilities of the surface of v.
+func getSurfaceCapabilities(v *VulkanDeviceInfo) (vk.SurfaceCapabilities, error) {
+	var caps vk.SurfaceCapabilities
+	err := vk.Error(vk.GetPhysicalDeviceSurfaceCapabilities(v.gpu, v.Surface, &caps))
+	if err != nil {
+		err = fmt.Errorf("vk.GetPhysicalDeviceSurfaceCapabilities failed with %s", err)
+		return caps, err
+	}
+	caps.Deref()
+	caps.CurrentExtent.Deref()
+	caps.MinImageExtent.Deref()
+	caps.MaxImageExtent.Deref()
+	return caps, nil
+}
+
+// create makes a new swapchain for the surface of v. The oldSwapchain is passed
+// to the driver so it can reuse its resources, it stays in s if the creation
+// fails and is left to the caller to destroy otherwise.
+func (s *VulkanSwapchainInfo) create(v *VulkanDeviceInfo, oldSwapchain vk.Swapchain) error {
+	gpu := v.gpu
 
 	// Phase 1: vk.GetPhysicalDeviceSurfaceCapabilities
 	//			vk.GetPhysicalDeviceSurfaceFormats
+	//			vk.GetPhysicalDeviceSurfacePresentModes
 
-	var s VulkanSwapchainInfo
-	var surfaceCapabilities vk.SurfaceCapabilities
-	err := vk.Error(vk.GetPhysicalDeviceSurfaceCapabilities(gpu, v.Surface, &surfaceCapabilities))
+	surfaceCapabilities, err := getSurfaceCapabilities(v)
 	if err != nil {
-		err = fmt.Errorf("vk.GetPhysicalDeviceSurfaceCapabilities failed with %s", err)
-		return s, err
+		return err
+	}
+	extent := s.options.chooseExtent(&surfaceCapabilities)
+	if extent.Width == 0 || extent.Height == 0 {
+		err := fmt.Errorf("vk.CreateSwapchain not possible for a surface of size %dx%d",
+			extent.Width, extent.Height)
+		return err
 	}
 	var formatCount uint32
 	vk.GetPhysicalDeviceSurfaceFormats(gpu, v.Surface, &formatCount, nil)
@@ -471,66 +950,153 @@ func (v *VulkanDeviceInfo) CreateSwapchain() (VulkanSwapchainInfo, error) {
 
 	log.Println("[INFO] got", formatCount, "physical device surface formats")
 
-	chosenFormat := -1
-	for i := 0; i < int(formatCount); i++ {
+	surfaceFormats := make([]SurfaceFormat, 0, formatCount)
+	for i := range formats {
 		formats[i].Deref()
-		if formats[i].Format == vk.FormatB8g8r8a8Unorm ||
-			formats[i].Format == vk.FormatR8g8b8a8Unorm {
-			chosenFormat = i
-			break
-		}
+		surfaceFormats = append(surfaceFormats, SurfaceFormat{
+			Format:     formats[i].Format,
+			ColorSpace: formats[i].ColorSpace,
+		})
+		formats[i].Free()
 	}
-	if chosenFormat < 0 {
+	chosenFormat, ok := s.options.chooseFormat(surfaceFormats)
+	if !ok {
 		err := fmt.Errorf("vk.GetPhysicalDeviceSurfaceFormats not found suitable format")
-		return s, err
+		return err
 	}
 
+	var presentModeCount uint32
+	vk.GetPhysicalDeviceSurfacePresentModes(gpu, v.Surface, &presentModeCount, nil)
+	presentModes := make([]vk.PresentMode, presentModeCount)
+	vk.GetPhysicalDeviceSurfacePresentModes(gpu, v.Surface, &presentModeCount, presentModes)
+
 	// Phase 2: vk.CreateSwapchain
 	//			create a swapchain with supported capabilities and format
 
-	surfaceCapabilities.Deref()
-	s.DisplaySize = surfaceCapabilities.CurrentExtent
-	s.DisplaySize.Deref()
-	s.DisplayFormat = formats[chosenFormat].Format
-	queueFamily := []uint32{0}
+	presentMode := s.options.choosePresentMode(presentModes)
+	imageCount := s.options.chooseImageCount(&surfaceCapabilities)
+	log.Printf("[INFO] swapchain of %d images, format %d colorspace %d, present mode %d",
+		imageCount, chosenFormat.Format, chosenFormat.ColorSpace, presentMode)
+
 	swapchainCreateInfo := vk.SwapchainCreateInfo{
 		SType:           vk.StructureTypeSwapchainCreateInfo,
 		Surface:         v.Surface,
-		MinImageCount:   surfaceCapabilities.MinImageCount,
-		ImageFormat:     formats[chosenFormat].Format,
-		ImageColorSpace: formats[chosenFormat].ColorSpace,
-		ImageExtent:     surfaceCapabilities.CurrentExtent,
+		MinImageCount:   imageCount,
+		ImageFormat:     chosenFormat.Format,
+		ImageColorSpace: chosenFormat.ColorSpace,
+		ImageExtent:     extent,
 		ImageUsage:      vk.ImageUsageFlags(vk.ImageUsageColorAttachmentBit),
-		PreTransform:    vk.SurfaceTransformIdentityBit,
-
-		ImageArrayLayers:      1,
-		ImageSharingMode:      vk.SharingModeExclusive,
-		QueueFamilyIndexCount: 1,
-		PQueueFamilyIndices:   queueFamily,
-		PresentMode:           vk.PresentModeFifo,
-		OldSwapchain:          vk.NullSwapchain,
-		Clipped:               vk.False,
-	}
-	s.Swapchains = make([]vk.Swapchain, 1)
-	err = vk.Error(vk.CreateSwapchain(v.Device, &swapchainCreateInfo, nil, &s.Swapchains[0]))
+		PreTransform:    s.options.choosePreTransform(&surfaceCapabilities),
+		CompositeAlpha:  s.options.chooseCompositeAlpha(surfaceCapabilities.SupportedCompositeAlpha),
+
+		ImageArrayLayers: 1,
+		ImageSharingMode: vk.SharingModeExclusive,
+		PresentMode:      presentMode,
+		OldSwapchain:     oldSwapchain,
+		Clipped:          vk.False,
+	}
+	if v.Families.Shared() {
+		// images are rendered on one family and presented on another,
+		// concurrent sharing avoids the ownership transfers.
+		swapchainCreateInfo.ImageSharingMode = vk.SharingModeConcurrent
+		swapchainCreateInfo.QueueFamilyIndexCount = 2
+		swapchainCreateInfo.PQueueFamilyIndices = []uint32{
+			v.Families.Graphics, v.Families.Present,
+		}
+	}
+	var swapchain vk.Swapchain
+	err = vk.Error(vk.CreateSwapchain(v.Device, &swapchainCreateInfo, nil, &swapchain))
 	if err != nil {
 		err = fmt.Errorf("vk.CreateSwapchain failed with %s", err)
-		return s, err
+		return err
 	}
-	s.SwapchainLen = make([]uint32, 1)
-	err = vk.Error(vk.GetSwapchainImages(v.Device, s.DefaultSwapchain(), &s.SwapchainLen[0], nil))
+	vulkanutil.Track(v.Device, swapchain)
+	var swapchainLen uint32
+	err = vk.Error(vk.GetSwapchainImages(v.Device, swapchain, &swapchainLen, nil))
 	if err != nil {
+		vulkanutil.Destroy(v.Device, swapchain)
 		err = fmt.Errorf("vk.GetSwapchainImages failed with %s", err)
-		return s, err
-	}
-	for i := range formats {
-		formats[i].Free()
+		return err
 	}
 	s.Device = v.Device
-	return s, nil
+	s.Swapchains = []vk.Swapchain{swapchain}
+	s.SwapchainLen = []uint32{swapchainLen}
+	s.DisplaySize = extent
+	s.DisplayFormat = chosenFormat.Format
+	return nil
+}
+
+// Recreate replaces an out of date swapchain, e.g. after the window has been
+// resized. The image views, render targets, framebuffers, command buffers and the pipeline
+// that depends on the display size are rebuilt as well. A minimized window
+// has no size, Recreate does nothing then and the next frame tries again.
+// The new objects are created next to the old ones, which are released only
+// once the rebuild succeeded, so a failure leaves everything as it was.
+func (s *VulkanSwapchainInfo) Recreate(v *VulkanDeviceInfo,
+	r *VulkanRenderInfo, b *VulkanBufferInfo, gfx *VulkanGfxPipelineInfo) error {
+
+	surfaceCapabilities, err := getSurfaceCapabilities(v)
+	if err != nil {
+		return err
+	}
+	extent := s.options.chooseExtent(&surfaceCapabilities)
+	if extent.Width == 0 || extent.Height == 0 {
+		return nil
+	}
+
+	// Phase 1: vk.CreateSwapchain
+	//			build the swapchain and its dependents next to the old ones
+
+	old := *s
+	oldCmdBuffers := r.cmdBuffers
+	if err := s.create(v, old.DefaultSwapchain()); err != nil {
+		return err
+	}
+	s.Framebuffers, s.DisplayViews, s.targets = nil, nil, renderTargets{}
+	// rollback releases what has been built so far and restores the old objects.
+	rollback := func(err error) error {
+		s.Destroy()
+		*s = old
+		r.cmdBuffers = oldCmdBuffers
+		return err
+	}
+	if err := s.CreateFramebuffers(r); err != nil {
+		return rollback(err)
+	}
+	newGfx, err := CreateGraphicsPipeline(v.Device, s.DisplaySize, r, b.Layout)
+	if err != nil {
+		newGfx.device = v.Device
+		newGfx.Destroy()
+		return rollback(err)
+	}
+	if err := r.CreateCommandBuffers(s.DefaultSwapchainLen()); err != nil {
+		newGfx.Destroy()
+		return rollback(err)
+	}
+	if s.DisplaySize != old.DisplaySize {
+		log.Printf("[INFO] swapchain resized to %dx%d", s.DisplaySize.Width, s.DisplaySize.Height)
+	}
+
+	// Phase 2: vk.DeviceWaitIdle
+	//			release everything that refers to the old swapchain images
+
+	vk.DeviceWaitIdle(v.Device)
+	vk.FreeCommandBuffers(v.Device, r.cmdPool, uint32(len(oldCmdBuffers)), oldCmdBuffers)
+	gfx.Destroy()
+	old.Destroy()
+
+	*gfx = newGfx
+	recordCommandBuffers(s, r, b, gfx)
+	// the new swapchain may have a different number of images.
+	r.destroyImageSyncObjects()
+	r.createImageSyncObjects()
+	return nil
 }
 
-func (s *VulkanSwapchainInfo) CreateFramebuffers(renderPass vk.RenderPass, depthView vk.ImageView) error {
+// CreateFramebuffers creates a framebuffer for each swapchain image compatible
+// with the render pass of r, along with the depth and multisampled color
+// images shared by them when r has those attachments.
+func (s *VulkanSwapchainInfo) CreateFramebuffers(r *VulkanRenderInfo) error {
 	// Phase 1: vk.GetSwapchainImages
 
 	var swapchainImagesCount uint32
@@ -547,6 +1113,7 @@ func (s *VulkanSwapchainInfo) CreateFramebuffers(renderPass vk.RenderPass, depth
 
 	s.DisplayViews = make([]vk.ImageView, len(swapchainImages))
 	for i := range s.DisplayViews {
+		vulkanutil.SetObjectName(s.Device, swapchainImages[i], fmt.Sprintf("swapchain image %d", i))
 		viewCreateInfo := vk.ImageViewCreateInfo{
 			SType:    vk.StructureTypeImageViewCreateInfo,
 			Image:    swapchainImages[i],
@@ -569,118 +1136,119 @@ func (s *VulkanSwapchainInfo) CreateFramebuffers(renderPass vk.RenderPass, depth
 			err = fmt.Errorf("vk.CreateImageView failed with %s", err)
 			return err // bail out
 		}
+		vulkanutil.Track(s.Device, s.DisplayViews[i])
 	}
 	swapchainImages = nil
 
-	// Phase 3: vk.CreateFramebuffer
+	// Phase 3: create the render targets shared by all framebuffers
+
+	s.targets, err = r.createRenderTargets(s.DisplaySize)
+	if err != nil {
+		return err
+	}
+
+	// Phase 4: vk.CreateFramebuffer
 	//			create a framebuffer from each swapchain image
 
 	s.Framebuffers = make([]vk.Framebuffer, s.DefaultSwapchainLen())
 	for i := range s.Framebuffers {
-		attachments := []vk.ImageView{
-			s.DisplayViews[i], depthView,
-		}
+		attachments := s.targets.attachments(s.DisplayViews[i])
 		fbCreateInfo := vk.FramebufferCreateInfo{
 			SType:           vk.StructureTypeFramebufferCreateInfo,
-			RenderPass:      renderPass,
+			RenderPass:      r.RenderPass,
 			Layers:          1,
-			AttachmentCount: 1, // 2 if has depthView
+			AttachmentCount: uint32(len(attachments)),
 			PAttachments:    attachments,
 			Width:           s.DisplaySize.Width,
 			Height:          s.DisplaySize.Height,
 		}
-		if depthView != vk.NullImageView {
-			fbCreateInfo.AttachmentCount = 2
-		}
 		err := vk.Error(vk.CreateFramebuffer(s.Device, &fbCreateInfo, nil, &s.Framebuffers[i]))
 		if err != nil {
 			err = fmt.Errorf("vk.CreateFramebuffer failed with %s", err)
 			return err // bail out
 		}
+		vulkanutil.Track(s.Device, s.Framebuffers[i])
 	}
 	return nil
 }
 
+// CreateBuffers uploads the triangle, see TriangleMesh.
 func (v VulkanDeviceInfo) CreateBuffers() (VulkanBufferInfo, error) {
-	gpu := v.gpuDevices[0]
+	return v.CreateMesh(TriangleMesh)
+}
+
+// bufferName names a buffer after its usage in the validation messages.
+func bufferName(usage vk.BufferUsageFlagBits) string {
+	switch {
+	case usage&vk.BufferUsageVertexBufferBit != 0:
+		return "vertex buffer"
+	case usage&vk.BufferUsageIndexBufferBit != 0:
+		return "index buffer"
+	}
+	return "staging buffer"
+}
+
+// createHostBuffer creates a buffer in host visible memory filled with data.
+func (v *VulkanDeviceInfo) createHostBuffer(usage vk.BufferUsageFlagBits,
+	data []byte) (vk.Buffer, vulkanutil.Allocation, error) {
+
+	var buffer vk.Buffer
+	var memory vulkanutil.Allocation
 
 	// Phase 1: vk.CreateBuffer
-	//			create the triangle vertex buffer
-
-	vertexData := linmath.ArrayFloat32([]float32{
-		-1, -1, 0,
-		1, -1, 0,
-		0, 1, 0,
-	})
-	queueFamilyIdx := []uint32{0}
+
 	bufferCreateInfo := vk.BufferCreateInfo{
-		SType:                 vk.StructureTypeBufferCreateInfo,
-		Size:                  vk.DeviceSize(vertexData.Sizeof()),
-		Usage:                 vk.BufferUsageFlags(vk.BufferUsageVertexBufferBit),
-		SharingMode:           vk.SharingModeExclusive,
-		QueueFamilyIndexCount: 1,
-		PQueueFamilyIndices:   queueFamilyIdx,
+		SType:       vk.StructureTypeBufferCreateInfo,
+		Size:        vk.DeviceSize(len(data)),
+		Usage:       vk.BufferUsageFlags(usage),
+		SharingMode: vk.SharingModeExclusive,
 	}
-	buffer := VulkanBufferInfo{
-		vertexBuffers: make([]vk.Buffer, 1),
-	}
-	err := vk.Error(vk.CreateBuffer(v.Device, &bufferCreateInfo, nil, &buffer.vertexBuffers[0]))
+	err := vk.Error(vk.CreateBuffer(v.Device, &bufferCreateInfo, nil, &buffer))
 	if err != nil {
 		err = fmt.Errorf("vk.CreateBuffer failed with %s", err)
-		return buffer, err
-	}
-
-	// Phase 2: vk.GetBufferMemoryRequirements
-	//			vk.FindMemoryTypeIndex
-	// 			assign a proper memory type for that buffer
-
-	var memReq vk.MemoryRequirements
-	vk.GetBufferMemoryRequirements(v.Device, buffer.DefaultVertexBuffer(), &memReq)
-	memReq.Deref()
-	allocInfo := vk.MemoryAllocateInfo{
-		SType:           vk.StructureTypeMemoryAllocateInfo,
-		AllocationSize:  memReq.Size,
-		MemoryTypeIndex: 0, // see below
+		return buffer, memory, err
 	}
-	allocInfo.MemoryTypeIndex, _ = vk.FindMemoryTypeIndex(gpu, memReq.MemoryTypeBits,
-		vk.MemoryPropertyHostVisibleBit)
+	vulkanutil.Track(v.Device, buffer)
+	vulkanutil.SetObjectName(v.Device, buffer, bufferName(usage))
 
-	// Phase 3: vk.AllocateMemory
-	//			vk.MapMemory
-	//			vk.MemCopyFloat32
-	//			vk.UnmapMemory
-	// 			allocate and map memory for that buffer
+	// Phase 2: allocate and bind host visible memory for that buffer
 
-	var deviceMemory vk.DeviceMemory
-	err = vk.Error(vk.AllocateMemory(v.Device, &allocInfo, nil, &deviceMemory))
+	memory, err = v.allocator.AllocBuffer(buffer,
+		vk.MemoryPropertyHostVisibleBit|vk.MemoryPropertyHostCoherentBit)
 	if err != nil {
-		err = fmt.Errorf("vk.AllocateMemory failed with %s", err)
-		return buffer, err
+		vulkanutil.Destroy(v.Device, buffer)
+		return vk.NullBuffer, memory, err
 	}
-	var data unsafe.Pointer
-	vk.MapMemory(v.Device, deviceMemory, 0, vk.DeviceSize(vertexData.Sizeof()), 0, &data)
-	n := vk.Memcopy(data, vertexData.Data())
-	if n != vertexData.Sizeof() {
-		log.Println("[WARN] failed to copy vertex buffer data")
-	}
-	vk.UnmapMemory(v.Device, deviceMemory)
 
-	// Phase 4: vk.BindBufferMemory
-	//			copy vertex data and bind buffer
+	// Phase 3: map the memory and copy the data
 
-	err = vk.Error(vk.BindBufferMemory(v.Device, buffer.DefaultVertexBuffer(), deviceMemory, 0))
+	mapped, err := v.allocator.Map(memory)
 	if err != nil {
-		err = fmt.Errorf("vk.BindBufferMemory failed with %s", err)
-		return buffer, err
+		vulkanutil.Destroy(v.Device, buffer)
+		v.allocator.Free(memory)
+		return vk.NullBuffer, vulkanutil.Allocation{}, err
+	}
+	n := vk.Memcopy(mapped, data)
+	if n != len(data) {
+		log.Println("[WARN] failed to copy buffer data")
 	}
-	buffer.device = v.Device
-	return buffer, err
+	v.allocator.Unmap(memory)
+	return buffer, memory, nil
 }
 
 func (buf *VulkanBufferInfo) Destroy() {
 	for i := range buf.vertexBuffers {
-		vk.DestroyBuffer(buf.device, buf.vertexBuffers[i], nil)
+		vulkanutil.Destroy(buf.device, buf.vertexBuffers[i])
+	}
+	if buf.indexBuffer != vk.NullBuffer {
+		vulkanutil.Destroy(buf.device, buf.indexBuffer)
+	}
+	for i := range buf.memory {
+		buf.allocator.Free(buf.memory[i])
 	}
+	buf.vertexBuffers = nil
+	buf.indexBuffer = vk.NullBuffer
+	buf.memory = nil
 }
 
 func LoadShader(device vk.Device, name string) (vk.ShaderModule, error) {
@@ -703,11 +1271,14 @@ func LoadShader(device vk.Device, name string) (vk.ShaderModule, error) {
 		err = fmt.Errorf("vk.CreateShaderModule failed with %s", err)
 		return module, err
 	}
+	vulkanutil.Track(device, module)
 	return module, nil
 }
 
-func CreateGraphicsPipeline(device vk.Device,
-	displaySize vk.Extent2D, renderPass vk.RenderPass) (VulkanGfxPipelineInfo, error) {
+// CreateGraphicsPipeline creates the pipeline drawing meshes with the given vertex layout
+// in the render pass of r, with the depth test enabled if r has depth.
+func CreateGraphicsPipeline(device vk.Device, displaySize vk.Extent2D,
+	r *VulkanRenderInfo, layout VertexLayout) (VulkanGfxPipelineInfo, error) {
 
 	var gfxPipeline VulkanGfxPipelineInfo
 
@@ -722,6 +1293,7 @@ func CreateGraphicsPipeline(device vk.Device,
 		err = fmt.Errorf("vk.CreatePipelineLayout failed with %s", err)
 		return gfxPipeline, err
 	}
+	vulkanutil.Track(device, gfxPipeline.layout)
 	dynamicState := vk.PipelineDynamicStateCreateInfo{
 		SType: vk.StructureTypePipelineDynamicStateCreateInfo,
 		// no dynamic state for this demo
@@ -733,13 +1305,13 @@ func CreateGraphicsPipeline(device vk.Device,
 	if err != nil { // err has enough info
 		return gfxPipeline, err
 	}
-	defer vk.DestroyShaderModule(device, vertexShader, nil)
+	defer vulkanutil.Destroy(device, vertexShader)
 
 	fragmentShader, err := LoadShader(device, "shaders/tri-frag.spv")
 	if err != nil { // err has enough info
 		return gfxPipeline, err
 	}
-	defer vk.DestroyShaderModule(device, fragmentShader, nil)
+	defer vulkanutil.Destroy(device, fragmentShader)
 
 	shaderStages := []vk.PipelineShaderStageCreateInfo{
 		{
@@ -787,7 +1359,7 @@ func CreateGraphicsPipeline(device vk.Device,
 	sampleMask := []vk.SampleMask{vk.SampleMask(vk.MaxUint32)}
 	multisampleState := vk.PipelineMultisampleStateCreateInfo{
 		SType:                vk.StructureTypePipelineMultisampleStateCreateInfo,
-		RasterizationSamples: vk.SampleCount1Bit,
+		RasterizationSamples: r.Samples,
 		SampleShadingEnable:  vk.False,
 		PSampleMask:          sampleMask,
 	}
@@ -822,28 +1394,36 @@ func CreateGraphicsPipeline(device vk.Device,
 	inputAssemblyState := vk.PipelineInputAssemblyStateCreateInfo{
 		SType:                  vk.StructureTypePipelineInputAssemblyStateCreateInfo,
 		Topology:               vk.PrimitiveTopologyTriangleList,
-		PrimitiveRestartEnable: vk.True,
+		PrimitiveRestartEnable: vk.False,
 	}
-	vertexInputBindings := []vk.VertexInputBindingDescription{{
-		Binding:   0,
-		Stride:    3 * 4, // 4 = sizeof(float32)
-		InputRate: vk.VertexInputRateVertex,
-	}}
-	vertexInputAttributes := []vk.VertexInputAttributeDescription{{
-		Binding:  0,
-		Location: 0,
-		Format:   vk.FormatR32g32b32Sfloat,
-		Offset:   0,
-	}}
+	vertexInputBindings := layout.bindingDescriptions()
+	vertexInputAttributes := layout.attributeDescriptions()
 	vertexInputState := vk.PipelineVertexInputStateCreateInfo{
-		SType: vk.StructureTypePipelineVertexInputStateCreateInfo,
-		VertexBindingDescriptionCount:   1,
+		SType:                           vk.StructureTypePipelineVertexInputStateCreateInfo,
+		VertexBindingDescriptionCount:   uint32(len(vertexInputBindings)),
 		PVertexBindingDescriptions:      vertexInputBindings,
-		VertexAttributeDescriptionCount: 1,
+		VertexAttributeDescriptionCount: uint32(len(vertexInputAttributes)),
 		PVertexAttributeDescriptions:    vertexInputAttributes,
 	}
 
-	// Phase 5: vk.CreatePipelineCache
+	// Phase 6: specify depth stencil state
+	//			the depth test is off without a depth attachment
+
+	depthStencilState := vk.PipelineDepthStencilStateCreateInfo{
+		SType:                 vk.StructureTypePipelineDepthStencilStateCreateInfo,
+		DepthTestEnable:       vk.False,
+		DepthWriteEnable:      vk.False,
+		DepthCompareOp:        vk.CompareOpLessOrEqual,
+		DepthBoundsTestEnable: vk.False,
+		StencilTestEnable:     vk.False,
+		MaxDepthBounds:        1,
+	}
+	if r.DepthFormat != vk.FormatUndefined {
+		depthStencilState.DepthTestEnable = vk.True
+		depthStencilState.DepthWriteEnable = vk.True
+	}
+
+	// Phase 7: vk.CreatePipelineCache
 	//			vk.CreateGraphicsPipelines
 
 	pipelineCacheInfo := vk.PipelineCacheCreateInfo{
@@ -854,6 +1434,7 @@ func CreateGraphicsPipeline(device vk.Device,
 		err = fmt.Errorf("vk.CreatePipelineCache failed with %s", err)
 		return gfxPipeline, err
 	}
+	vulkanutil.Track(device, gfxPipeline.cache)
 	pipelineCreateInfos := []vk.GraphicsPipelineCreateInfo{{
 		SType:               vk.StructureTypeGraphicsPipelineCreateInfo,
 		StageCount:          2, // vert + frag
@@ -863,10 +1444,11 @@ func CreateGraphicsPipeline(device vk.Device,
 		PViewportState:      &viewportState,
 		PRasterizationState: &rasterState,
 		PMultisampleState:   &multisampleState,
+		PDepthStencilState:  &depthStencilState,
 		PColorBlendState:    &colorBlendState,
 		PDynamicState:       &dynamicState,
 		Layout:              gfxPipeline.layout,
-		RenderPass:          renderPass,
+		RenderPass:          r.RenderPass,
 	}}
 	pipelines := make([]vk.Pipeline, 1)
 	err = vk.Error(vk.CreateGraphicsPipelines(device,
@@ -875,6 +1457,8 @@ func CreateGraphicsPipeline(device vk.Device,
 		err = fmt.Errorf("vk.CreateGraphicsPipelines failed with %s", err)
 		return gfxPipeline, err
 	}
+	vulkanutil.Track(device, pipelines[0])
+	vulkanutil.SetObjectName(device, pipelines[0], "graphics pipeline")
 	gfxPipeline.pipeline = pipelines[0]
 	gfxPipeline.device = device
 	return gfxPipeline, nil
@@ -884,38 +1468,64 @@ func (gfx *VulkanGfxPipelineInfo) Destroy() {
 	if gfx == nil {
 		return
 	}
-	vk.DestroyPipeline(gfx.device, gfx.pipeline, nil)
-	vk.DestroyPipelineCache(gfx.device, gfx.cache, nil)
-	vk.DestroyPipelineLayout(gfx.device, gfx.layout, nil)
+	vulkanutil.Destroy(gfx.device, gfx.pipeline)
+	vulkanutil.Destroy(gfx.device, gfx.cache)
+	vulkanutil.Destroy(gfx.device, gfx.layout)
 }
 
 func (s *VulkanSwapchainInfo) Destroy() {
-	for i := uint32(0); i < s.DefaultSwapchainLen(); i++ {
-		vk.DestroyFramebuffer(s.Device, s.Framebuffers[i], nil)
-		vk.DestroyImageView(s.Device, s.DisplayViews[i], nil)
+	if s == nil {
+		return
+	}
+	// either may be partially created when CreateFramebuffers failed.
+	for i := range s.Framebuffers {
+		vulkanutil.Destroy(s.Device, s.Framebuffers[i])
+	}
+	for i := range s.DisplayViews {
+		vulkanutil.Destroy(s.Device, s.DisplayViews[i])
 	}
 	s.Framebuffers = nil
 	s.DisplayViews = nil
+	s.targets.destroy()
 	for i := range s.Swapchains {
-		vk.DestroySwapchain(s.Device, s.Swapchains[i], nil)
+		vulkanutil.Destroy(s.Device, s.Swapchains[i])
 	}
 }
 
+// DestroyInOrder destroys everything created on the device, dependents
+// first, and the device itself. Objects the tracker still knows about at
+// that point have leaked, they are destroyed too and reported as an error.
 func DestroyInOrder(v *VulkanDeviceInfo, s *VulkanSwapchainInfo,
-	r *VulkanRenderInfo, b *VulkanBufferInfo, gfx *VulkanGfxPipelineInfo) {
+	r *VulkanRenderInfo, b *VulkanBufferInfo, gfx *VulkanGfxPipelineInfo) error {
 
+	// frames in flight may still use the resources below.
+	vk.DeviceWaitIdle(v.Device)
+	r.destroySyncObjects()
 	vk.FreeCommandBuffers(v.Device, r.cmdPool, uint32(len(r.cmdBuffers)), r.cmdBuffers)
 	r.cmdBuffers = nil
 
-	vk.DestroyCommandPool(v.Device, r.cmdPool, nil)
-	vk.DestroyRenderPass(v.Device, r.RenderPass, nil)
-
 	s.Destroy()
 	gfx.Destroy()
 	b.Destroy()
+	vulkanutil.Destroy(v.Device, r.cmdPool)
+	vulkanutil.Destroy(v.Device, r.RenderPass)
+
+	err := v.tracker.Close()
+	if err != nil {
+		log.Println("[WARN]", err)
+	}
+	if stats := v.allocator.Stats(); stats.Allocations > 0 {
+		log.Println("[WARN] device memory leaked:", stats)
+		if err == nil {
+			err = fmt.Errorf("device memory leaked: %s", stats)
+		}
+	}
+	v.allocator.Destroy()
 	vk.DestroyDevice(v.Device, nil)
 	if v.dbg != vk.NullDebugReportCallback {
 		vk.DestroyDebugReportCallback(v.Instance, v.dbg, nil)
 	}
+	vulkanutil.DestroyDebugMessenger(v.Instance, v.dbgMessenger)
 	vk.DestroyInstance(v.Instance, nil)
+	return err
 }
@@ -69,15 +69,18 @@ func main() {
 					orPanic(err)
 					v, err = vulkandraw.NewVulkanDevice(appInfo, event.Window.Ptr())
 					orPanic(err)
-					s, err = v.CreateSwapchain()
+					s, err = v.CreateSwapchain(vulkandraw.SwapchainOptions{})
 					orPanic(err)
-					r, err = vulkandraw.CreateRenderer(v.Device, s.DisplayFormat)
+					r, err = vulkandraw.CreateRenderer(&v, s.DisplayFormat, vulkandraw.RendererOptions{
+						// 4 samples are cheap on tiled mobile GPUs.
+						Samples: vk.SampleCount4Bit,
+					})
 					orPanic(err)
-					err = s.CreateFramebuffers(r.RenderPass, vk.NullImageView)
+					err = s.CreateFramebuffers(&r)
 					orPanic(err)
 					b, err = v.CreateBuffers()
 					orPanic(err)
-					gfx, err = vulkandraw.CreateGraphicsPipeline(v.Device, s.DisplaySize, r.RenderPass)
+					gfx, err = vulkandraw.CreateGraphicsPipeline(v.Device, s.DisplaySize, &r, b.Layout)
 					orPanic(err)
 					log.Println("[INFO] swapchain lengths:", s.SwapchainLen)
 					err = r.CreateCommandBuffers(s.DefaultSwapchainLen())
@@ -91,7 +94,7 @@ func main() {
 					vulkandraw.DestroyInOrder(&v, &s, &r, &b, &gfx)
 				case app.NativeWindowRedrawNeeded:
 					if vkActive {
-						vulkandraw.VulkanDrawFrame(v, s, r)
+						vulkandraw.VulkanDrawFrame(&v, &s, &r, &b, &gfx)
 					}
 					a.NativeWindowRedrawDone()
 				}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/vulkan-go/demos/vulkandraw"
+	"github.com/vulkan-go/demos/vulkanutil"
 	"github.com/vulkan-go/glfw/v3.3/glfw"
 	vk "github.com/vulkan-go/vulkan"
 	"github.com/xlab/closer"
@@ -19,11 +23,51 @@ var appInfo = &vk.ApplicationInfo{
 	PEngineName:        "vulkango.com\x00",
 }
 
+var (
+	gpuSelect   = flag.String("gpu", "", "physical device to use: an index, a part of its name, type:KIND or ext:NAME, comma separated")
+	presentMode = flag.String("present", "fifo", "preferred present modes: mailbox, immediate, fifo-relaxed or fifo, comma separated")
+	srgb        = flag.Bool("srgb", false, "prefer sRGB swapchain formats")
+	depth       = flag.Bool("depth", false, "render with a depth buffer")
+	samples     = flag.Int("samples", 1, "samples per pixel for multisample anti-aliasing, e.g. 4")
+	validate    = flag.Bool("validate", vulkandraw.Validation, "enable the validation layer if installed, also set by "+vulkanutil.ValidationEnv+"=1")
+	severity    = flag.String("validate-severity", "warning", "least severe validation message logged: verbose, info, warning or error")
+	msgTypes    = flag.String("validate-types", "general,validation,performance", "validation message types logged, comma separated")
+)
+
+var presentModes = map[string]vk.PresentMode{
+	"mailbox":      vk.PresentModeMailbox,
+	"immediate":    vk.PresentModeImmediate,
+	"fifo-relaxed": vk.PresentModeFifoRelaxed,
+	"fifo":         vk.PresentModeFifo,
+}
+
+func swapchainOptions() (vulkandraw.SwapchainOptions, error) {
+	var opt vulkandraw.SwapchainOptions
+	for _, name := range strings.Split(*presentMode, ",") {
+		mode, ok := presentModes[strings.TrimSpace(name)]
+		if !ok {
+			return opt, fmt.Errorf("unknown present mode %q", name)
+		}
+		opt.PresentModes = append(opt.PresentModes, mode)
+	}
+	if *srgb {
+		opt.Formats = vulkandraw.SRGBSurfaceFormats
+	}
+	return opt, nil
+}
+
 func init() {
 	runtime.LockOSThread()
 }
 
 func main() {
+	flag.Parse()
+	vulkandraw.Validation = *validate
+	filter, err := vulkanutil.ParseDebugMessageFilter(*severity, *msgTypes)
+	orPanic(err)
+	vulkandraw.DebugMessages = filter
+	gpuFilter, err := vulkanutil.ParseDeviceFilter(*gpuSelect)
+	orPanic(err)
 	orPanic(glfw.Init())
 	orPanic(vk.Init())
 	defer closer.Close()
@@ -40,17 +84,23 @@ func main() {
 	window, err := glfw.CreateWindow(640, 480, "Vulkan Info", nil, nil)
 	orPanic(err)
 
-	v, err = vulkandraw.NewVulkanDevice(appInfo, window.GLFWWindow())
+	v, err = vulkandraw.NewVulkanDevice(appInfo, window.GLFWWindow(), gpuFilter)
+	orPanic(err)
+	opt, err := swapchainOptions()
 	orPanic(err)
-	s, err = v.CreateSwapchain()
+	opt.FramebufferSize = window.GetFramebufferSize
+	s, err = v.CreateSwapchain(opt)
 	orPanic(err)
-	r, err = vulkandraw.CreateRenderer(v.Device, s.DisplayFormat)
+	r, err = vulkandraw.CreateRenderer(&v, s.DisplayFormat, vulkandraw.RendererOptions{
+		Depth:   *depth,
+		Samples: vk.SampleCountFlagBits(*samples),
+	})
 	orPanic(err)
-	err = s.CreateFramebuffers(r.RenderPass, nil)
+	err = s.CreateFramebuffers(&r)
 	orPanic(err)
 	b, err = v.CreateBuffers()
 	orPanic(err)
-	gfx, err = vulkandraw.CreateGraphicsPipeline(v.Device, s.DisplaySize, r.RenderPass)
+	gfx, err = vulkandraw.CreateGraphicsPipeline(v.Device, s.DisplaySize, &r, b.Layout)
 	orPanic(err)
 	log.Println("[INFO] swapchain lengths:", s.SwapchainLen)
 	err = r.CreateCommandBuffers(s.DefaultSwapchainLen())
@@ -81,7 +131,7 @@ func main() {
 				continue
 			}
 			glfw.PollEvents()
-			vulkandraw.VulkanDrawFrame(v, s, r)
+			vulkandraw.VulkanDrawFrame(&v, &s, &r, &b, &gfx)
 		}
 	}
 }
@@ -0,0 +1,265 @@
+package vulkandraw
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/vulkan-go/demos/internal/golden"
+	"github.com/vulkan-go/demos/vulkanutil"
+	vk "github.com/vulkan-go/vulkan"
+)
+
+var testAppInfo = &vk.ApplicationInfo{
+	SType:              vk.StructureTypeApplicationInfo,
+	ApiVersion:         vk.MakeVersion(1, 0, 0),
+	ApplicationVersion: vk.MakeVersion(1, 0, 0),
+	PApplicationName:   "VulkanDrawTest\x00",
+	PEngineName:        "vulkango.com\x00",
+}
+
+// goldenOptions allow for small rasterization differences between drivers.
+var goldenOptions = golden.Options{
+	Tolerance:     8,
+	MaxMismatched: 64,
+}
+
+func initLoader(t *testing.T) {
+	if err := vk.SetDefaultGetInstanceProcAddr(); err != nil {
+		t.Skip("no Vulkan loader:", err)
+	}
+	if err := vk.Init(); err != nil {
+		t.Skip("no Vulkan loader:", err)
+	}
+}
+
+func newTestDevice(t *testing.T) VulkanDeviceInfo {
+	initLoader(t)
+	v, err := NewVulkanDevice(testAppInfo, 0)
+	if err != nil {
+		t.Skip("no Vulkan device:", err)
+	}
+	return v
+}
+
+func TestTriangleGolden(t *testing.T) {
+	cases := []struct {
+		name string
+		opt  RendererOptions
+		// golden is the suffix of the golden images,
+		// the depth test must not change the triangle.
+		golden string
+	}{
+		{"plain", RendererOptions{}, ""},
+		{"depth", RendererOptions{Depth: true}, ""},
+		{"msaa4", RendererOptions{Depth: true, Samples: vk.SampleCount4Bit}, "_msaa4"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.opt.Offscreen = true
+			testTriangle(t, c.opt, func(t *testing.T, size vk.Extent2D, img *image.RGBA) {
+				name := fmt.Sprintf("triangle_%dx%d%s", size.Width, size.Height, c.golden)
+				golden.Compare(t, name, img, goldenOptions)
+			})
+		})
+	}
+}
+
+// TestValidation renders with the validation layer enabled,
+// any warning or error it reports fails the test.
+func TestValidation(t *testing.T) {
+	initLoader(t)
+	layers := vulkanutil.SelectValidationLayers(getInstanceLayers())
+	if layers == nil {
+		t.Skip("no validation layer")
+	}
+	available := append(getInstanceExtensions(), getLayerExtensions(layers[0])...)
+	if vulkanutil.SelectDebugExtension(available) == "" {
+		t.Skip("no debug extension to report the validation messages")
+	}
+	defer func(enabled bool, filter vulkanutil.DebugMessageFilter) {
+		Validation = enabled
+		DebugMessages = filter
+	}(Validation, DebugMessages)
+	Validation = true
+	DebugMessages = vulkanutil.DefaultDebugMessageFilter
+
+	cases := []struct {
+		name string
+		opt  RendererOptions
+	}{
+		{"plain", RendererOptions{}},
+		{"msaa4", RendererOptions{Depth: true, Samples: vk.SampleCount4Bit}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			messages := captureDebugMessages()
+			c.opt.Offscreen = true
+			testTriangle(t, c.opt, func(t *testing.T, size vk.Extent2D, img *image.RGBA) {})
+			// the device is destroyed by now, so its messages are in too.
+			for _, m := range messages() {
+				t.Error(m)
+			}
+		})
+	}
+}
+
+// debugMessage matches the lines logged for validation warnings and errors,
+// by vulkanutil.CreateDebugMessenger and by dbgCallbackFunc.
+var debugMessage = regexp.MustCompile(`\[(WARN|ERROR) [^\]]+\]`)
+
+// captureDebugMessages collects the validation warnings and errors logged
+// until the returned function is called, which gives them.
+func captureDebugMessages() func() []string {
+	w := &debugMessageWriter{}
+	log.SetOutput(w)
+	return func() []string {
+		log.SetOutput(os.Stderr)
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return w.messages
+	}
+}
+
+type debugMessageWriter struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (w *debugMessageWriter) Write(p []byte) (int, error) {
+	if debugMessage.Match(p) {
+		w.mu.Lock()
+		w.messages = append(w.messages, string(bytes.TrimSpace(p)))
+		w.mu.Unlock()
+	}
+	return os.Stderr.Write(p)
+}
+
+// testTriangle renders the triangle offscreen at a few sizes with opt
+// and passes each frame to check.
+func testTriangle(t *testing.T, opt RendererOptions,
+	check func(t *testing.T, size vk.Extent2D, img *image.RGBA)) {
+
+	v := newTestDevice(t)
+	b, err := v.CreateBuffers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := CreateRenderer(&v, OffscreenFormat, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// no swapchain and the pipelines are per size
+	defer func() {
+		// leaked objects fail the test
+		if err := DestroyInOrder(&v, nil, &r, &b, nil); err != nil {
+			t.Error(err)
+		}
+	}()
+	if r.Samples < opt.Samples {
+		// the frames of other sample counts would not match.
+		t.Skipf("%d samples are not supported", opt.Samples)
+	}
+
+	sizes := []vk.Extent2D{
+		{Width: 256, Height: 256},
+		{Width: 320, Height: 180},
+	}
+	for _, size := range sizes {
+		t.Run(fmt.Sprintf("%dx%d", size.Width, size.Height), func(t *testing.T) {
+			o, err := v.CreateOffscreen(size.Width, size.Height)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer o.Destroy()
+			if err := o.CreateFramebuffer(&r); err != nil {
+				t.Fatal(err)
+			}
+			pipeline, err := CreateGraphicsPipeline(v.Device, o.Size, &r, b.Layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pipeline.Destroy()
+
+			img, err := RenderOffscreen(&v, &o, &r, &b, &pipeline)
+			if err != nil {
+				t.Fatal(err)
+			}
+			check(t, size, img)
+		})
+	}
+}
+
+func TestMeshIndexData(t *testing.T) {
+	mesh := Mesh{
+		Layout:    PositionLayout,
+		Vertices:  TriangleMesh.Vertices,
+		Indices16: []uint16{0, 1, 2},
+	}
+	data, indexType, count, err := mesh.indexData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 6 || indexType != vk.IndexTypeUint16 || count != 3 {
+		t.Errorf("got %d bytes of type %v for %d indices, want 6 bytes of uint16 for 3", len(data), indexType, count)
+	}
+
+	mesh.Indices32 = []uint32{0, 1, 2}
+	if _, _, _, err := mesh.indexData(); err == nil {
+		t.Error("mesh with 16 and 32-bit indices is accepted")
+	}
+	mesh.Indices16 = nil
+	data, indexType, _, _ = mesh.indexData()
+	if len(data) != 12 || indexType != vk.IndexTypeUint32 {
+		t.Errorf("got %d bytes of type %v, want 12 bytes of uint32", len(data), indexType)
+	}
+}
+
+func TestMeshValidate(t *testing.T) {
+	colorLayout := VertexLayout{
+		Stride: 16,
+		Attributes: []VertexAttribute{
+			{Location: 0, Format: vk.FormatR32g32b32Sfloat, Offset: 0},
+			{Location: 1, Format: vk.FormatR8g8b8a8Unorm, Offset: 12},
+		},
+	}
+	cases := []struct {
+		name     string
+		layout   VertexLayout
+		vertices int
+		ok       bool
+	}{
+		{"position", PositionLayout, 36, true},
+		{"position and color", colorLayout, 48, true},
+		{"no stride", VertexLayout{Attributes: PositionLayout.Attributes}, 36, false},
+		{"no vertices", PositionLayout, 0, false},
+		{"partial vertex", PositionLayout, 40, false},
+		{"attribute past the stride", VertexLayout{
+			Stride:     12,
+			Attributes: []VertexAttribute{{Format: vk.FormatR32g32Sfloat, Offset: 8}},
+		}, 36, false},
+		{"attribute larger than the stride", VertexLayout{
+			Stride:     8,
+			Attributes: []VertexAttribute{{Format: vk.FormatR32g32b32Sfloat}},
+		}, 32, false},
+		{"unsupported format", VertexLayout{
+			Stride:     16,
+			Attributes: []VertexAttribute{{Format: vk.FormatD32Sfloat}},
+		}, 32, false},
+	}
+	for _, c := range cases {
+		mesh := Mesh{
+			Layout:   c.layout,
+			Vertices: make([]byte, c.vertices),
+		}
+		err := mesh.validate()
+		if ok := err == nil; ok != c.ok {
+			t.Errorf("%s: validate = %v, want ok %v", c.name, err, c.ok)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package vulkaninfo
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	vk "github.com/vulkan-go/vulkan"
+	"github.com/xlab/tablewriter"
+)
+
+// MemoryHeapReport describes a memory heap of a physical device.
+type MemoryHeapReport struct {
+	Index int      `json:"index" yaml:"index"`
+	Size  uint64   `json:"size" yaml:"size"`
+	Flags []string `json:"flags" yaml:"flags"`
+}
+
+// MemoryTypeReport describes a memory type and the heap it is allocated from.
+type MemoryTypeReport struct {
+	Index     int      `json:"index" yaml:"index"`
+	HeapIndex uint32   `json:"heapIndex" yaml:"heapIndex"`
+	Flags     []string `json:"flags" yaml:"flags"`
+}
+
+// QueueFamilyReport describes a queue family of a physical device.
+type QueueFamilyReport struct {
+	Index                       int      `json:"index" yaml:"index"`
+	Flags                       []string `json:"flags" yaml:"flags"`
+	QueueCount                  uint32   `json:"queueCount" yaml:"queueCount"`
+	TimestampValidBits          uint32   `json:"timestampValidBits" yaml:"timestampValidBits"`
+	MinImageTransferGranularity Extent3D `json:"minImageTransferGranularity" yaml:"minImageTransferGranularity"`
+}
+
+type Extent3D struct {
+	Width  uint32 `json:"width" yaml:"width"`
+	Height uint32 `json:"height" yaml:"height"`
+	Depth  uint32 `json:"depth" yaml:"depth"`
+}
+
+type flagName struct {
+	bit  uint32
+	name string
+}
+
+var memoryPropertyFlagNames = []flagName{
+	{uint32(vk.MemoryPropertyDeviceLocalBit), "DEVICE_LOCAL"},
+	{uint32(vk.MemoryPropertyHostVisibleBit), "HOST_VISIBLE"},
+	{uint32(vk.MemoryPropertyHostCoherentBit), "HOST_COHERENT"},
+	{uint32(vk.MemoryPropertyHostCachedBit), "HOST_CACHED"},
+	{uint32(vk.MemoryPropertyLazilyAllocatedBit), "LAZILY_ALLOCATED"},
+}
+
+var memoryHeapFlagNames = []flagName{
+	{uint32(vk.MemoryHeapDeviceLocalBit), "DEVICE_LOCAL"},
+}
+
+var queueFlagNames = []flagName{
+	{uint32(vk.QueueGraphicsBit), "GRAPHICS"},
+	{uint32(vk.QueueComputeBit), "COMPUTE"},
+	{uint32(vk.QueueTransferBit), "TRANSFER"},
+	{uint32(vk.QueueSparseBindingBit), "SPARSE_BINDING"},
+}
+
+// flagNames lists the names of the bits set in flags,
+// bits without a known name are reported in hex.
+func flagNames(flags uint32, names []flagName) []string {
+	list := []string{}
+	for _, f := range names {
+		if flags&f.bit != 0 {
+			list = append(list, f.name)
+			flags &^= f.bit
+		}
+	}
+	if flags != 0 {
+		list = append(list, fmt.Sprintf("0x%x", flags))
+	}
+	return list
+}
+
+func getLimits(gpuProperties *vk.PhysicalDeviceProperties) map[string]interface{} {
+	limits := gpuProperties.Limits
+	limits.Deref()
+	return structValues(reflect.ValueOf(limits))
+}
+
+func getFeatures(gpu vk.PhysicalDevice) map[string]bool {
+	var features vk.PhysicalDeviceFeatures
+	vk.GetPhysicalDeviceFeatures(gpu, &features)
+	features.Deref()
+
+	values := make(map[string]bool)
+	for name, v := range structValues(reflect.ValueOf(features)) {
+		if b, ok := v.(bool); ok {
+			values[name] = b
+		}
+	}
+	return values
+}
+
+func getMemory(gpu vk.PhysicalDevice) ([]MemoryHeapReport, []MemoryTypeReport) {
+	var memProperties vk.PhysicalDeviceMemoryProperties
+	vk.GetPhysicalDeviceMemoryProperties(gpu, &memProperties)
+	memProperties.Deref()
+
+	heaps := make([]MemoryHeapReport, 0, memProperties.MemoryHeapCount)
+	for i := 0; i < int(memProperties.MemoryHeapCount); i++ {
+		heap := memProperties.MemoryHeaps[i]
+		heap.Deref()
+		heaps = append(heaps, MemoryHeapReport{
+			Index: i,
+			Size:  uint64(heap.Size),
+			Flags: flagNames(uint32(heap.Flags), memoryHeapFlagNames),
+		})
+	}
+	types := make([]MemoryTypeReport, 0, memProperties.MemoryTypeCount)
+	for i := 0; i < int(memProperties.MemoryTypeCount); i++ {
+		memType := memProperties.MemoryTypes[i]
+		memType.Deref()
+		types = append(types, MemoryTypeReport{
+			Index:     i,
+			HeapIndex: memType.HeapIndex,
+			Flags:     flagNames(uint32(memType.PropertyFlags), memoryPropertyFlagNames),
+		})
+	}
+	return heaps, types
+}
+
+func getQueueFamilies(gpu vk.PhysicalDevice) []QueueFamilyReport {
+	var queueFamilyCount uint32
+	vk.GetPhysicalDeviceQueueFamilyProperties(gpu, &queueFamilyCount, nil)
+	queueFamilies := make([]vk.QueueFamilyProperties, queueFamilyCount)
+	vk.GetPhysicalDeviceQueueFamilyProperties(gpu, &queueFamilyCount, queueFamilies)
+
+	families := make([]QueueFamilyReport, 0, queueFamilyCount)
+	for i, family := range queueFamilies {
+		family.Deref()
+		family.MinImageTransferGranularity.Deref()
+		families = append(families, QueueFamilyReport{
+			Index:              i,
+			Flags:              flagNames(uint32(family.QueueFlags), queueFlagNames),
+			QueueCount:         family.QueueCount,
+			TimestampValidBits: family.TimestampValidBits,
+			MinImageTransferGranularity: Extent3D{
+				Width:  family.MinImageTransferGranularity.Width,
+				Height: family.MinImageTransferGranularity.Height,
+				Depth:  family.MinImageTransferGranularity.Depth,
+			},
+		})
+	}
+	return families
+}
+
+// structValues maps the exported fields of a Vulkan struct to plain Go values,
+// keyed by the lowerCamel field name as in the Vulkan spec.
+// Bool32 fields become booleans and arrays become slices.
+func structValues(v reflect.Value) map[string]interface{} {
+	values := make(map[string]interface{})
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if len(field.PkgPath) > 0 {
+			continue // unexported
+		}
+		if value, ok := fieldValue(field.Name, v.Field(i)); ok {
+			values[lowerCamel(field.Name)] = value
+		}
+	}
+	return values
+}
+
+var bool32Type = reflect.TypeOf(vk.Bool32(0))
+
+// fieldValue is plainValue that also turns byte arrays into strings:
+// names and infos are NUL-terminated, UUIDs and LUIDs are printed in hex.
+func fieldValue(name string, v reflect.Value) (interface{}, bool) {
+	if v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8 {
+		data := make([]byte, v.Len())
+		for i := range data {
+			data[i] = byte(v.Index(i).Uint())
+		}
+		switch {
+		case strings.HasSuffix(name, "Name"), strings.HasSuffix(name, "Info"):
+			return vk.ToString(data), true
+		case strings.HasSuffix(name, "UUID"), strings.HasSuffix(name, "LUID"):
+			return hex.EncodeToString(data), true
+		}
+	}
+	return plainValue(v)
+}
+
+func plainValue(v reflect.Value) (interface{}, bool) {
+	if v.Type() == bool32Type {
+		return v.Uint() != 0, true
+	}
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Array:
+		list := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			value, ok := plainValue(v.Index(i))
+			if !ok {
+				return nil, false
+			}
+			list = append(list, value)
+		}
+		return list, true
+	default:
+		return nil, false
+	}
+}
+
+func lowerCamel(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[size:]
+}
+
+func sortedKeys(m interface{}) []string {
+	keys := reflect.ValueOf(m).MapKeys()
+	names := make([]string, 0, len(keys))
+	for _, k := range keys {
+		names = append(names, k.String())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func addCapabilityRows(table *tablewriter.Table, dev *DeviceReport) {
+	table.AddSeparator()
+	table.AddRow("DEVICE LIMITS", "")
+	for _, name := range sortedKeys(dev.Limits) {
+		table.AddRow(name, fmt.Sprint(dev.Limits[name]))
+	}
+
+	table.AddSeparator()
+	table.AddRow("DEVICE FEATURES", "")
+	for _, name := range sortedKeys(dev.Features) {
+		table.AddRow(name, dev.Features[name])
+	}
+
+	table.AddSeparator()
+	table.AddRow("MEMORY HEAPS", "")
+	for _, heap := range dev.MemoryHeaps {
+		table.AddRow(heap.Index, fmt.Sprintf("%d MiB %v", heap.Size>>20, heap.Flags))
+	}
+
+	table.AddSeparator()
+	table.AddRow("MEMORY TYPES", "")
+	for _, memType := range dev.MemoryTypes {
+		table.AddRow(memType.Index, fmt.Sprintf("heap %d %v", memType.HeapIndex, memType.Flags))
+	}
+
+	table.AddSeparator()
+	table.AddRow("QUEUE FAMILIES", "")
+	for _, family := range dev.QueueFamilies {
+		g := family.MinImageTransferGranularity
+		table.AddRow(family.Index, fmt.Sprintf("%d queues %v, timestamp bits %d, granularity %dx%dx%d",
+			family.QueueCount, family.Flags, family.TimestampValidBits, g.Width, g.Height, g.Depth))
+	}
+}
@@ -0,0 +1,213 @@
+package vulkaninfo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Change kinds reported by DiffReports.
+const (
+	ChangeAdded   = "+"
+	ChangeRemoved = "-"
+	ChangeUpdated = "~"
+)
+
+// Change is a single difference between two reports.
+type Change struct {
+	Section string
+	Kind    string
+	Name    string
+	Old     string
+	New     string
+}
+
+func (c Change) String() string {
+	if c.Kind == ChangeUpdated {
+		return fmt.Sprintf("%s %s %s: %s -> %s", c.Kind, c.Section, c.Name, c.Old, c.New)
+	}
+	return fmt.Sprintf("%s %s %s", c.Kind, c.Section, c.Name)
+}
+
+// LoadReport reads a report saved with -format json or -format yaml,
+// the format is picked by the file extension.
+func LoadReport(path string) (*Report, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, r)
+	default:
+		// keep the numbers as written, large limits would lose
+		// their integer form if decoded as float64.
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(r)
+	}
+	if err != nil {
+		err = fmt.Errorf("vulkaninfo: failed to read %s: %s", path, err)
+		return nil, err
+	}
+	return r, nil
+}
+
+// DiffReports lists what changed from a to b: instance extensions and layers,
+// and extensions, layers, limits, features and format support of the selected device.
+func DiffReports(a, b *Report) []Change {
+	var changes []Change
+	changes = append(changes, diffLists("instance extension", a.InstanceExtensions, b.InstanceExtensions)...)
+	changes = append(changes, diffLists("instance layer", a.InstanceLayers, b.InstanceLayers)...)
+
+	devA, devB := a.Selected(), b.Selected()
+	if devA == nil || devB == nil {
+		if devA != devB {
+			changes = append(changes, Change{
+				Section: "device",
+				Kind:    ChangeUpdated,
+				Name:    "selected",
+				Old:     deviceName(devA),
+				New:     deviceName(devB),
+			})
+		}
+		return changes
+	}
+	if devA.Name != devB.Name {
+		changes = append(changes, Change{Section: "device", Kind: ChangeUpdated, Name: "name", Old: devA.Name, New: devB.Name})
+	}
+	if devA.APIVersion != devB.APIVersion {
+		changes = append(changes, Change{Section: "device", Kind: ChangeUpdated, Name: "apiVersion", Old: devA.APIVersion, New: devB.APIVersion})
+	}
+	if devA.DriverVersion != devB.DriverVersion {
+		changes = append(changes, Change{Section: "device", Kind: ChangeUpdated, Name: "driverVersion", Old: devA.DriverVersion, New: devB.DriverVersion})
+	}
+	changes = append(changes, diffLists("device extension", devA.Extensions, devB.Extensions)...)
+	changes = append(changes, diffLists("device layer", devA.Layers, devB.Layers)...)
+	changes = append(changes, diffValues("limit", devA.Limits, devB.Limits)...)
+	changes = append(changes, diffValues("feature", boolValues(devA.Features), boolValues(devB.Features))...)
+	changes = append(changes, diffValues("extended", flatValues(devA.Extended), flatValues(devB.Extended))...)
+	changes = append(changes, diffValues("format", formatValues(devA.Formats), formatValues(devB.Formats))...)
+	return changes
+}
+
+// WriteDiff prints one change per line.
+func WriteDiff(w io.Writer, changes []Change) error {
+	for _, c := range changes {
+		if _, err := fmt.Fprintln(w, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func diffLists(section string, a, b []string) []Change {
+	var changes []Change
+	for _, name := range a {
+		if !hasString(b, name) {
+			changes = append(changes, Change{Section: section, Kind: ChangeRemoved, Name: name})
+		}
+	}
+	for _, name := range b {
+		if !hasString(a, name) {
+			changes = append(changes, Change{Section: section, Kind: ChangeAdded, Name: name})
+		}
+	}
+	return changes
+}
+
+// diffValues compares values by their printed form, so numbers read back
+// from JSON match the integers collected from a live device.
+func diffValues(section string, a, b map[string]interface{}) []Change {
+	var changes []Change
+	for _, name := range sortedKeys(a) {
+		valueA := fmt.Sprint(a[name])
+		valueB, ok := b[name]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Section: section, Kind: ChangeRemoved, Name: name})
+		case valueA != fmt.Sprint(valueB):
+			changes = append(changes, Change{Section: section, Kind: ChangeUpdated, Name: name, Old: valueA, New: fmt.Sprint(valueB)})
+		}
+	}
+	for _, name := range sortedKeys(b) {
+		if _, ok := a[name]; !ok {
+			changes = append(changes, Change{Section: section, Kind: ChangeAdded, Name: name})
+		}
+	}
+	return changes
+}
+
+func boolValues(m map[string]bool) map[string]interface{} {
+	values := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		values[k] = v
+	}
+	return values
+}
+
+func flatValues(sections map[string]map[string]interface{}) map[string]interface{} {
+	values := make(map[string]interface{})
+	for section, m := range sections {
+		for k, v := range m {
+			values[section+"."+k] = v
+		}
+	}
+	return values
+}
+
+func formatValues(formats []FormatReport) map[string]interface{} {
+	values := make(map[string]interface{}, len(formats))
+	for _, f := range formats {
+		values[f.Format] = fmt.Sprintf("%s / %s / %s",
+			featureList(f.Linear), featureList(f.Optimal), featureList(f.Buffer))
+	}
+	return values
+}
+
+func deviceName(dev *DeviceReport) string {
+	if dev == nil {
+		return "none"
+	}
+	return dev.Name
+}
+
+func hasString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff implements the diff command: it compares the report saved at args[0]
+// with the one at args[1], or with the current system when only one path is given.
+// It reports whether any differences were found.
+func Diff(w io.Writer, args []string, current func() (*Report, error)) (bool, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return false, fmt.Errorf("usage: diff a.json [b.json]")
+	}
+	a, err := LoadReport(args[0])
+	if err != nil {
+		return false, err
+	}
+	var b *Report
+	if len(args) == 2 {
+		b, err = LoadReport(args[1])
+	} else {
+		b, err = current()
+	}
+	if err != nil {
+		return false, err
+	}
+	changes := DiffReports(a, b)
+	return len(changes) > 0, WriteDiff(w, changes)
+}
@@ -0,0 +1,457 @@
+package vulkaninfo
+
+import (
+	"fmt"
+	"strings"
+
+	vk "github.com/vulkan-go/vulkan"
+	"github.com/xlab/tablewriter"
+)
+
+// FormatReport lists the features supported for a format
+// with linear and optimal tiling, and in buffers.
+type FormatReport struct {
+	Format  string   `json:"format" yaml:"format"`
+	Value   int32    `json:"value" yaml:"value"`
+	Linear  []string `json:"linearTilingFeatures" yaml:"linearTilingFeatures"`
+	Optimal []string `json:"optimalTilingFeatures" yaml:"optimalTilingFeatures"`
+	Buffer  []string `json:"bufferFeatures" yaml:"bufferFeatures"`
+}
+
+// SurfaceFormatReport is a format and color space pair supported by the surface.
+type SurfaceFormatReport struct {
+	Format     string `json:"format" yaml:"format"`
+	ColorSpace string `json:"colorSpace" yaml:"colorSpace"`
+}
+
+var formatFeatureFlagNames = []flagName{
+	{uint32(vk.FormatFeatureSampledImageBit), "SAMPLED_IMAGE"},
+	{uint32(vk.FormatFeatureStorageImageBit), "STORAGE_IMAGE"},
+	{uint32(vk.FormatFeatureStorageImageAtomicBit), "STORAGE_IMAGE_ATOMIC"},
+	{uint32(vk.FormatFeatureUniformTexelBufferBit), "UNIFORM_TEXEL_BUFFER"},
+	{uint32(vk.FormatFeatureStorageTexelBufferBit), "STORAGE_TEXEL_BUFFER"},
+	{uint32(vk.FormatFeatureStorageTexelBufferAtomicBit), "STORAGE_TEXEL_BUFFER_ATOMIC"},
+	{uint32(vk.FormatFeatureVertexBufferBit), "VERTEX_BUFFER"},
+	{uint32(vk.FormatFeatureColorAttachmentBit), "COLOR_ATTACHMENT"},
+	{uint32(vk.FormatFeatureColorAttachmentBlendBit), "COLOR_ATTACHMENT_BLEND"},
+	{uint32(vk.FormatFeatureDepthStencilAttachmentBit), "DEPTH_STENCIL_ATTACHMENT"},
+	{uint32(vk.FormatFeatureBlitSrcBit), "BLIT_SRC"},
+	{uint32(vk.FormatFeatureBlitDstBit), "BLIT_DST"},
+	{uint32(vk.FormatFeatureSampledImageFilterLinearBit), "SAMPLED_IMAGE_FILTER_LINEAR"},
+}
+
+// formatNames follows the order of VkFormat, index is the format value.
+var formatNames = [...]string{
+	"UNDEFINED",
+	"R4G4_UNORM_PACK8",
+	"R4G4B4A4_UNORM_PACK16",
+	"B4G4R4A4_UNORM_PACK16",
+	"R5G6B5_UNORM_PACK16",
+	"B5G6R5_UNORM_PACK16",
+	"R5G5B5A1_UNORM_PACK16",
+	"B5G5R5A1_UNORM_PACK16",
+	"A1R5G5B5_UNORM_PACK16",
+	"R8_UNORM",
+	"R8_SNORM",
+	"R8_USCALED",
+	"R8_SSCALED",
+	"R8_UINT",
+	"R8_SINT",
+	"R8_SRGB",
+	"R8G8_UNORM",
+	"R8G8_SNORM",
+	"R8G8_USCALED",
+	"R8G8_SSCALED",
+	"R8G8_UINT",
+	"R8G8_SINT",
+	"R8G8_SRGB",
+	"R8G8B8_UNORM",
+	"R8G8B8_SNORM",
+	"R8G8B8_USCALED",
+	"R8G8B8_SSCALED",
+	"R8G8B8_UINT",
+	"R8G8B8_SINT",
+	"R8G8B8_SRGB",
+	"B8G8R8_UNORM",
+	"B8G8R8_SNORM",
+	"B8G8R8_USCALED",
+	"B8G8R8_SSCALED",
+	"B8G8R8_UINT",
+	"B8G8R8_SINT",
+	"B8G8R8_SRGB",
+	"R8G8B8A8_UNORM",
+	"R8G8B8A8_SNORM",
+	"R8G8B8A8_USCALED",
+	"R8G8B8A8_SSCALED",
+	"R8G8B8A8_UINT",
+	"R8G8B8A8_SINT",
+	"R8G8B8A8_SRGB",
+	"B8G8R8A8_UNORM",
+	"B8G8R8A8_SNORM",
+	"B8G8R8A8_USCALED",
+	"B8G8R8A8_SSCALED",
+	"B8G8R8A8_UINT",
+	"B8G8R8A8_SINT",
+	"B8G8R8A8_SRGB",
+	"A8B8G8R8_UNORM_PACK32",
+	"A8B8G8R8_SNORM_PACK32",
+	"A8B8G8R8_USCALED_PACK32",
+	"A8B8G8R8_SSCALED_PACK32",
+	"A8B8G8R8_UINT_PACK32",
+	"A8B8G8R8_SINT_PACK32",
+	"A8B8G8R8_SRGB_PACK32",
+	"A2R10G10B10_UNORM_PACK32",
+	"A2R10G10B10_SNORM_PACK32",
+	"A2R10G10B10_USCALED_PACK32",
+	"A2R10G10B10_SSCALED_PACK32",
+	"A2R10G10B10_UINT_PACK32",
+	"A2R10G10B10_SINT_PACK32",
+	"A2B10G10R10_UNORM_PACK32",
+	"A2B10G10R10_SNORM_PACK32",
+	"A2B10G10R10_USCALED_PACK32",
+	"A2B10G10R10_SSCALED_PACK32",
+	"A2B10G10R10_UINT_PACK32",
+	"A2B10G10R10_SINT_PACK32",
+	"R16_UNORM",
+	"R16_SNORM",
+	"R16_USCALED",
+	"R16_SSCALED",
+	"R16_UINT",
+	"R16_SINT",
+	"R16_SFLOAT",
+	"R16G16_UNORM",
+	"R16G16_SNORM",
+	"R16G16_USCALED",
+	"R16G16_SSCALED",
+	"R16G16_UINT",
+	"R16G16_SINT",
+	"R16G16_SFLOAT",
+	"R16G16B16_UNORM",
+	"R16G16B16_SNORM",
+	"R16G16B16_USCALED",
+	"R16G16B16_SSCALED",
+	"R16G16B16_UINT",
+	"R16G16B16_SINT",
+	"R16G16B16_SFLOAT",
+	"R16G16B16A16_UNORM",
+	"R16G16B16A16_SNORM",
+	"R16G16B16A16_USCALED",
+	"R16G16B16A16_SSCALED",
+	"R16G16B16A16_UINT",
+	"R16G16B16A16_SINT",
+	"R16G16B16A16_SFLOAT",
+	"R32_UINT",
+	"R32_SINT",
+	"R32_SFLOAT",
+	"R32G32_UINT",
+	"R32G32_SINT",
+	"R32G32_SFLOAT",
+	"R32G32B32_UINT",
+	"R32G32B32_SINT",
+	"R32G32B32_SFLOAT",
+	"R32G32B32A32_UINT",
+	"R32G32B32A32_SINT",
+	"R32G32B32A32_SFLOAT",
+	"R64_UINT",
+	"R64_SINT",
+	"R64_SFLOAT",
+	"R64G64_UINT",
+	"R64G64_SINT",
+	"R64G64_SFLOAT",
+	"R64G64B64_UINT",
+	"R64G64B64_SINT",
+	"R64G64B64_SFLOAT",
+	"R64G64B64A64_UINT",
+	"R64G64B64A64_SINT",
+	"R64G64B64A64_SFLOAT",
+	"B10G11R11_UFLOAT_PACK32",
+	"E5B9G9R9_UFLOAT_PACK32",
+	"D16_UNORM",
+	"X8_D24_UNORM_PACK32",
+	"D32_SFLOAT",
+	"S8_UINT",
+	"D16_UNORM_S8_UINT",
+	"D24_UNORM_S8_UINT",
+	"D32_SFLOAT_S8_UINT",
+	"BC1_RGB_UNORM_BLOCK",
+	"BC1_RGB_SRGB_BLOCK",
+	"BC1_RGBA_UNORM_BLOCK",
+	"BC1_RGBA_SRGB_BLOCK",
+	"BC2_UNORM_BLOCK",
+	"BC2_SRGB_BLOCK",
+	"BC3_UNORM_BLOCK",
+	"BC3_SRGB_BLOCK",
+	"BC4_UNORM_BLOCK",
+	"BC4_SNORM_BLOCK",
+	"BC5_UNORM_BLOCK",
+	"BC5_SNORM_BLOCK",
+	"BC6H_UFLOAT_BLOCK",
+	"BC6H_SFLOAT_BLOCK",
+	"BC7_UNORM_BLOCK",
+	"BC7_SRGB_BLOCK",
+	"ETC2_R8G8B8_UNORM_BLOCK",
+	"ETC2_R8G8B8_SRGB_BLOCK",
+	"ETC2_R8G8B8A1_UNORM_BLOCK",
+	"ETC2_R8G8B8A1_SRGB_BLOCK",
+	"ETC2_R8G8B8A8_UNORM_BLOCK",
+	"ETC2_R8G8B8A8_SRGB_BLOCK",
+	"EAC_R11_UNORM_BLOCK",
+	"EAC_R11_SNORM_BLOCK",
+	"EAC_R11G11_UNORM_BLOCK",
+	"EAC_R11G11_SNORM_BLOCK",
+	"ASTC_4x4_UNORM_BLOCK",
+	"ASTC_4x4_SRGB_BLOCK",
+	"ASTC_5x4_UNORM_BLOCK",
+	"ASTC_5x4_SRGB_BLOCK",
+	"ASTC_5x5_UNORM_BLOCK",
+	"ASTC_5x5_SRGB_BLOCK",
+	"ASTC_6x5_UNORM_BLOCK",
+	"ASTC_6x5_SRGB_BLOCK",
+	"ASTC_6x6_UNORM_BLOCK",
+	"ASTC_6x6_SRGB_BLOCK",
+	"ASTC_8x5_UNORM_BLOCK",
+	"ASTC_8x5_SRGB_BLOCK",
+	"ASTC_8x6_UNORM_BLOCK",
+	"ASTC_8x6_SRGB_BLOCK",
+	"ASTC_8x8_UNORM_BLOCK",
+	"ASTC_8x8_SRGB_BLOCK",
+	"ASTC_10x5_UNORM_BLOCK",
+	"ASTC_10x5_SRGB_BLOCK",
+	"ASTC_10x6_UNORM_BLOCK",
+	"ASTC_10x6_SRGB_BLOCK",
+	"ASTC_10x8_UNORM_BLOCK",
+	"ASTC_10x8_SRGB_BLOCK",
+	"ASTC_10x10_UNORM_BLOCK",
+	"ASTC_10x10_SRGB_BLOCK",
+	"ASTC_12x10_UNORM_BLOCK",
+	"ASTC_12x10_SRGB_BLOCK",
+	"ASTC_12x12_UNORM_BLOCK",
+	"ASTC_12x12_SRGB_BLOCK",
+}
+
+// extensionFormatNames are the formats added by Vulkan 1.1+ and extensions,
+// outside of the core range of formatNames.
+var extensionFormatNames = map[vk.Format]string{
+	// VK_IMG_format_pvrtc
+	1000054000: "PVRTC1_2BPP_UNORM_BLOCK_IMG",
+	1000054001: "PVRTC1_4BPP_UNORM_BLOCK_IMG",
+	1000054002: "PVRTC2_2BPP_UNORM_BLOCK_IMG",
+	1000054003: "PVRTC2_4BPP_UNORM_BLOCK_IMG",
+	1000054004: "PVRTC1_2BPP_SRGB_BLOCK_IMG",
+	1000054005: "PVRTC1_4BPP_SRGB_BLOCK_IMG",
+	1000054006: "PVRTC2_2BPP_SRGB_BLOCK_IMG",
+	1000054007: "PVRTC2_4BPP_SRGB_BLOCK_IMG",
+	// VK_EXT_texture_compression_astc_hdr
+	1000066000: "ASTC_4x4_SFLOAT_BLOCK",
+	1000066001: "ASTC_5x4_SFLOAT_BLOCK",
+	1000066002: "ASTC_5x5_SFLOAT_BLOCK",
+	1000066003: "ASTC_6x5_SFLOAT_BLOCK",
+	1000066004: "ASTC_6x6_SFLOAT_BLOCK",
+	1000066005: "ASTC_8x5_SFLOAT_BLOCK",
+	1000066006: "ASTC_8x6_SFLOAT_BLOCK",
+	1000066007: "ASTC_8x8_SFLOAT_BLOCK",
+	1000066008: "ASTC_10x5_SFLOAT_BLOCK",
+	1000066009: "ASTC_10x6_SFLOAT_BLOCK",
+	1000066010: "ASTC_10x8_SFLOAT_BLOCK",
+	1000066011: "ASTC_10x10_SFLOAT_BLOCK",
+	1000066012: "ASTC_12x10_SFLOAT_BLOCK",
+	1000066013: "ASTC_12x12_SFLOAT_BLOCK",
+	// Vulkan 1.1, VK_KHR_sampler_ycbcr_conversion
+	1000156000: "G8B8G8R8_422_UNORM",
+	1000156001: "B8G8R8G8_422_UNORM",
+	1000156002: "G8_B8_R8_3PLANE_420_UNORM",
+	1000156003: "G8_B8R8_2PLANE_420_UNORM",
+	1000156004: "G8_B8_R8_3PLANE_422_UNORM",
+	1000156005: "G8_B8R8_2PLANE_422_UNORM",
+	1000156006: "G8_B8_R8_3PLANE_444_UNORM",
+	1000156007: "R10X6_UNORM_PACK16",
+	1000156008: "R10X6G10X6_UNORM_2PACK16",
+	1000156009: "R10X6G10X6B10X6A10X6_UNORM_4PACK16",
+	1000156010: "G10X6B10X6G10X6R10X6_422_UNORM_4PACK16",
+	1000156011: "B10X6G10X6R10X6G10X6_422_UNORM_4PACK16",
+	1000156012: "G10X6_B10X6_R10X6_3PLANE_420_UNORM_3PACK16",
+	1000156013: "G10X6_B10X6R10X6_2PLANE_420_UNORM_3PACK16",
+	1000156014: "G10X6_B10X6_R10X6_3PLANE_422_UNORM_3PACK16",
+	1000156015: "G10X6_B10X6R10X6_2PLANE_422_UNORM_3PACK16",
+	1000156016: "G10X6_B10X6_R10X6_3PLANE_444_UNORM_3PACK16",
+	1000156017: "R12X4_UNORM_PACK16",
+	1000156018: "R12X4G12X4_UNORM_2PACK16",
+	1000156019: "R12X4G12X4B12X4A12X4_UNORM_4PACK16",
+	1000156020: "G12X4B12X4G12X4R12X4_422_UNORM_4PACK16",
+	1000156021: "B12X4G12X4R12X4G12X4_422_UNORM_4PACK16",
+	1000156022: "G12X4_B12X4_R12X4_3PLANE_420_UNORM_3PACK16",
+	1000156023: "G12X4_B12X4R12X4_2PLANE_420_UNORM_3PACK16",
+	1000156024: "G12X4_B12X4_R12X4_3PLANE_422_UNORM_3PACK16",
+	1000156025: "G12X4_B12X4R12X4_2PLANE_422_UNORM_3PACK16",
+	1000156026: "G12X4_B12X4_R12X4_3PLANE_444_UNORM_3PACK16",
+	1000156027: "G16B16G16R16_422_UNORM",
+	1000156028: "B16G16R16G16_422_UNORM",
+	1000156029: "G16_B16_R16_3PLANE_420_UNORM",
+	1000156030: "G16_B16R16_2PLANE_420_UNORM",
+	1000156031: "G16_B16_R16_3PLANE_422_UNORM",
+	1000156032: "G16_B16R16_2PLANE_422_UNORM",
+	1000156033: "G16_B16_R16_3PLANE_444_UNORM",
+	// VK_EXT_ycbcr_2plane_444_formats
+	1000330000: "G8_B8R8_2PLANE_444_UNORM",
+	1000330001: "G10X6_B10X6R10X6_2PLANE_444_UNORM_3PACK16",
+	1000330002: "G12X4_B12X4R12X4_2PLANE_444_UNORM_3PACK16",
+	1000330003: "G16_B16R16_2PLANE_444_UNORM",
+	// VK_EXT_4444_formats
+	1000340000: "A4R4G4B4_UNORM_PACK16",
+	1000340001: "A4B4G4R4_UNORM_PACK16",
+}
+
+// extensionFormatSets are the ranges of extensionFormatNames, each with the
+// device extension that adds them and the Vulkan version that made them core,
+// zero if none did. The formats may only be queried when either is there.
+var extensionFormatSets = []struct {
+	extension   string
+	core        uint32
+	first, last vk.Format
+}{
+	{"VK_IMG_format_pvrtc", 0, 1000054000, 1000054007},
+	{"VK_EXT_texture_compression_astc_hdr", vk.MakeVersion(1, 3, 0), 1000066000, 1000066013},
+	{"VK_KHR_sampler_ycbcr_conversion", vk.MakeVersion(1, 1, 0), 1000156000, 1000156033},
+	{"VK_EXT_ycbcr_2plane_444_formats", vk.MakeVersion(1, 3, 0), 1000330000, 1000330003},
+	{"VK_EXT_4444_formats", vk.MakeVersion(1, 3, 0), 1000340000, 1000340001},
+}
+
+func FormatName(format vk.Format) string {
+	if format >= 0 && int(format) < len(formatNames) {
+		return formatNames[format]
+	}
+	if name, ok := extensionFormatNames[format]; ok {
+		return name
+	}
+	return fmt.Sprintf("FORMAT_%d", format)
+}
+
+var colorSpaceNames = map[vk.ColorSpace]string{
+	vk.ColorSpaceSrgbNonlinear: "SRGB_NONLINEAR",
+	// VK_EXT_swapchain_colorspace
+	1000104001: "DISPLAY_P3_NONLINEAR",
+	1000104002: "EXTENDED_SRGB_LINEAR",
+	1000104003: "DISPLAY_P3_LINEAR",
+	1000104004: "DCI_P3_NONLINEAR",
+	1000104005: "BT709_LINEAR",
+	1000104006: "BT709_NONLINEAR",
+	1000104007: "BT2020_LINEAR",
+	1000104008: "HDR10_ST2084",
+	1000104009: "DOLBYVISION",
+	1000104010: "HDR10_HLG",
+	1000104011: "ADOBERGB_LINEAR",
+	1000104012: "ADOBERGB_NONLINEAR",
+	1000104013: "PASS_THROUGH",
+	1000104014: "EXTENDED_SRGB_NONLINEAR",
+}
+
+func ColorSpaceName(colorSpace vk.ColorSpace) string {
+	if name, ok := colorSpaceNames[colorSpace]; ok {
+		return name
+	}
+	return fmt.Sprintf("COLOR_SPACE_%d", colorSpace)
+}
+
+func PresentModeName(mode vk.PresentMode) string {
+	switch mode {
+	case vk.PresentModeImmediate:
+		return "IMMEDIATE"
+	case vk.PresentModeMailbox:
+		return "MAILBOX"
+	case vk.PresentModeFifo:
+		return "FIFO"
+	case vk.PresentModeFifoRelaxed:
+		return "FIFO_RELAXED"
+	default:
+		return fmt.Sprintf("PRESENT_MODE_%d", mode)
+	}
+}
+
+// knownFormats lists the core formats of formatNames, without UNDEFINED,
+// followed by the formats of extensionFormatSets that version or
+// the device extensions provide, in ascending order.
+func knownFormats(version uint32, extensions []string) []vk.Format {
+	formats := make([]vk.Format, 0, len(formatNames)+len(extensionFormatNames))
+	for format := vk.Format(1); int(format) < len(formatNames); format++ {
+		formats = append(formats, format)
+	}
+	for _, set := range extensionFormatSets {
+		if (set.core == 0 || version < set.core) && !hasString(extensions, set.extension) {
+			continue
+		}
+		for format := set.first; format <= set.last; format++ {
+			formats = append(formats, format)
+		}
+	}
+	return formats
+}
+
+// getFormats queries the formats the device knows of, see knownFormats,
+// and returns those supporting at least one feature.
+func getFormats(gpu vk.PhysicalDevice, version uint32, extensions []string) []FormatReport {
+	var formats []FormatReport
+	for _, format := range knownFormats(version, extensions) {
+		var formatProps vk.FormatProperties
+		vk.GetPhysicalDeviceFormatProperties(gpu, format, &formatProps)
+		formatProps.Deref()
+		if formatProps.LinearTilingFeatures == 0 &&
+			formatProps.OptimalTilingFeatures == 0 &&
+			formatProps.BufferFeatures == 0 {
+			continue
+		}
+		formats = append(formats, FormatReport{
+			Format:  FormatName(format),
+			Value:   int32(format),
+			Linear:  flagNames(uint32(formatProps.LinearTilingFeatures), formatFeatureFlagNames),
+			Optimal: flagNames(uint32(formatProps.OptimalTilingFeatures), formatFeatureFlagNames),
+			Buffer:  flagNames(uint32(formatProps.BufferFeatures), formatFeatureFlagNames),
+		})
+	}
+	return formats
+}
+
+func getSurfaceFormats(gpu vk.PhysicalDevice, surface vk.Surface) []SurfaceFormatReport {
+	var formatCount uint32
+	vk.GetPhysicalDeviceSurfaceFormats(gpu, surface, &formatCount, nil)
+	surfaceFormats := make([]vk.SurfaceFormat, formatCount)
+	vk.GetPhysicalDeviceSurfaceFormats(gpu, surface, &formatCount, surfaceFormats)
+
+	formats := make([]SurfaceFormatReport, 0, formatCount)
+	for _, surfaceFormat := range surfaceFormats[:formatCount] {
+		surfaceFormat.Deref()
+		formats = append(formats, SurfaceFormatReport{
+			Format:     FormatName(surfaceFormat.Format),
+			ColorSpace: ColorSpaceName(surfaceFormat.ColorSpace),
+		})
+	}
+	return formats
+}
+
+func getPresentModes(gpu vk.PhysicalDevice, surface vk.Surface) []string {
+	var modeCount uint32
+	vk.GetPhysicalDeviceSurfacePresentModes(gpu, surface, &modeCount, nil)
+	presentModes := make([]vk.PresentMode, modeCount)
+	vk.GetPhysicalDeviceSurfacePresentModes(gpu, surface, &modeCount, presentModes)
+
+	modes := make([]string, 0, modeCount)
+	for _, mode := range presentModes[:modeCount] {
+		modes = append(modes, PresentModeName(mode))
+	}
+	return modes
+}
+
+func addFormatRows(table *tablewriter.Table, dev *DeviceReport) {
+	table.AddSeparator()
+	table.AddRow("FORMATS", "linear / optimal / buffer")
+	for _, format := range dev.Formats {
+		table.AddRow(format.Format, fmt.Sprintf("%s / %s / %s",
+			featureList(format.Linear), featureList(format.Optimal), featureList(format.Buffer)))
+	}
+}
+
+func featureList(features []string) string {
+	if len(features) == 0 {
+		return "-"
+	}
+	return strings.Join(features, ",")
+}
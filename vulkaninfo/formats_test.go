@@ -0,0 +1,53 @@
+package vulkaninfo
+
+import (
+	"testing"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+func TestKnownFormats(t *testing.T) {
+	const (
+		pvrtc = vk.Format(1000054000)
+		ycbcr = vk.Format(1000156000)
+		a4444 = vk.Format(1000340000)
+	)
+	cases := []struct {
+		name       string
+		version    uint32
+		extensions []string
+		want       []vk.Format
+		wantNot    []vk.Format
+	}{
+		{"1.0", vk.MakeVersion(1, 0, 0), nil, nil, []vk.Format{pvrtc, ycbcr, a4444}},
+		{"1.0 with extensions", vk.MakeVersion(1, 0, 0),
+			[]string{"VK_IMG_format_pvrtc", "VK_KHR_sampler_ycbcr_conversion"},
+			[]vk.Format{pvrtc, ycbcr}, []vk.Format{a4444}},
+		{"1.1", vk.MakeVersion(1, 1, 0), nil, []vk.Format{ycbcr}, []vk.Format{pvrtc, a4444}},
+		{"1.3", vk.MakeVersion(1, 3, 0), nil, []vk.Format{ycbcr, a4444}, []vk.Format{pvrtc}},
+	}
+	for _, c := range cases {
+		formats := make(map[vk.Format]bool)
+		last := vk.FormatUndefined
+		for _, format := range knownFormats(c.version, c.extensions) {
+			if format <= last {
+				t.Errorf("%s: %s follows %s", c.name, FormatName(format), FormatName(last))
+			}
+			last = format
+			formats[format] = true
+		}
+		if !formats[vk.FormatR8g8b8a8Unorm] {
+			t.Errorf("%s: core format R8G8B8A8_UNORM is missing", c.name)
+		}
+		for _, format := range c.want {
+			if !formats[format] {
+				t.Errorf("%s: %s is missing", c.name, FormatName(format))
+			}
+		}
+		for _, format := range c.wantNot {
+			if formats[format] {
+				t.Errorf("%s: %s is queried without its extension", c.name, FormatName(format))
+			}
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package vulkaninfo
+
+/*
+#include <stddef.h>
+#include <stdint.h>
+#include <stdlib.h>
+
+// C layout of VkPhysicalDeviceMaintenance3Properties,
+// physicalDeviceMaintenance3Properties is checked against it.
+typedef struct {
+	int32_t  sType;
+	void*    pNext;
+	uint32_t maxPerSetDescriptors;
+	uint64_t maxMemoryAllocationSize;
+} maintenance3Properties;
+
+enum {
+	maintenance3Padding = offsetof(maintenance3Properties, maxMemoryAllocationSize) -
+		offsetof(maintenance3Properties, maxPerSetDescriptors) - sizeof(uint32_t),
+};
+
+static size_t maintenance3AllocationSizeOffset() {
+	return offsetof(maintenance3Properties, maxMemoryAllocationSize);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	vk "github.com/vulkan-go/vulkan"
+	"github.com/xlab/tablewriter"
+)
+
+// Structure types of the extended structs, they are chained
+// into vkGetPhysicalDeviceProperties2 and vkGetPhysicalDeviceFeatures2.
+const (
+	structureTypePhysicalDeviceIDProperties                 vk.StructureType = 1000071004
+	structureTypePhysicalDeviceSubgroupProperties           vk.StructureType = 1000094000
+	structureTypePhysicalDeviceDescriptorIndexingFeatures   vk.StructureType = 1000161001
+	structureTypePhysicalDeviceDescriptorIndexingProperties vk.StructureType = 1000161002
+	structureTypePhysicalDeviceMaintenance3Properties       vk.StructureType = 1000168000
+	structureTypePhysicalDeviceDriverProperties             vk.StructureType = 1000196000
+)
+
+// The structs below mirror the C layout of their Vulkan counterparts,
+// the driver fills them in C memory allocated by structChain.
+
+type physicalDeviceIDProperties struct {
+	sType           vk.StructureType
+	pNext           unsafe.Pointer
+	DeviceUUID      [16]uint8
+	DriverUUID      [16]uint8
+	DeviceLUID      [8]uint8
+	DeviceNodeMask  uint32
+	DeviceLUIDValid vk.Bool32
+}
+
+type physicalDeviceSubgroupProperties struct {
+	sType                     vk.StructureType
+	pNext                     unsafe.Pointer
+	SubgroupSize              uint32
+	SupportedStages           uint32
+	SupportedOperations       uint32
+	QuadOperationsInAllStages vk.Bool32
+}
+
+// physicalDeviceMaintenance3Properties pads MaxMemoryAllocationSize as C does:
+// Go aligns uint64 to 4 bytes on 32-bit platforms, C to 8 bytes on 32-bit ARM.
+type physicalDeviceMaintenance3Properties struct {
+	sType                   vk.StructureType
+	pNext                   unsafe.Pointer
+	MaxPerSetDescriptors    uint32
+	_                       [C.maintenance3Padding]byte
+	MaxMemoryAllocationSize uint64
+}
+
+// layoutMismatches compares the mirrors that have 64-bit members
+// with the C layout on this platform.
+func layoutMismatches() []string {
+	var mismatches []string
+	var m3 physicalDeviceMaintenance3Properties
+	if size := unsafe.Sizeof(m3); size != C.sizeof_maintenance3Properties {
+		mismatches = append(mismatches, fmt.Sprintf("VkPhysicalDeviceMaintenance3Properties is %d bytes, %d in C",
+			size, C.sizeof_maintenance3Properties))
+	}
+	if offset := unsafe.Offsetof(m3.MaxMemoryAllocationSize); offset != uintptr(C.maintenance3AllocationSizeOffset()) {
+		mismatches = append(mismatches, fmt.Sprintf("maxMemoryAllocationSize is at offset %d, %d in C",
+			offset, C.maintenance3AllocationSizeOffset()))
+	}
+	return mismatches
+}
+
+type physicalDeviceDriverProperties struct {
+	sType              vk.StructureType
+	pNext              unsafe.Pointer
+	DriverID           uint32
+	DriverName         [256]byte
+	DriverInfo         [256]byte
+	ConformanceVersion [4]uint8
+}
+
+type physicalDeviceDescriptorIndexingProperties struct {
+	sType                                                vk.StructureType
+	pNext                                                unsafe.Pointer
+	MaxUpdateAfterBindDescriptorsInAllPools              uint32
+	ShaderUniformBufferArrayNonUniformIndexingNative     vk.Bool32
+	ShaderSampledImageArrayNonUniformIndexingNative      vk.Bool32
+	ShaderStorageBufferArrayNonUniformIndexingNative     vk.Bool32
+	ShaderStorageImageArrayNonUniformIndexingNative      vk.Bool32
+	ShaderInputAttachmentArrayNonUniformIndexingNative   vk.Bool32
+	RobustBufferAccessUpdateAfterBind                    vk.Bool32
+	QuadDivergentImplicitLod                             vk.Bool32
+	MaxPerStageDescriptorUpdateAfterBindSamplers         uint32
+	MaxPerStageDescriptorUpdateAfterBindUniformBuffers   uint32
+	MaxPerStageDescriptorUpdateAfterBindStorageBuffers   uint32
+	MaxPerStageDescriptorUpdateAfterBindSampledImages    uint32
+	MaxPerStageDescriptorUpdateAfterBindStorageImages    uint32
+	MaxPerStageDescriptorUpdateAfterBindInputAttachments uint32
+	MaxPerStageUpdateAfterBindResources                  uint32
+	MaxDescriptorSetUpdateAfterBindSamplers              uint32
+	MaxDescriptorSetUpdateAfterBindUniformBuffers        uint32
+	MaxDescriptorSetUpdateAfterBindUniformBuffersDynamic uint32
+	MaxDescriptorSetUpdateAfterBindStorageBuffers        uint32
+	MaxDescriptorSetUpdateAfterBindStorageBuffersDynamic uint32
+	MaxDescriptorSetUpdateAfterBindSampledImages         uint32
+	MaxDescriptorSetUpdateAfterBindStorageImages         uint32
+	MaxDescriptorSetUpdateAfterBindInputAttachments      uint32
+}
+
+type physicalDeviceDescriptorIndexingFeatures struct {
+	sType                                              vk.StructureType
+	pNext                                              unsafe.Pointer
+	ShaderInputAttachmentArrayDynamicIndexing          vk.Bool32
+	ShaderUniformTexelBufferArrayDynamicIndexing       vk.Bool32
+	ShaderStorageTexelBufferArrayDynamicIndexing       vk.Bool32
+	ShaderUniformBufferArrayNonUniformIndexing         vk.Bool32
+	ShaderSampledImageArrayNonUniformIndexing          vk.Bool32
+	ShaderStorageBufferArrayNonUniformIndexing         vk.Bool32
+	ShaderStorageImageArrayNonUniformIndexing          vk.Bool32
+	ShaderInputAttachmentArrayNonUniformIndexing       vk.Bool32
+	ShaderUniformTexelBufferArrayNonUniformIndexing    vk.Bool32
+	ShaderStorageTexelBufferArrayNonUniformIndexing    vk.Bool32
+	DescriptorBindingUniformBufferUpdateAfterBind      vk.Bool32
+	DescriptorBindingSampledImageUpdateAfterBind       vk.Bool32
+	DescriptorBindingStorageImageUpdateAfterBind       vk.Bool32
+	DescriptorBindingStorageBufferUpdateAfterBind      vk.Bool32
+	DescriptorBindingUniformTexelBufferUpdateAfterBind vk.Bool32
+	DescriptorBindingStorageTexelBufferUpdateAfterBind vk.Bool32
+	DescriptorBindingUpdateUnusedWhilePending          vk.Bool32
+	DescriptorBindingPartiallyBound                    vk.Bool32
+	DescriptorBindingVariableDescriptorCount           vk.Bool32
+	RuntimeDescriptorArray                             vk.Bool32
+}
+
+// chainHeader is the common head of all extended structs.
+type chainHeader struct {
+	sType vk.StructureType
+	pNext unsafe.Pointer
+}
+
+// structChain builds a pNext chain in C memory, so the pointers
+// handed over to Vulkan never point into the Go heap.
+type structChain struct {
+	head unsafe.Pointer
+	mem  []unsafe.Pointer
+}
+
+// add allocates a zeroed struct of the given size and links it into the chain.
+func (c *structChain) add(sType vk.StructureType, size uintptr) unsafe.Pointer {
+	p := C.calloc(1, C.size_t(size))
+	header := (*chainHeader)(p)
+	header.sType = sType
+	header.pNext = c.head
+	c.head = p
+	c.mem = append(c.mem, p)
+	return p
+}
+
+func (c *structChain) free() {
+	for _, p := range c.mem {
+		C.free(p)
+	}
+	c.mem = nil
+	c.head = nil
+}
+
+var driverIDNames = map[uint32]string{
+	1:  "AMD_PROPRIETARY",
+	2:  "AMD_OPEN_SOURCE",
+	3:  "MESA_RADV",
+	4:  "NVIDIA_PROPRIETARY",
+	5:  "INTEL_PROPRIETARY_WINDOWS",
+	6:  "INTEL_OPEN_SOURCE_MESA",
+	7:  "IMAGINATION_PROPRIETARY",
+	8:  "QUALCOMM_PROPRIETARY",
+	9:  "ARM_PROPRIETARY",
+	10: "GOOGLE_SWIFTSHADER",
+	11: "GGP_PROPRIETARY",
+	12: "BROADCOM_PROPRIETARY",
+	13: "MESA_LLVMPIPE",
+	14: "MOLTENVK",
+	15: "COREAVI_PROPRIETARY",
+	16: "JUICE_PROPRIETARY",
+	17: "VERISILICON_PROPRIETARY",
+	18: "MESA_TURNIP",
+	19: "MESA_V3DV",
+	20: "MESA_PANVK",
+	21: "SAMSUNG_PROPRIETARY",
+	22: "MESA_VENUS",
+	23: "MESA_DOZEN",
+	24: "MESA_NVK",
+	25: "IMAGINATION_OPEN_SOURCE_MESA",
+}
+
+var shaderStageFlagNames = []flagName{
+	{uint32(vk.ShaderStageVertexBit), "VERTEX"},
+	{uint32(vk.ShaderStageTessellationControlBit), "TESSELLATION_CONTROL"},
+	{uint32(vk.ShaderStageTessellationEvaluationBit), "TESSELLATION_EVALUATION"},
+	{uint32(vk.ShaderStageGeometryBit), "GEOMETRY"},
+	{uint32(vk.ShaderStageFragmentBit), "FRAGMENT"},
+	{uint32(vk.ShaderStageComputeBit), "COMPUTE"},
+}
+
+var subgroupFeatureFlagNames = []flagName{
+	{0x01, "BASIC"},
+	{0x02, "VOTE"},
+	{0x04, "ARITHMETIC"},
+	{0x08, "BALLOT"},
+	{0x10, "SHUFFLE"},
+	{0x20, "SHUFFLE_RELATIVE"},
+	{0x40, "CLUSTERED"},
+	{0x80, "QUAD"},
+}
+
+// getInstanceVersion reports the version of the Vulkan loader,
+// a 1.0 loader cannot tell and is assumed.
+func getInstanceVersion() uint32 {
+	var version uint32
+	if vk.EnumerateInstanceVersion(&version) != vk.Success {
+		return vk.MakeVersion(1, 0, 0)
+	}
+	return version
+}
+
+// getExtendedProperties queries the structs chained to
+// vkGetPhysicalDeviceProperties2 and vkGetPhysicalDeviceFeatures2.
+// It needs both the instance and the device to be at least Vulkan 1.1,
+// the structs promoted later are queried when the device version
+// or its extensions allow that.
+func getExtendedProperties(gpu vk.PhysicalDevice, instanceVersion, deviceVersion uint32,
+	extensions []string) map[string]map[string]interface{} {
+
+	version := deviceVersion
+	if instanceVersion < version {
+		version = instanceVersion
+	}
+	if version < vk.MakeVersion(1, 1, 0) {
+		return nil
+	}
+	vulkan12 := version >= vk.MakeVersion(1, 2, 0)
+	hasDriverProperties := vulkan12 || hasString(extensions, "VK_KHR_driver_properties")
+	hasDescriptorIndexing := vulkan12 || hasString(extensions, "VK_EXT_descriptor_indexing")
+
+	props := &structChain{}
+	defer props.free()
+	id := (*physicalDeviceIDProperties)(props.add(structureTypePhysicalDeviceIDProperties,
+		unsafe.Sizeof(physicalDeviceIDProperties{})))
+	subgroup := (*physicalDeviceSubgroupProperties)(props.add(structureTypePhysicalDeviceSubgroupProperties,
+		unsafe.Sizeof(physicalDeviceSubgroupProperties{})))
+	maintenance3 := (*physicalDeviceMaintenance3Properties)(props.add(structureTypePhysicalDeviceMaintenance3Properties,
+		unsafe.Sizeof(physicalDeviceMaintenance3Properties{})))
+	var driver *physicalDeviceDriverProperties
+	if hasDriverProperties {
+		driver = (*physicalDeviceDriverProperties)(props.add(structureTypePhysicalDeviceDriverProperties,
+			unsafe.Sizeof(physicalDeviceDriverProperties{})))
+	}
+	var indexing *physicalDeviceDescriptorIndexingProperties
+	if hasDescriptorIndexing {
+		indexing = (*physicalDeviceDescriptorIndexingProperties)(props.add(structureTypePhysicalDeviceDescriptorIndexingProperties,
+			unsafe.Sizeof(physicalDeviceDescriptorIndexingProperties{})))
+	}
+	properties2 := vk.PhysicalDeviceProperties2{
+		SType: vk.StructureTypePhysicalDeviceProperties2,
+		PNext: props.head,
+	}
+	vk.GetPhysicalDeviceProperties2(gpu, &properties2)
+	properties2.Free()
+
+	extended := map[string]map[string]interface{}{
+		"idProperties":           structValues(reflect.ValueOf(*id)),
+		"subgroupProperties":     structValues(reflect.ValueOf(*subgroup)),
+		"maintenance3Properties": structValues(reflect.ValueOf(*maintenance3)),
+	}
+	extended["subgroupProperties"]["supportedStages"] = flagNames(subgroup.SupportedStages, shaderStageFlagNames)
+	extended["subgroupProperties"]["supportedOperations"] = flagNames(subgroup.SupportedOperations, subgroupFeatureFlagNames)
+	if driver != nil {
+		values := structValues(reflect.ValueOf(*driver))
+		values["driverID"] = fmt.Sprintf("%d", driver.DriverID)
+		if name, ok := driverIDNames[driver.DriverID]; ok {
+			values["driverID"] = name
+		}
+		v := driver.ConformanceVersion
+		values["conformanceVersion"] = fmt.Sprintf("%d.%d.%d.%d", v[0], v[1], v[2], v[3])
+		extended["driverProperties"] = values
+	}
+	if indexing != nil {
+		extended["descriptorIndexingProperties"] = structValues(reflect.ValueOf(*indexing))
+
+		features := &structChain{}
+		defer features.free()
+		indexingFeatures := (*physicalDeviceDescriptorIndexingFeatures)(features.add(structureTypePhysicalDeviceDescriptorIndexingFeatures,
+			unsafe.Sizeof(physicalDeviceDescriptorIndexingFeatures{})))
+		features2 := vk.PhysicalDeviceFeatures2{
+			SType: vk.StructureTypePhysicalDeviceFeatures2,
+			PNext: features.head,
+		}
+		vk.GetPhysicalDeviceFeatures2(gpu, &features2)
+		features2.Free()
+		extended["descriptorIndexingFeatures"] = structValues(reflect.ValueOf(*indexingFeatures))
+	}
+	return extended
+}
+
+func addExtendedRows(table *tablewriter.Table, dev *DeviceReport) {
+	if len(dev.Extended) == 0 {
+		return
+	}
+	table.AddSeparator()
+	table.AddRow("EXTENDED PROPERTIES", "")
+	for _, section := range sortedKeys(dev.Extended) {
+		values := dev.Extended[section]
+		for _, name := range sortedKeys(values) {
+			table.AddRow(section+"."+name, fmt.Sprint(values[name]))
+		}
+	}
+}
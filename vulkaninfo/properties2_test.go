@@ -0,0 +1,9 @@
+package vulkaninfo
+
+import "testing"
+
+func TestStructLayout(t *testing.T) {
+	for _, m := range layoutMismatches() {
+		t.Error(m)
+	}
+}
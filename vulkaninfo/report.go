@@ -0,0 +1,298 @@
+package vulkaninfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/vulkan-go/demos/vulkanutil"
+	vk "github.com/vulkan-go/vulkan"
+	"gopkg.in/yaml.v2"
+)
+
+// Output formats supported by WriteReport.
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+)
+
+// Report is a machine-readable snapshot of the Vulkan environment,
+// it carries the same data PrintInfo renders as a table.
+type Report struct {
+	InstanceVersion string `json:"instanceVersion" yaml:"instanceVersion"`
+	// SelectedDevice is the index of the device NewVulkanDevice picked.
+	SelectedDevice     int            `json:"selectedDevice" yaml:"selectedDevice"`
+	Devices            []DeviceReport `json:"devices" yaml:"devices"`
+	InstanceExtensions []string       `json:"instanceExtensions" yaml:"instanceExtensions"`
+	InstanceLayers     []string       `json:"instanceLayers" yaml:"instanceLayers"`
+
+	// InstanceLayerDetails describes each of InstanceLayers.
+	InstanceLayerDetails []LayerReport `json:"instanceLayerDetails" yaml:"instanceLayerDetails"`
+	Errors               []ReportError `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// LayerReport describes a layer and the extensions it provides.
+type LayerReport struct {
+	Name                  string   `json:"name" yaml:"name"`
+	SpecVersion           string   `json:"specVersion" yaml:"specVersion"`
+	ImplementationVersion uint32   `json:"implementationVersion" yaml:"implementationVersion"`
+	Description           string   `json:"description" yaml:"description"`
+	Extensions            []string `json:"extensions" yaml:"extensions"`
+	// Error is set when the layer extensions could not be enumerated.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Report sections that may fail to enumerate.
+const (
+	SectionInstanceExtensions = "instance extensions"
+	SectionInstanceLayers     = "instance layers"
+	SectionDeviceExtensions   = "device extensions"
+	SectionDeviceLayers       = "device layers"
+)
+
+// ReportError is a partial failure, the report section
+// it belongs to is left incomplete.
+type ReportError struct {
+	Section string `json:"section" yaml:"section"`
+	Error   string `json:"error" yaml:"error"`
+}
+
+// DeviceReport describes a physical device.
+type DeviceReport struct {
+	Index         int            `json:"index" yaml:"index"`
+	Name          string         `json:"name" yaml:"name"`
+	VendorID      uint32         `json:"vendorID" yaml:"vendorID"`
+	DeviceID      uint32         `json:"deviceID" yaml:"deviceID"`
+	Type          string         `json:"type" yaml:"type"`
+	APIVersion    string         `json:"apiVersion" yaml:"apiVersion"`
+	DriverVersion string         `json:"driverVersion" yaml:"driverVersion"`
+	Surface       *SurfaceReport `json:"surface,omitempty" yaml:"surface,omitempty"`
+	Extensions    []string       `json:"extensions" yaml:"extensions"`
+	Layers        []string       `json:"layers" yaml:"layers"`
+	LayerDetails  []LayerReport  `json:"layerDetails" yaml:"layerDetails"`
+	Errors        []ReportError  `json:"errors,omitempty" yaml:"errors,omitempty"`
+
+	// Limits and Features are keyed by the member names of
+	// VkPhysicalDeviceLimits and VkPhysicalDeviceFeatures.
+	Limits        map[string]interface{} `json:"limits" yaml:"limits"`
+	Features      map[string]bool        `json:"features" yaml:"features"`
+	MemoryHeaps   []MemoryHeapReport     `json:"memoryHeaps" yaml:"memoryHeaps"`
+	MemoryTypes   []MemoryTypeReport     `json:"memoryTypes" yaml:"memoryTypes"`
+	QueueFamilies []QueueFamilyReport    `json:"queueFamilies" yaml:"queueFamilies"`
+	Formats       []FormatReport         `json:"formats" yaml:"formats"`
+
+	// Extended holds the Vulkan 1.1+ structs queried through
+	// vkGetPhysicalDeviceProperties2, such as driverProperties,
+	// subgroupProperties and descriptorIndexingProperties.
+	Extended map[string]map[string]interface{} `json:"extended,omitempty" yaml:"extended,omitempty"`
+}
+
+// SurfaceReport describes the surface capabilities of a physical device.
+type SurfaceReport struct {
+	MinImageCount       uint32 `json:"minImageCount" yaml:"minImageCount"`
+	MaxImageCount       uint32 `json:"maxImageCount" yaml:"maxImageCount"`
+	MaxImageArrayLayers uint32 `json:"maxImageArrayLayers" yaml:"maxImageArrayLayers"`
+	CurrentExtent       Extent `json:"currentExtent" yaml:"currentExtent"`
+	MinImageExtent      Extent `json:"minImageExtent" yaml:"minImageExtent"`
+	MaxImageExtent      Extent `json:"maxImageExtent" yaml:"maxImageExtent"`
+	SupportedUsageFlags uint32 `json:"supportedUsageFlags" yaml:"supportedUsageFlags"`
+	CurrentTransform    uint32 `json:"currentTransform" yaml:"currentTransform"`
+	SupportedTransforms uint32 `json:"supportedTransforms" yaml:"supportedTransforms"`
+	FormatCount         uint32 `json:"formatCount" yaml:"formatCount"`
+
+	Formats      []SurfaceFormatReport `json:"formats" yaml:"formats"`
+	PresentModes []string              `json:"presentModes" yaml:"presentModes"`
+}
+
+type Extent struct {
+	Width  uint32 `json:"width" yaml:"width"`
+	Height uint32 `json:"height" yaml:"height"`
+}
+
+// NewReport collects the report for all physical devices. Enumeration failures
+// do not stop the collection, they are recorded in the report and returned.
+func NewReport(v *VulkanDeviceInfo) (*Report, []error) {
+	r := &Report{
+		InstanceVersion: vk.Version(v.instanceVersion).String(),
+		SelectedDevice:  v.gpu.Index,
+	}
+	var err error
+	if r.InstanceExtensions, err = getInstanceExtensions(""); err != nil {
+		r.Errors = appendError(r.Errors, SectionInstanceExtensions, err)
+	}
+	if r.InstanceLayerDetails, err = getInstanceLayers(); err != nil {
+		r.Errors = appendError(r.Errors, SectionInstanceLayers, err)
+	}
+	r.InstanceLayers = layerNames(r.InstanceLayerDetails)
+	for i, gpu := range v.gpuDevices {
+		r.Devices = append(r.Devices, newDeviceReport(i, gpu, v.surface, v.instanceVersion))
+	}
+	return r, r.Failures()
+}
+
+// Failures lists the partial failures recorded in the report.
+func (r *Report) Failures() []error {
+	var errs []error
+	for _, e := range r.Errors {
+		errs = append(errs, fmt.Errorf("%s: %s", e.Section, e.Error))
+	}
+	for _, layer := range r.InstanceLayerDetails {
+		if len(layer.Error) > 0 {
+			errs = append(errs, fmt.Errorf("%s: %s: %s", SectionInstanceLayers, layer.Name, layer.Error))
+		}
+	}
+	for _, dev := range r.Devices {
+		for _, e := range dev.Errors {
+			errs = append(errs, fmt.Errorf("device %d: %s: %s", dev.Index, e.Section, e.Error))
+		}
+		for _, layer := range dev.LayerDetails {
+			if len(layer.Error) > 0 {
+				errs = append(errs, fmt.Errorf("device %d: %s: %s: %s",
+					dev.Index, SectionDeviceLayers, layer.Name, layer.Error))
+			}
+		}
+	}
+	return errs
+}
+
+// Selected returns the report of the device NewVulkanDevice picked.
+func (r *Report) Selected() *DeviceReport {
+	if r.SelectedDevice < 0 || r.SelectedDevice >= len(r.Devices) {
+		return nil
+	}
+	return &r.Devices[r.SelectedDevice]
+}
+
+func newDeviceReport(idx int, gpu vk.PhysicalDevice, surface vk.Surface, instanceVersion uint32) DeviceReport {
+	var gpuProperties vk.PhysicalDeviceProperties
+	vk.GetPhysicalDeviceProperties(gpu, &gpuProperties)
+	gpuProperties.Deref()
+
+	dev := DeviceReport{
+		Index:         idx,
+		Name:          vk.ToString(gpuProperties.DeviceName[:]),
+		VendorID:      gpuProperties.VendorID,
+		DeviceID:      gpuProperties.DeviceID,
+		Type:          vulkanutil.DeviceTypeName(gpuProperties.DeviceType),
+		APIVersion:    vk.Version(gpuProperties.ApiVersion).String(),
+		DriverVersion: vk.Version(gpuProperties.DriverVersion).String(),
+		Limits:        getLimits(&gpuProperties),
+		Features:      getFeatures(gpu),
+		QueueFamilies: getQueueFamilies(gpu),
+	}
+	var err error
+	if dev.Extensions, err = getDeviceExtensions(gpu, ""); err != nil {
+		dev.Errors = appendError(dev.Errors, SectionDeviceExtensions, err)
+	}
+	if dev.LayerDetails, err = getDeviceLayers(gpu); err != nil {
+		dev.Errors = appendError(dev.Errors, SectionDeviceLayers, err)
+	}
+	dev.Layers = layerNames(dev.LayerDetails)
+	formatVersion := gpuProperties.ApiVersion
+	if instanceVersion < formatVersion {
+		formatVersion = instanceVersion
+	}
+	dev.Formats = getFormats(gpu, formatVersion, dev.Extensions)
+	dev.Extended = getExtendedProperties(gpu, instanceVersion, gpuProperties.ApiVersion, dev.Extensions)
+	dev.MemoryHeaps, dev.MemoryTypes = getMemory(gpu)
+	if surface != vk.NullSurface {
+		dev.Surface = newSurfaceReport(gpu, surface)
+	}
+	return dev
+}
+
+func layerNames(layers []LayerReport) []string {
+	var names []string
+	for _, layer := range layers {
+		names = append(names, layer.Name)
+	}
+	return names
+}
+
+func appendError(list []ReportError, section string, err error) []ReportError {
+	return append(list, ReportError{
+		Section: section,
+		Error:   err.Error(),
+	})
+}
+
+// sectionErrors returns the failures recorded for a section.
+func sectionErrors(list []ReportError, section string) []string {
+	var msgs []string
+	for _, e := range list {
+		if e.Section == section {
+			msgs = append(msgs, e.Error)
+		}
+	}
+	return msgs
+}
+
+func newSurfaceReport(gpu vk.PhysicalDevice, surface vk.Surface) *SurfaceReport {
+	var surfaceCapabilities vk.SurfaceCapabilities
+	vk.GetPhysicalDeviceSurfaceCapabilities(gpu, surface, &surfaceCapabilities)
+	surfaceCapabilities.Deref()
+	surfaceCapabilities.CurrentExtent.Deref()
+	surfaceCapabilities.MinImageExtent.Deref()
+	surfaceCapabilities.MaxImageExtent.Deref()
+
+	var formatCount uint32
+	vk.GetPhysicalDeviceSurfaceFormats(gpu, surface, &formatCount, nil)
+
+	return &SurfaceReport{
+		MinImageCount:       surfaceCapabilities.MinImageCount,
+		MaxImageCount:       surfaceCapabilities.MaxImageCount,
+		MaxImageArrayLayers: surfaceCapabilities.MaxImageArrayLayers,
+		CurrentExtent:       newExtent(surfaceCapabilities.CurrentExtent),
+		MinImageExtent:      newExtent(surfaceCapabilities.MinImageExtent),
+		MaxImageExtent:      newExtent(surfaceCapabilities.MaxImageExtent),
+		SupportedUsageFlags: uint32(surfaceCapabilities.SupportedUsageFlags),
+		CurrentTransform:    uint32(surfaceCapabilities.CurrentTransform),
+		SupportedTransforms: uint32(surfaceCapabilities.SupportedTransforms),
+		FormatCount:         formatCount,
+		Formats:             getSurfaceFormats(gpu, surface),
+		PresentModes:        getPresentModes(gpu, surface),
+	}
+}
+
+func newExtent(ext vk.Extent2D) Extent {
+	return Extent{
+		Width:  ext.Width,
+		Height: ext.Height,
+	}
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// WriteYAML writes the report as a YAML document.
+func (r *Report) WriteYAML(w io.Writer) error {
+	data, err := yaml.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// WriteReport writes the report to w using one of OutputTable, OutputJSON or OutputYAML.
+func WriteReport(w io.Writer, r *Report, format string) error {
+	switch format {
+	case OutputTable, "":
+		_, err := fmt.Fprintln(w, "\n\n"+r.Table())
+		return err
+	case OutputJSON:
+		return r.WriteJSON(w)
+	case OutputYAML:
+		return r.WriteYAML(w)
+	default:
+		return fmt.Errorf("vulkaninfo: unknown output format %q", format)
+	}
+}
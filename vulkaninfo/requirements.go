@@ -0,0 +1,382 @@
+package vulkaninfo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Requirements describe what an application needs from the device,
+// see LoadRequirements for the file format.
+type Requirements struct {
+	APIVersion         string                       `json:"apiVersion"`
+	InstanceExtensions []string                     `json:"instanceExtensions"`
+	InstanceLayers     []string                     `json:"instanceLayers"`
+	Extensions         []string                     `json:"extensions"`
+	Features           []string                     `json:"features"`
+	Limits             map[string]interface{}       `json:"limits"`
+	Formats            map[string]FormatRequirement `json:"formats"`
+}
+
+// FormatRequirement lists the features needed for a format, using the
+// flag names of the vulkaninfo report, e.g. "SAMPLED_IMAGE".
+type FormatRequirement struct {
+	Linear  []string `json:"linear"`
+	Optimal []string `json:"optimal"`
+	Buffer  []string `json:"buffer"`
+}
+
+// LoadRequirements reads a requirements file, for example:
+//
+//	{
+//	    "apiVersion": "1.0.0",
+//	    "extensions": ["VK_KHR_swapchain"],
+//	    "features": ["samplerAnisotropy"],
+//	    "limits": {"maxImageDimension2D": 4096, "maxComputeWorkGroupCount": [65535, 1, 1]},
+//	    "formats": {"D32_SFLOAT": {"optimal": ["DEPTH_STENCIL_ATTACHMENT"]}}
+//	}
+//
+// The comparison of each limit is given by limitKinds: maximums like
+// maxImageDimension2D must be at least the required value, alignments and
+// granularities like bufferImageGranularity must not exceed it, ranges like
+// pointSizeRange must contain it, and the *SampleCounts masks must have all
+// of its bits.
+func LoadRequirements(path string) (*Requirements, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	req := &Requirements{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(req); err != nil {
+		err = fmt.Errorf("vulkaninfo: failed to read %s: %s", path, err)
+		return nil, err
+	}
+	return req, nil
+}
+
+// Unmet checks the selected device of the report and lists
+// the requirements it does not satisfy.
+func (req *Requirements) Unmet(r *Report) []string {
+	var unmet []string
+	for _, name := range req.InstanceExtensions {
+		if !hasString(r.InstanceExtensions, name) {
+			unmet = append(unmet, fmt.Sprintf("instance extension %s is not available", name))
+		}
+	}
+	for _, name := range req.InstanceLayers {
+		if !hasString(r.InstanceLayers, name) {
+			unmet = append(unmet, fmt.Sprintf("instance layer %s is not available", name))
+		}
+	}
+	dev := r.Selected()
+	if dev == nil {
+		return append(unmet, "no physical device selected")
+	}
+	if len(req.APIVersion) > 0 && compareVersions(dev.APIVersion, req.APIVersion) < 0 {
+		unmet = append(unmet, fmt.Sprintf("API version %s is below %s", dev.APIVersion, req.APIVersion))
+	}
+	for _, name := range req.Extensions {
+		if !hasString(dev.Extensions, name) {
+			unmet = append(unmet, fmt.Sprintf("device extension %s is not supported", name))
+		}
+	}
+	for _, name := range req.Features {
+		if enabled, ok := dev.Features[name]; !ok {
+			unmet = append(unmet, fmt.Sprintf("feature %s is unknown", name))
+		} else if !enabled {
+			unmet = append(unmet, fmt.Sprintf("feature %s is not supported", name))
+		}
+	}
+	for _, name := range sortedKeys(req.Limits) {
+		value, ok := dev.Limits[name]
+		if !ok {
+			unmet = append(unmet, fmt.Sprintf("limit %s is unknown", name))
+			continue
+		}
+		if !limitSatisfied(name, value, req.Limits[name]) {
+			unmet = append(unmet, fmt.Sprintf("limit %s is %v, need %v", name, value, req.Limits[name]))
+		}
+	}
+	for _, name := range sortedKeys(req.Formats) {
+		unmet = append(unmet, formatUnmet(name, req.Formats[name], dev.Formats)...)
+	}
+	return unmet
+}
+
+// Check implements the check command: it loads the requirements file
+// and prints the unmet items for the selected device of the report.
+// It reports whether all requirements are met.
+func Check(w io.Writer, path string, r *Report) (bool, error) {
+	req, err := LoadRequirements(path)
+	if err != nil {
+		return false, err
+	}
+	unmet := req.Unmet(r)
+	dev := r.Selected()
+	if len(unmet) == 0 {
+		_, err = fmt.Fprintf(w, "%s meets all requirements of %s\n", deviceName(dev), path)
+		return true, err
+	}
+	if _, err = fmt.Fprintf(w, "%s does not meet %d requirements of %s:\n",
+		deviceName(dev), len(unmet), path); err != nil {
+		return false, err
+	}
+	for _, item := range unmet {
+		if _, err = fmt.Fprintln(w, "  -", item); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func formatUnmet(name string, req FormatRequirement, formats []FormatReport) []string {
+	var format *FormatReport
+	for i := range formats {
+		if formats[i].Format == name {
+			format = &formats[i]
+			break
+		}
+	}
+	if format == nil {
+		return []string{fmt.Sprintf("format %s is not supported", name)}
+	}
+	var unmet []string
+	check := func(tiling string, need, have []string) {
+		for _, feature := range need {
+			if !hasString(have, feature) {
+				unmet = append(unmet, fmt.Sprintf("format %s lacks %s %s", name, tiling, feature))
+			}
+		}
+	}
+	check("linear", req.Linear, format.Linear)
+	check("optimal", req.Optimal, format.Optimal)
+	check("buffer", req.Buffer, format.Buffer)
+	return unmet
+}
+
+// limitKind tells how a device limit is compared with a required value.
+type limitKind int
+
+const (
+	// limitMax is a maximum the device supports, it must be at least the
+	// required value. Arrays like maxComputeWorkGroupCount are compared
+	// element by element.
+	limitMax limitKind = iota
+	// limitMin is a minimum, alignment or granularity the device needs,
+	// it must not exceed the required value.
+	limitMin
+	// limitRange is a [min, max] pair that must contain the required range.
+	limitRange
+	// limitSampleCounts is a VkSampleCountFlags mask that must have all of
+	// the required bits set.
+	limitSampleCounts
+	// limitFlag is a VkBool32 the device must set when it is required.
+	limitFlag
+)
+
+// limitKinds lists every member of VkPhysicalDeviceLimits by its spec name.
+// Precision bits and minMemoryMapAlignment, a guaranteed alignment of mapped
+// pointers, are better when larger. Limits missing here, e.g. those added by
+// newer headers, are compared as limitMax.
+var limitKinds = map[string]limitKind{
+	"maxImageDimension1D":                             limitMax,
+	"maxImageDimension2D":                             limitMax,
+	"maxImageDimension3D":                             limitMax,
+	"maxImageDimensionCube":                           limitMax,
+	"maxImageArrayLayers":                             limitMax,
+	"maxTexelBufferElements":                          limitMax,
+	"maxUniformBufferRange":                           limitMax,
+	"maxStorageBufferRange":                           limitMax,
+	"maxPushConstantsSize":                            limitMax,
+	"maxMemoryAllocationCount":                        limitMax,
+	"maxSamplerAllocationCount":                       limitMax,
+	"bufferImageGranularity":                          limitMin,
+	"sparseAddressSpaceSize":                          limitMax,
+	"maxBoundDescriptorSets":                          limitMax,
+	"maxPerStageDescriptorSamplers":                   limitMax,
+	"maxPerStageDescriptorUniformBuffers":             limitMax,
+	"maxPerStageDescriptorStorageBuffers":             limitMax,
+	"maxPerStageDescriptorSampledImages":              limitMax,
+	"maxPerStageDescriptorStorageImages":              limitMax,
+	"maxPerStageDescriptorInputAttachments":           limitMax,
+	"maxPerStageResources":                            limitMax,
+	"maxDescriptorSetSamplers":                        limitMax,
+	"maxDescriptorSetUniformBuffers":                  limitMax,
+	"maxDescriptorSetUniformBuffersDynamic":           limitMax,
+	"maxDescriptorSetStorageBuffers":                  limitMax,
+	"maxDescriptorSetStorageBuffersDynamic":           limitMax,
+	"maxDescriptorSetSampledImages":                   limitMax,
+	"maxDescriptorSetStorageImages":                   limitMax,
+	"maxDescriptorSetInputAttachments":                limitMax,
+	"maxVertexInputAttributes":                        limitMax,
+	"maxVertexInputBindings":                          limitMax,
+	"maxVertexInputAttributeOffset":                   limitMax,
+	"maxVertexInputBindingStride":                     limitMax,
+	"maxVertexOutputComponents":                       limitMax,
+	"maxTessellationGenerationLevel":                  limitMax,
+	"maxTessellationPatchSize":                        limitMax,
+	"maxTessellationControlPerVertexInputComponents":  limitMax,
+	"maxTessellationControlPerVertexOutputComponents": limitMax,
+	"maxTessellationControlPerPatchOutputComponents":  limitMax,
+	"maxTessellationControlTotalOutputComponents":     limitMax,
+	"maxTessellationEvaluationInputComponents":        limitMax,
+	"maxTessellationEvaluationOutputComponents":       limitMax,
+	"maxGeometryShaderInvocations":                    limitMax,
+	"maxGeometryInputComponents":                      limitMax,
+	"maxGeometryOutputComponents":                     limitMax,
+	"maxGeometryOutputVertices":                       limitMax,
+	"maxGeometryTotalOutputComponents":                limitMax,
+	"maxFragmentInputComponents":                      limitMax,
+	"maxFragmentOutputAttachments":                    limitMax,
+	"maxFragmentDualSrcAttachments":                   limitMax,
+	"maxFragmentCombinedOutputResources":              limitMax,
+	"maxComputeSharedMemorySize":                      limitMax,
+	"maxComputeWorkGroupCount":                        limitMax,
+	"maxComputeWorkGroupInvocations":                  limitMax,
+	"maxComputeWorkGroupSize":                         limitMax,
+	"subPixelPrecisionBits":                           limitMax,
+	"subTexelPrecisionBits":                           limitMax,
+	"mipmapPrecisionBits":                             limitMax,
+	"maxDrawIndexedIndexValue":                        limitMax,
+	"maxDrawIndirectCount":                            limitMax,
+	"maxSamplerLodBias":                               limitMax,
+	"maxSamplerAnisotropy":                            limitMax,
+	"maxViewports":                                    limitMax,
+	"maxViewportDimensions":                           limitMax,
+	"viewportBoundsRange":                             limitRange,
+	"viewportSubPixelBits":                            limitMax,
+	"minMemoryMapAlignment":                           limitMax,
+	"minTexelBufferOffsetAlignment":                   limitMin,
+	"minUniformBufferOffsetAlignment":                 limitMin,
+	"minStorageBufferOffsetAlignment":                 limitMin,
+	"minTexelOffset":                                  limitMin,
+	"maxTexelOffset":                                  limitMax,
+	"minTexelGatherOffset":                            limitMin,
+	"maxTexelGatherOffset":                            limitMax,
+	"minInterpolationOffset":                          limitMin,
+	"maxInterpolationOffset":                          limitMax,
+	"subPixelInterpolationOffsetBits":                 limitMax,
+	"maxFramebufferWidth":                             limitMax,
+	"maxFramebufferHeight":                            limitMax,
+	"maxFramebufferLayers":                            limitMax,
+	"framebufferColorSampleCounts":                    limitSampleCounts,
+	"framebufferDepthSampleCounts":                    limitSampleCounts,
+	"framebufferStencilSampleCounts":                  limitSampleCounts,
+	"framebufferNoAttachmentsSampleCounts":            limitSampleCounts,
+	"maxColorAttachments":                             limitMax,
+	"sampledImageColorSampleCounts":                   limitSampleCounts,
+	"sampledImageIntegerSampleCounts":                 limitSampleCounts,
+	"sampledImageDepthSampleCounts":                   limitSampleCounts,
+	"sampledImageStencilSampleCounts":                 limitSampleCounts,
+	"storageImageSampleCounts":                        limitSampleCounts,
+	"maxSampleMaskWords":                              limitMax,
+	"timestampComputeAndGraphics":                     limitFlag,
+	"timestampPeriod":                                 limitMin,
+	"maxClipDistances":                                limitMax,
+	"maxCullDistances":                                limitMax,
+	"maxCombinedClipAndCullDistances":                 limitMax,
+	"discreteQueuePriorities":                         limitMax,
+	"pointSizeRange":                                  limitRange,
+	"lineWidthRange":                                  limitRange,
+	"pointSizeGranularity":                            limitMin,
+	"lineWidthGranularity":                            limitMin,
+	"strictLines":                                     limitFlag,
+	"standardSampleLocations":                         limitFlag,
+	"optimalBufferCopyOffsetAlignment":                limitMin,
+	"optimalBufferCopyRowPitchAlignment":              limitMin,
+	"nonCoherentAtomSize":                             limitMin,
+}
+
+func limitSatisfied(name string, value, need interface{}) bool {
+	kind := limitKinds[name]
+	values, isList := value.([]interface{})
+	needs, needList := need.([]interface{})
+	if isList != needList {
+		return false
+	}
+	if isList {
+		if len(values) != len(needs) {
+			return false
+		}
+		if kind == limitRange {
+			return len(values) == 2 &&
+				compareLimit(limitMin, values[0], needs[0]) &&
+				compareLimit(limitMax, values[1], needs[1])
+		}
+		for i := range values {
+			if !compareLimit(kind, values[i], needs[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return compareLimit(kind, value, need)
+}
+
+func compareLimit(kind limitKind, value, need interface{}) bool {
+	if b, ok := value.(bool); ok {
+		needB, ok := need.(bool)
+		return ok && (b || !needB)
+	}
+	v, ok1 := toFloat(value)
+	n, ok2 := toFloat(need)
+	if !ok1 || !ok2 {
+		return false
+	}
+	switch kind {
+	case limitMin:
+		return v <= n
+	case limitSampleCounts:
+		if n != float64(uint32(n)) {
+			return false
+		}
+		return uint32(n)&^uint32(v) == 0
+	}
+	return v >= n
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case uint64:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// compareVersions compares dotted version strings numerically.
+func compareVersions(a, b string) int {
+	partsA := strings.Split(a, ".")
+	partsB := strings.Split(b, ".")
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var x, y int
+		if i < len(partsA) {
+			x, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			y, _ = strconv.Atoi(partsB[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
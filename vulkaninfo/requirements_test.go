@@ -0,0 +1,101 @@
+package vulkaninfo
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// decodeNeed decodes a required value the way LoadRequirements does.
+func decodeNeed(t *testing.T, s string) interface{} {
+	var need interface{}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if err := dec.Decode(&need); err != nil {
+		t.Fatalf("bad required value %s: %s", s, err)
+	}
+	return need
+}
+
+func TestLimitSatisfied(t *testing.T) {
+	cases := []struct {
+		name  string
+		value interface{}
+		need  string
+		want  bool
+	}{
+		// maximums
+		{"maxImageDimension2D", uint64(16384), "4096", true},
+		{"maxImageDimension2D", uint64(2048), "4096", false},
+		{"maxSamplerAnisotropy", 16.0, "16", true},
+		{"maxComputeWorkGroupCount", []interface{}{uint64(65535), uint64(65535), uint64(65535)}, "[65535, 1, 1]", true},
+		{"maxComputeWorkGroupCount", []interface{}{uint64(65535), uint64(1), uint64(65535)}, "[65535, 64, 1]", false},
+		{"minMemoryMapAlignment", uint64(4096), "64", true},
+		{"subTexelPrecisionBits", uint64(4), "8", false},
+
+		// minimums, alignments and granularities without a min prefix
+		{"minUniformBufferOffsetAlignment", uint64(64), "256", true},
+		{"minUniformBufferOffsetAlignment", uint64(256), "64", false},
+		{"bufferImageGranularity", uint64(1024), "4096", true},
+		{"bufferImageGranularity", uint64(65536), "4096", false},
+		{"nonCoherentAtomSize", uint64(256), "64", false},
+		{"optimalBufferCopyOffsetAlignment", uint64(1), "4", true},
+		{"optimalBufferCopyRowPitchAlignment", uint64(128), "4", false},
+		{"lineWidthGranularity", 0.125, "0.5", true},
+		{"minTexelOffset", int64(-8), "-8", true},
+		{"minTexelOffset", int64(-4), "-8", false},
+
+		// ranges
+		{"pointSizeRange", []interface{}{1.0, 64.0}, "[1, 32]", true},
+		{"pointSizeRange", []interface{}{1.0, 16.0}, "[1, 32]", false},
+		{"lineWidthRange", []interface{}{1.0, 1.0}, "[0.5, 1]", false},
+		{"viewportBoundsRange", []interface{}{-32768.0, 32767.0}, "[-8192, 8191]", true},
+
+		// sample count masks
+		{"framebufferColorSampleCounts", uint64(0x5), "4", true},
+		{"framebufferColorSampleCounts", uint64(0x5), "2", false},
+		{"framebufferColorSampleCounts", uint64(0x8), "5", false},
+		{"sampledImageDepthSampleCounts", uint64(0xf), "5", true},
+
+		// flags
+		{"strictLines", true, "true", true},
+		{"strictLines", false, "true", false},
+		{"timestampComputeAndGraphics", false, "false", true},
+
+		// shape mismatches
+		{"maxViewportDimensions", uint64(4096), "[4096, 4096]", false},
+		{"maxImageDimension2D", uint64(4096), "\"4096\"", false},
+	}
+	for _, c := range cases {
+		got := limitSatisfied(c.name, c.value, decodeNeed(t, c.need))
+		if got != c.want {
+			t.Errorf("limitSatisfied(%s, %v, %s) = %v, want %v", c.name, c.value, c.need, got, c.want)
+		}
+	}
+}
+
+func TestUnmetLimits(t *testing.T) {
+	r := &Report{
+		Devices: []DeviceReport{{
+			Limits: map[string]interface{}{
+				"maxImageDimension2D":    uint64(4096),
+				"bufferImageGranularity": uint64(1024),
+			},
+		}},
+	}
+	req := &Requirements{
+		Limits: map[string]interface{}{
+			"maxImageDimension2D":    decodeNeed(t, "8192"),
+			"bufferImageGranularity": decodeNeed(t, "4096"),
+			"maxFooBar":              decodeNeed(t, "1"),
+		},
+	}
+	want := []string{
+		"limit maxFooBar is unknown",
+		"limit maxImageDimension2D is 4096, need 8192",
+	}
+	got := req.Unmet(r)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unmet = %q, want %q", got, want)
+	}
+}
@@ -2,24 +2,57 @@ package vulkaninfo
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/vulkan-go/demos/vulkanutil"
 	vk "github.com/vulkan-go/vulkan"
 	"github.com/xlab/tablewriter"
 )
 
 type VulkanDeviceInfo struct {
 	gpuDevices []vk.PhysicalDevice
+	gpu        vulkanutil.PhysicalDeviceInfo
+
+	instanceVersion uint32
 
 	instance vk.Instance
 	surface  vk.Surface
 	device   vk.Device
 }
 
-func NewVulkanDevice(appInfo *vk.ApplicationInfo, window uintptr) (*VulkanDeviceInfo, error) {
-	v := &VulkanDeviceInfo{}
+// NewVulkanDevice creates a logical device on the physical device chosen
+// by vulkanutil.SelectPhysicalDevice with the given filters.
+// A zero window gives a headless device without a surface,
+// so the info can be collected on machines without a display.
+//
+// The API version of appInfo is raised to the version of the loader,
+// so the Vulkan 1.1+ queries are available when the system supports them.
+func NewVulkanDevice(appInfo *vk.ApplicationInfo, window uintptr,
+	filters ...vulkanutil.DeviceFilter) (*VulkanDeviceInfo, error) {
+	v := &VulkanDeviceInfo{
+		instanceVersion: getInstanceVersion(),
+	}
+	if appInfo.ApiVersion < v.instanceVersion {
+		appInfo = &vk.ApplicationInfo{
+			SType:              vk.StructureTypeApplicationInfo,
+			PApplicationName:   appInfo.PApplicationName,
+			ApplicationVersion: appInfo.ApplicationVersion,
+			PEngineName:        appInfo.PEngineName,
+			EngineVersion:      appInfo.EngineVersion,
+			ApiVersion:         v.instanceVersion,
+		}
+	}
 
 	// step 1: create a Vulkan instance.
 	instanceExtensions := vk.GetRequiredInstanceExtensions()
+	if window == 0 {
+		// surface extensions are not needed, request only those available.
+		available, err := getInstanceExtensions("")
+		if err != nil {
+			return nil, err
+		}
+		instanceExtensions = availableExtensions(instanceExtensions, available)
+	}
 	instanceCreateInfo := &vk.InstanceCreateInfo{
 		SType:                   vk.StructureTypeInstanceCreateInfo,
 		PApplicationInfo:        appInfo,
@@ -35,28 +68,33 @@ func NewVulkanDevice(appInfo *vk.ApplicationInfo, window uintptr) (*VulkanDevice
 	}
 
 	// step 2: init the surface using the native window pointer.
-	err = vk.Error(vk.CreateWindowSurface(v.instance, window, nil, &v.surface))
-	if err != nil {
-		vk.DestroyInstance(v.instance, nil)
-		err = fmt.Errorf("vkCreateWindowSurface failed with %s", err)
-		return nil, err
+	if window != 0 {
+		err = vk.Error(vk.CreateWindowSurface(v.instance, window, nil, &v.surface))
+		if err != nil {
+			vk.DestroyInstance(v.instance, nil)
+			err = fmt.Errorf("vkCreateWindowSurface failed with %s", err)
+			return nil, err
+		}
 	}
 	if v.gpuDevices, err = getPhysicalDevices(v.instance); err != nil {
-		v.gpuDevices = nil
-		vk.DestroySurface(v.instance, v.surface, nil)
-		vk.DestroyInstance(v.instance, nil)
+		v.destroyInstance()
+		return nil, err
+	}
+	if v.gpu, err = vulkanutil.SelectPhysicalDevice(v.gpuDevices, filters...); err != nil {
+		v.destroyInstance()
 		return nil, err
 	}
 
-	// step 3: create a logical device from the first GPU available.
+	// step 3: create a logical device from the selected GPU,
+	// the swapchain extension is enabled when the device has it.
 	queueCreateInfos := []vk.DeviceQueueCreateInfo{{
 		SType:            vk.StructureTypeDeviceQueueCreateInfo,
 		QueueCount:       1,
 		PQueuePriorities: []float32{1.0},
 	}}
-	deviceExtensions := []string{
+	deviceExtensions := availableExtensions([]string{
 		"VK_KHR_swapchain\x00",
-	}
+	}, v.gpu.Extensions)
 	deviceCreateInfo := &vk.DeviceCreateInfo{
 		SType:                   vk.StructureTypeDeviceCreateInfo,
 		QueueCreateInfoCount:    uint32(len(queueCreateInfos)),
@@ -65,11 +103,9 @@ func NewVulkanDevice(appInfo *vk.ApplicationInfo, window uintptr) (*VulkanDevice
 		PpEnabledExtensionNames: deviceExtensions,
 	}
 	var device vk.Device
-	err = vk.Error(vk.CreateDevice(v.gpuDevices[0], deviceCreateInfo, nil, &device))
+	err = vk.Error(vk.CreateDevice(v.gpu.Device, deviceCreateInfo, nil, &device))
 	if err != nil {
-		v.gpuDevices = nil
-		vk.DestroySurface(v.instance, v.surface, nil)
-		vk.DestroyInstance(v.instance, nil)
+		v.destroyInstance()
 		err = fmt.Errorf("vkCreateDevice failed with %s", err)
 		return nil, err
 	} else {
@@ -79,16 +115,40 @@ func NewVulkanDevice(appInfo *vk.ApplicationInfo, window uintptr) (*VulkanDevice
 	return v, nil
 }
 
+// destroyInstance releases the surface and the instance
+// when NewVulkanDevice fails half way.
+func (v *VulkanDeviceInfo) destroyInstance() {
+	v.gpuDevices = nil
+	if v.surface != vk.NullSurface {
+		vk.DestroySurface(v.instance, v.surface, nil)
+	}
+	vk.DestroyInstance(v.instance, nil)
+}
+
 func (v *VulkanDeviceInfo) Destroy() {
 	if v == nil {
 		return
 	}
 	v.gpuDevices = nil
-	vk.DestroySurface(v.instance, v.surface, nil)
+	if v.surface != vk.NullSurface {
+		vk.DestroySurface(v.instance, v.surface, nil)
+	}
 	vk.DestroyDevice(v.device, nil)
 	vk.DestroyInstance(v.instance, nil)
 }
 
+// availableExtensions filters the NUL-terminated wanted names
+// down to those present in the list.
+func availableExtensions(wanted, available []string) []string {
+	var names []string
+	for _, name := range wanted {
+		if hasString(available, strings.TrimRight(name, "\x00")) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 func getPhysicalDevices(instance vk.Instance) ([]vk.PhysicalDevice, error) {
 	var gpuCount uint32
 	err := vk.Error(vk.EnumeratePhysicalDevices(instance, &gpuCount, nil))
@@ -109,178 +169,233 @@ func getPhysicalDevices(instance vk.Instance) ([]vk.PhysicalDevice, error) {
 	return gpuList, nil
 }
 
-func getInstanceLayers() (layerNames []string) {
+func getInstanceLayers() (layers []LayerReport, err error) {
 	var instanceLayerLen uint32
-	err := vk.EnumerateInstanceLayerProperties(&instanceLayerLen, nil)
-	orPanic(err)
+	err = vk.Error(vk.EnumerateInstanceLayerProperties(&instanceLayerLen, nil))
+	if err != nil {
+		err = fmt.Errorf("vkEnumerateInstanceLayerProperties failed with %s", err)
+		return nil, err
+	}
 	instanceLayers := make([]vk.LayerProperties, instanceLayerLen)
-	err = vk.EnumerateInstanceLayerProperties(&instanceLayerLen, instanceLayers)
-	orPanic(err)
-	for _, layer := range instanceLayers {
+	err = vk.Error(vk.EnumerateInstanceLayerProperties(&instanceLayerLen, instanceLayers))
+	if err != nil {
+		err = fmt.Errorf("vkEnumerateInstanceLayerProperties failed with %s", err)
+		return nil, err
+	}
+	for _, layer := range instanceLayers[:instanceLayerLen] {
 		layer.Deref()
-		layerNames = append(layerNames,
-			vk.ToString(layer.LayerName[:]))
+		report := newLayerReport(layer)
+		// a broken layer manifest should not hide the other layers.
+		if report.Extensions, err = getInstanceExtensions(report.Name); err != nil {
+			report.Error = err.Error()
+		}
+		layers = append(layers, report)
 	}
-	return layerNames
+	return layers, nil
 }
 
-func getDeviceLayers(gpu vk.PhysicalDevice) (layerNames []string) {
+func getDeviceLayers(gpu vk.PhysicalDevice) (layers []LayerReport, err error) {
 	var deviceLayerLen uint32
-	err := vk.EnumerateDeviceLayerProperties(gpu, &deviceLayerLen, nil)
-	orPanic(err)
+	err = vk.Error(vk.EnumerateDeviceLayerProperties(gpu, &deviceLayerLen, nil))
+	if err != nil {
+		err = fmt.Errorf("vkEnumerateDeviceLayerProperties failed with %s", err)
+		return nil, err
+	}
 	deviceLayers := make([]vk.LayerProperties, deviceLayerLen)
-	err = vk.EnumerateDeviceLayerProperties(gpu, &deviceLayerLen, deviceLayers)
-	orPanic(err)
-	for _, layer := range deviceLayers {
+	err = vk.Error(vk.EnumerateDeviceLayerProperties(gpu, &deviceLayerLen, deviceLayers))
+	if err != nil {
+		err = fmt.Errorf("vkEnumerateDeviceLayerProperties failed with %s", err)
+		return nil, err
+	}
+	for _, layer := range deviceLayers[:deviceLayerLen] {
 		layer.Deref()
-		layerNames = append(layerNames,
-			vk.ToString(layer.LayerName[:]))
+		report := newLayerReport(layer)
+		if report.Extensions, err = getDeviceExtensions(gpu, report.Name); err != nil {
+			report.Error = err.Error()
+		}
+		layers = append(layers, report)
 	}
-	return layerNames
+	return layers, nil
 }
 
-func getInstanceExtensions() (extNames []string) {
+func newLayerReport(layer vk.LayerProperties) LayerReport {
+	return LayerReport{
+		Name:                  vk.ToString(layer.LayerName[:]),
+		SpecVersion:           vk.Version(layer.SpecVersion).String(),
+		ImplementationVersion: layer.ImplementationVersion,
+		Description:           vk.ToString(layer.Description[:]),
+	}
+}
+
+// getInstanceExtensions lists the instance extensions provided by the named layer,
+// or by the implementation and the implicit layers when layerName is empty.
+func getInstanceExtensions(layerName string) (extNames []string, err error) {
 	var instanceExtLen uint32
-	err := vk.EnumerateInstanceExtensionProperties("", &instanceExtLen, nil)
-	orPanic(err)
+	err = vk.Error(vk.EnumerateInstanceExtensionProperties(safeString(layerName), &instanceExtLen, nil))
+	if err != nil {
+		err = fmt.Errorf("vkEnumerateInstanceExtensionProperties failed with %s", err)
+		return nil, err
+	}
 	instanceExt := make([]vk.ExtensionProperties, instanceExtLen)
-	err = vk.EnumerateInstanceExtensionProperties("", &instanceExtLen, instanceExt)
-	orPanic(err)
-	for _, ext := range instanceExt {
+	err = vk.Error(vk.EnumerateInstanceExtensionProperties(safeString(layerName), &instanceExtLen, instanceExt))
+	if err != nil {
+		err = fmt.Errorf("vkEnumerateInstanceExtensionProperties failed with %s", err)
+		return nil, err
+	}
+	for _, ext := range instanceExt[:instanceExtLen] {
 		ext.Deref()
 		extNames = append(extNames,
 			vk.ToString(ext.ExtensionName[:]))
 	}
-	return extNames
+	return extNames, nil
 }
 
-func getDeviceExtensions(gpu vk.PhysicalDevice) (extNames []string) {
+// getDeviceExtensions lists the device extensions provided by the named layer,
+// or by the implementation and the implicit layers when layerName is empty.
+func getDeviceExtensions(gpu vk.PhysicalDevice, layerName string) (extNames []string, err error) {
 	var deviceExtLen uint32
-	err := vk.EnumerateDeviceExtensionProperties(gpu, "", &deviceExtLen, nil)
-	orPanic(err)
+	err = vk.Error(vk.EnumerateDeviceExtensionProperties(gpu, safeString(layerName), &deviceExtLen, nil))
+	if err != nil {
+		err = fmt.Errorf("vkEnumerateDeviceExtensionProperties failed with %s", err)
+		return nil, err
+	}
 	deviceExt := make([]vk.ExtensionProperties, deviceExtLen)
-	err = vk.EnumerateDeviceExtensionProperties(gpu, "", &deviceExtLen, deviceExt)
-	orPanic(err)
-	for _, ext := range deviceExt {
+	err = vk.Error(vk.EnumerateDeviceExtensionProperties(gpu, safeString(layerName), &deviceExtLen, deviceExt))
+	if err != nil {
+		err = fmt.Errorf("vkEnumerateDeviceExtensionProperties failed with %s", err)
+		return nil, err
+	}
+	for _, ext := range deviceExt[:deviceExtLen] {
 		ext.Deref()
 		extNames = append(extNames,
 			vk.ToString(ext.ExtensionName[:]))
 	}
-	return extNames
+	return extNames, nil
+}
+
+// safeString NUL-terminates a non-empty layer name.
+func safeString(s string) string {
+	if len(s) == 0 || strings.HasSuffix(s, "\x00") {
+		return s
+	}
+	return s + "\x00"
 }
 
-func PrintInfo(v *VulkanDeviceInfo) {
-	var gpuProperties vk.PhysicalDeviceProperties
-	vk.GetPhysicalDeviceProperties(v.gpuDevices[0], &gpuProperties)
-	gpuProperties.Deref()
+// PrintInfo prints the report table and returns the report along with
+// the enumeration failures, which are also annotated in the table.
+func PrintInfo(v *VulkanDeviceInfo) (*Report, []error) {
+	r, errs := NewReport(v)
+	fmt.Println("\n\n" + r.Table())
+	return r, errs
+}
 
+// Table renders the report as a UTF-8 box table.
+func (r *Report) Table() string {
 	table := tablewriter.CreateTable()
 	table.UTF8Box()
 	table.AddTitle("VULKAN PROPERTIES AND SURFACE CAPABILITES")
-	table.AddRow("Physical Device Name", vk.ToString(gpuProperties.DeviceName[:]))
-	table.AddRow("Physical Device Vendor", fmt.Sprintf("%x", gpuProperties.VendorID))
-	if gpuProperties.DeviceType != vk.PhysicalDeviceTypeOther {
-		table.AddRow("Physical Device Type", physicalDeviceType(gpuProperties.DeviceType))
-	}
-	table.AddRow("Physical GPUs", len(v.gpuDevices))
-	table.AddRow("API Version", vk.Version(gpuProperties.ApiVersion))
-	table.AddRow("API Version Supported", vk.Version(gpuProperties.ApiVersion))
-	table.AddRow("Driver Version", vk.Version(gpuProperties.DriverVersion))
+	table.AddRow("Instance Version", r.InstanceVersion)
+	table.AddRow("Physical GPUs", len(r.Devices))
+	for i := range r.Devices {
+		table.AddSeparator()
+		addDeviceRows(table, &r.Devices[i], i == r.SelectedDevice)
+	}
 
-	if v.surface != vk.NullSurface {
-		var surfaceCapabilities vk.SurfaceCapabilities
-		vk.GetPhysicalDeviceSurfaceCapabilities(v.gpuDevices[0], v.surface, &surfaceCapabilities)
-		surfaceCapabilities.Deref()
-		surfaceCapabilities.CurrentExtent.Deref()
-		surfaceCapabilities.MinImageExtent.Deref()
-		surfaceCapabilities.MaxImageExtent.Deref()
+	table.AddSeparator()
+	table.AddRow("INSTANCE EXTENSIONS", "")
+	for i, extName := range r.InstanceExtensions {
+		table.AddRow(i+1, extName)
+	}
+	addErrorRows(table, sectionErrors(r.Errors, SectionInstanceExtensions))
 
+	layerErrors := sectionErrors(r.Errors, SectionInstanceLayers)
+	if len(r.InstanceLayerDetails) > 0 || len(layerErrors) > 0 {
+		table.AddSeparator()
+		table.AddRow("INSTANCE LAYERS")
+		addLayerRows(table, r.InstanceLayerDetails)
+		addErrorRows(table, layerErrors)
+	}
+	return table.Render()
+}
+
+func addDeviceRows(table *tablewriter.Table, dev *DeviceReport, selected bool) {
+	title := fmt.Sprintf("PHYSICAL DEVICE %d", dev.Index)
+	if selected {
+		title += " (SELECTED)"
+	}
+	table.AddRow(title, "")
+	table.AddRow("Physical Device Name", dev.Name)
+	table.AddRow("Physical Device Vendor", fmt.Sprintf("%x", dev.VendorID))
+	if dev.Type != vulkanutil.DeviceTypeName(vk.PhysicalDeviceTypeOther) {
+		table.AddRow("Physical Device Type", dev.Type)
+	}
+	table.AddRow("API Version", dev.APIVersion)
+	table.AddRow("API Version Supported", dev.APIVersion)
+	table.AddRow("Driver Version", dev.DriverVersion)
+
+	if surface := dev.Surface; surface != nil {
 		table.AddSeparator()
 		table.AddRow("Image count", fmt.Sprintf("%d - %d",
-			surfaceCapabilities.MinImageCount, surfaceCapabilities.MaxImageCount))
+			surface.MinImageCount, surface.MaxImageCount))
 		table.AddRow("Array layers", fmt.Sprintf("%d",
-			surfaceCapabilities.MaxImageArrayLayers))
+			surface.MaxImageArrayLayers))
 		table.AddRow("Image size (current)", fmt.Sprintf("%dx%d",
-			surfaceCapabilities.CurrentExtent.Width, surfaceCapabilities.CurrentExtent.Height))
+			surface.CurrentExtent.Width, surface.CurrentExtent.Height))
 		table.AddRow("Image size (extent)", fmt.Sprintf("%dx%d - %dx%d",
-			surfaceCapabilities.MinImageExtent.Width, surfaceCapabilities.MinImageExtent.Height,
-			surfaceCapabilities.MaxImageExtent.Width, surfaceCapabilities.MaxImageExtent.Height))
+			surface.MinImageExtent.Width, surface.MinImageExtent.Height,
+			surface.MaxImageExtent.Width, surface.MaxImageExtent.Height))
 		table.AddRow("Usage flags", fmt.Sprintf("%02x",
-			surfaceCapabilities.SupportedUsageFlags))
+			surface.SupportedUsageFlags))
 		table.AddRow("Current transform", fmt.Sprintf("%02x",
-			surfaceCapabilities.CurrentTransform))
+			surface.CurrentTransform))
 		table.AddRow("Allowed transforms", fmt.Sprintf("%02x",
-			surfaceCapabilities.SupportedTransforms))
-		var formatCount uint32
-		vk.GetPhysicalDeviceSurfaceFormats(v.gpuDevices[0], v.surface, &formatCount, nil)
-		table.AddRow("Surface formats", fmt.Sprintf("%d of %d", formatCount, vk.FormatRangeSize))
-		table.AddSeparator()
-	}
-
-	table.AddRow("INSTANCE EXTENSIONS", "")
-	instanceExt := getInstanceExtensions()
-	for i, extName := range instanceExt {
-		table.AddRow(i+1, extName)
+			surface.SupportedTransforms))
+		table.AddRow("Surface formats", fmt.Sprintf("%d of %d", surface.FormatCount, vk.FormatRangeSize))
+		for _, format := range surface.Formats {
+			table.AddRow("", format.Format+" "+format.ColorSpace)
+		}
+		table.AddRow("Present modes", strings.Join(surface.PresentModes, ", "))
 	}
+	addCapabilityRows(table, dev)
+	addExtendedRows(table, dev)
+	addFormatRows(table, dev)
 
 	table.AddSeparator()
 	table.AddRow("DEVICE EXTENSIONS", "")
-	deviceExt := getDeviceExtensions(v.gpuDevices[0])
-	for i, extName := range deviceExt {
+	for i, extName := range dev.Extensions {
 		table.AddRow(i+1, extName)
 	}
+	addErrorRows(table, sectionErrors(dev.Errors, SectionDeviceExtensions))
 
-	instanceLayers := getInstanceLayers()
-	if len(instanceLayers) > 0 {
-		table.AddSeparator()
-		table.AddRow("INSTANCE LAYERS")
-		for i, layerName := range instanceLayers {
-			table.AddRow(i+1, layerName)
-		}
-	}
-
-	deviceLayers := getDeviceLayers(v.gpuDevices[0])
-	if len(deviceLayers) > 0 {
+	layerErrors := sectionErrors(dev.Errors, SectionDeviceLayers)
+	if len(dev.LayerDetails) > 0 || len(layerErrors) > 0 {
 		table.AddSeparator()
 		table.AddRow("DEVICE LAYERS")
-		for i, layerName := range deviceLayers {
-			table.AddRow(i+1, layerName)
-		}
+		addLayerRows(table, dev.LayerDetails)
+		addErrorRows(table, layerErrors)
 	}
-
-	fmt.Println("\n\n" + table.Render())
 }
 
-func physicalDeviceType(dev vk.PhysicalDeviceType) string {
-	switch dev {
-	case vk.PhysicalDeviceTypeIntegratedGpu:
-		return "Integrated GPU"
-	case vk.PhysicalDeviceTypeDiscreteGpu:
-		return "Discrete GPU"
-	case vk.PhysicalDeviceTypeVirtualGpu:
-		return "Virtual GPU"
-	case vk.PhysicalDeviceTypeCpu:
-		return "CPU"
-	case vk.PhysicalDeviceTypeOther:
-		return "Other"
-	default:
-		return "Unknown"
-	}
-}
-
-func orPanic(err interface{}) {
-	switch v := err.(type) {
-	case error:
-		if v != nil {
-			panic(err)
+func addLayerRows(table *tablewriter.Table, layers []LayerReport) {
+	for i, layer := range layers {
+		table.AddRow(i+1, layer.Name)
+		table.AddRow("", fmt.Sprintf("spec %s, implementation %d",
+			layer.SpecVersion, layer.ImplementationVersion))
+		if len(layer.Description) > 0 {
+			table.AddRow("", layer.Description)
 		}
-	case vk.Result:
-		if err := vk.Error(v); err != nil {
-			panic(err)
+		for _, extName := range layer.Extensions {
+			table.AddRow("", "+ "+extName)
 		}
-	case bool:
-		if !v {
-			panic("condition failed: != true")
+		if len(layer.Error) > 0 {
+			addErrorRows(table, []string{layer.Error})
 		}
 	}
 }
+
+// addErrorRows annotates an incomplete section with the failures.
+func addErrorRows(table *tablewriter.Table, msgs []string) {
+	for _, msg := range msgs {
+		table.AddRow("(!) failed", msg)
+	}
+}
@@ -1,7 +1,13 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+
 	"github.com/vulkan-go/demos/vulkaninfo"
+	"github.com/vulkan-go/demos/vulkanutil"
 	vk "github.com/vulkan-go/vulkan"
 )
 
@@ -13,12 +19,53 @@ var appInfo = &vk.ApplicationInfo{
 	PEngineName:        "golang\x00",
 }
 
+var (
+	outputFormat = flag.String("format", vulkaninfo.OutputTable, "output format: table, json or yaml")
+	gpuSelect    = flag.String("gpu", "", "physical device to use: an index, a part of its name, type:KIND or ext:NAME, comma separated")
+)
+
 func main() {
+	flag.Parse()
 	orPanic(vk.Init())
-	vkDevice, err := vulkaninfo.NewVulkanDevice(appInfo, 0)
+	if flag.Arg(0) == "diff" {
+		changed, err := vulkaninfo.Diff(os.Stdout, flag.Args()[1:], currentReport)
+		orPanic(err)
+		if changed {
+			os.Exit(1)
+		}
+		return
+	}
+	report, err := currentReport()
 	orPanic(err)
-	vulkaninfo.PrintInfo(vkDevice)
-	vkDevice.Destroy()
+	if flag.Arg(0) == "check" {
+		if flag.NArg() != 2 {
+			orPanic(errors.New("usage: check requirements.json"))
+		}
+		ok, err := vulkaninfo.Check(os.Stdout, flag.Arg(1), report)
+		orPanic(err)
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+	orPanic(vulkaninfo.WriteReport(os.Stdout, report, *outputFormat))
+}
+
+func currentReport() (*vulkaninfo.Report, error) {
+	gpuFilter, err := vulkanutil.ParseDeviceFilter(*gpuSelect)
+	if err != nil {
+		return nil, err
+	}
+	vkDevice, err := vulkaninfo.NewVulkanDevice(appInfo, 0, gpuFilter)
+	if err != nil {
+		return nil, err
+	}
+	defer vkDevice.Destroy()
+	report, errs := vulkaninfo.NewReport(vkDevice)
+	for _, err := range errs {
+		log.Println("[WARN]", err)
+	}
+	return report, nil
 }
 
 func orPanic(err interface{}) {
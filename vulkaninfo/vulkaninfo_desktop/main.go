@@ -1,7 +1,13 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+
 	"github.com/vulkan-go/demos/vulkaninfo"
+	"github.com/vulkan-go/demos/vulkanutil"
 	"github.com/vulkan-go/glfw/v3.3/glfw"
 	vk "github.com/vulkan-go/vulkan"
 )
@@ -14,19 +20,65 @@ var appInfo = &vk.ApplicationInfo{
 	PEngineName:        "golang\x00",
 }
 
+var (
+	outputFormat = flag.String("format", vulkaninfo.OutputTable, "output format: table, json or yaml")
+	gpuSelect    = flag.String("gpu", "", "physical device to use: an index, a part of its name, type:KIND or ext:NAME, comma separated")
+)
+
 func main() {
+	flag.Parse()
 	orPanic(glfw.Init())
 	orPanic(vk.Init())
+	defer glfw.Terminate()
 
+	if flag.Arg(0) == "diff" {
+		changed, err := vulkaninfo.Diff(os.Stdout, flag.Args()[1:], currentReport)
+		orPanic(err)
+		if changed {
+			glfw.Terminate()
+			os.Exit(1)
+		}
+		return
+	}
+	report, err := currentReport()
+	orPanic(err)
+	if flag.Arg(0) == "check" {
+		if flag.NArg() != 2 {
+			orPanic(errors.New("usage: check requirements.json"))
+		}
+		ok, err := vulkaninfo.Check(os.Stdout, flag.Arg(1), report)
+		orPanic(err)
+		if !ok {
+			glfw.Terminate()
+			os.Exit(1)
+		}
+		return
+	}
+	orPanic(vulkaninfo.WriteReport(os.Stdout, report, *outputFormat))
+}
+
+func currentReport() (*vulkaninfo.Report, error) {
+	gpuFilter, err := vulkanutil.ParseDeviceFilter(*gpuSelect)
+	if err != nil {
+		return nil, err
+	}
 	glfw.WindowHint(glfw.ClientAPI, glfw.NoAPI)
 	window, err := glfw.CreateWindow(640, 480, "Vulkan Info", nil, nil)
-	orPanic(err)
+	if err != nil {
+		return nil, err
+	}
 	defer window.Destroy()
 
-	vkDevice, err := vulkaninfo.NewVulkanDevice(appInfo, window.GLFWWindow())
-	orPanic(err)
-	vulkaninfo.PrintInfo(vkDevice)
-	vkDevice.Destroy()
+	vkDevice, err := vulkaninfo.NewVulkanDevice(appInfo, window.GLFWWindow(), gpuFilter)
+	if err != nil {
+		return nil, err
+	}
+	defer vkDevice.Destroy()
+	report, errs := vulkaninfo.NewReport(vkDevice)
+	for _, err := range errs {
+		log.Println("[WARN]", err)
+	}
+	return report, nil
 }
 
 func orPanic(err interface{}) {
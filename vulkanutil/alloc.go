@@ -0,0 +1,362 @@
+package vulkanutil
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// DefaultBlockSize is the size of the blocks allocated from the device,
+// larger requests get a block of their own.
+const DefaultBlockSize = 64 << 20
+
+// Allocation is a range of a memory block, bind resources to Memory at Offset.
+type Allocation struct {
+	Memory vk.DeviceMemory
+	Offset vk.DeviceSize
+	Size   vk.DeviceSize
+
+	block *block
+}
+
+// blockKey selects the blocks an allocation is taken from.
+type blockKey struct {
+	typeIndex uint32
+	// linear resources, buffers and linear images, are kept apart from
+	// optimal images when the device has a bufferImageGranularity.
+	linear bool
+}
+
+type block struct {
+	memory vk.DeviceMemory
+	size   uint64
+	key    blockKey
+	free   freeList
+	count  int
+	// coherent blocks need no Invalidate after device writes.
+	coherent bool
+
+	mapped   unsafe.Pointer
+	mapCount int
+}
+
+// MemoryStats summarize the memory held by an Allocator.
+type MemoryStats struct {
+	// Blocks is the number of vk.DeviceMemory objects allocated.
+	Blocks int
+	// Allocations is the number of live sub-allocations.
+	Allocations int
+	// Reserved is the size of all blocks, Used the size in use.
+	Reserved vk.DeviceSize
+	Used     vk.DeviceSize
+}
+
+func (s MemoryStats) String() string {
+	return fmt.Sprintf("%d allocations using %d of %d bytes in %d blocks",
+		s.Allocations, s.Used, s.Reserved, s.Blocks)
+}
+
+// Allocator sub-allocates device memory: instead of one vk.AllocateMemory
+// per buffer or image, memory is taken in large blocks per memory type
+// and handed out in aligned ranges of those blocks.
+type Allocator struct {
+	mu sync.Mutex
+
+	device      vk.Device
+	gpu         vk.PhysicalDevice
+	granularity uint64
+	atomSize    uint64
+	memProps    vk.PhysicalDeviceMemoryProperties
+	blockSize   uint64
+	blocks      map[blockKey][]*block
+}
+
+// NewAllocator creates an allocator for device, blockSize 0 means DefaultBlockSize.
+func NewAllocator(gpu vk.PhysicalDevice, device vk.Device, blockSize vk.DeviceSize) *Allocator {
+	if blockSize == 0 {
+		blockSize = DefaultBlockSize
+	}
+	var props vk.PhysicalDeviceProperties
+	vk.GetPhysicalDeviceProperties(gpu, &props)
+	props.Deref()
+	props.Limits.Deref()
+	granularity := uint64(props.Limits.BufferImageGranularity)
+	if granularity == 0 {
+		granularity = 1
+	}
+	atomSize := uint64(props.Limits.NonCoherentAtomSize)
+	if atomSize == 0 {
+		atomSize = 1
+	}
+	var memProps vk.PhysicalDeviceMemoryProperties
+	vk.GetPhysicalDeviceMemoryProperties(gpu, &memProps)
+	memProps.Deref()
+	return &Allocator{
+		device:      device,
+		gpu:         gpu,
+		granularity: granularity,
+		atomSize:    atomSize,
+		memProps:    memProps,
+		blockSize:   uint64(blockSize),
+		blocks:      make(map[blockKey][]*block),
+	}
+}
+
+// Alloc sub-allocates memory that satisfies memReq and has the properties props.
+// Set linear for buffers and linear images, they never share a block with
+// optimal images when the bufferImageGranularity of the device requires
+// them to be on separate pages, so neither needs padding.
+func (a *Allocator) Alloc(memReq vk.MemoryRequirements,
+	props vk.MemoryPropertyFlagBits, linear bool) (Allocation, error) {
+
+	var alloc Allocation
+	typeIndex, ok := vk.FindMemoryTypeIndex(a.gpu, memReq.MemoryTypeBits, props)
+	if !ok {
+		err := fmt.Errorf("vk.FindMemoryTypeIndex found no memory type with properties %x", props)
+		return alloc, err
+	}
+	size := uint64(memReq.Size)
+	alignment := uint64(memReq.Alignment)
+	if alignment == 0 {
+		alignment = 1
+	}
+	key := blockKey{
+		typeIndex: typeIndex,
+		linear:    linear && a.granularity > 1,
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, b := range a.blocks[key] {
+		if offset, ok := b.free.alloc(size, alignment); ok {
+			b.count++
+			return b.allocation(offset, size), nil
+		}
+	}
+	blockSize := a.blockSize
+	if size > blockSize {
+		blockSize = size
+	}
+	b, err := a.newBlock(key, blockSize)
+	if err != nil && blockSize > size {
+		// small heaps, e.g. a 256MB BAR heap, may not fit a whole block.
+		b, err = a.newBlock(key, size)
+	}
+	if err != nil {
+		return alloc, err
+	}
+	offset, _ := b.free.alloc(size, alignment)
+	b.count++
+	return b.allocation(offset, size), nil
+}
+
+// AllocBuffer allocates memory for buffer and binds it.
+func (a *Allocator) AllocBuffer(buffer vk.Buffer,
+	props vk.MemoryPropertyFlagBits) (Allocation, error) {
+
+	var memReq vk.MemoryRequirements
+	vk.GetBufferMemoryRequirements(a.device, buffer, &memReq)
+	memReq.Deref()
+	alloc, err := a.Alloc(memReq, props, true)
+	if err != nil {
+		return alloc, err
+	}
+	err = vk.Error(vk.BindBufferMemory(a.device, buffer, alloc.Memory, alloc.Offset))
+	if err != nil {
+		a.Free(alloc)
+		err = fmt.Errorf("vk.BindBufferMemory failed with %s", err)
+		return Allocation{}, err
+	}
+	return alloc, nil
+}
+
+// AllocImage allocates memory for image created with tiling and binds it.
+func (a *Allocator) AllocImage(image vk.Image, tiling vk.ImageTiling,
+	props vk.MemoryPropertyFlagBits) (Allocation, error) {
+
+	var memReq vk.MemoryRequirements
+	vk.GetImageMemoryRequirements(a.device, image, &memReq)
+	memReq.Deref()
+	alloc, err := a.Alloc(memReq, props, tiling == vk.ImageTilingLinear)
+	if err != nil {
+		return alloc, err
+	}
+	err = vk.Error(vk.BindImageMemory(a.device, image, alloc.Memory, alloc.Offset))
+	if err != nil {
+		a.Free(alloc)
+		err = fmt.Errorf("vk.BindImageMemory failed with %s", err)
+		return Allocation{}, err
+	}
+	return alloc, nil
+}
+
+func (a *Allocator) newBlock(key blockKey, size uint64) (*block, error) {
+	allocInfo := vk.MemoryAllocateInfo{
+		SType:           vk.StructureTypeMemoryAllocateInfo,
+		AllocationSize:  vk.DeviceSize(size),
+		MemoryTypeIndex: key.typeIndex,
+	}
+	var memory vk.DeviceMemory
+	err := vk.Error(vk.AllocateMemory(a.device, &allocInfo, nil, &memory))
+	if err != nil {
+		err = fmt.Errorf("vk.AllocateMemory failed with %s", err)
+		return nil, err
+	}
+	memType := a.memProps.MemoryTypes[key.typeIndex]
+	memType.Deref()
+	b := &block{
+		memory:   memory,
+		size:     size,
+		key:      key,
+		free:     newFreeList(size),
+		coherent: memType.PropertyFlags&vk.MemoryPropertyFlags(vk.MemoryPropertyHostCoherentBit) != 0,
+	}
+	a.blocks[key] = append(a.blocks[key], b)
+	return b, nil
+}
+
+func (b *block) allocation(offset, size uint64) Allocation {
+	return Allocation{
+		Memory: b.memory,
+		Offset: vk.DeviceSize(offset),
+		Size:   vk.DeviceSize(size),
+		block:  b,
+	}
+}
+
+// Free returns alloc to its block. Blocks without allocations are given
+// back to the device, except for one of the default size per memory type,
+// so repeated uploads through staging buffers don't allocate a block each
+// time. Freeing a zero Allocation does nothing.
+func (a *Allocator) Free(alloc Allocation) {
+	b := alloc.block
+	if b == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b.free.free(uint64(alloc.Offset), uint64(alloc.Size))
+	b.count--
+	if b.count > 0 || a.keepEmpty(b) {
+		return
+	}
+	if b.mapped != nil {
+		vk.UnmapMemory(a.device, b.memory)
+	}
+	vk.FreeMemory(a.device, b.memory, nil)
+	blocks := a.blocks[b.key]
+	for i := range blocks {
+		if blocks[i] == b {
+			a.blocks[b.key] = append(blocks[:i], blocks[i+1:]...)
+			break
+		}
+	}
+}
+
+// keepEmpty reports whether the empty block b is kept for later allocations:
+// it is of the default size and the only empty block of its memory type
+// for linear or optimal resources.
+func (a *Allocator) keepEmpty(b *block) bool {
+	if b.size != a.blockSize {
+		return false
+	}
+	for _, other := range a.blocks[b.key] {
+		if other != b && other.count == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Map returns a pointer to the host visible memory of alloc. A block may
+// only be mapped once, so it stays mapped until every Map is matched by Unmap.
+func (a *Allocator) Map(alloc Allocation) (unsafe.Pointer, error) {
+	b := alloc.block
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if b.mapCount == 0 {
+		var data unsafe.Pointer
+		err := vk.Error(vk.MapMemory(a.device, b.memory, 0, vk.DeviceSize(vk.WholeSize), 0, &data))
+		if err != nil {
+			err = fmt.Errorf("vk.MapMemory failed with %s", err)
+			return nil, err
+		}
+		b.mapped = data
+	}
+	b.mapCount++
+	return unsafe.Pointer(uintptr(b.mapped) + uintptr(alloc.Offset)), nil
+}
+
+// Unmap releases a pointer returned by Map.
+func (a *Allocator) Unmap(alloc Allocation) {
+	b := alloc.block
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b.mapCount--
+	if b.mapCount == 0 {
+		vk.UnmapMemory(a.device, b.memory)
+		b.mapped = nil
+	}
+}
+
+// Invalidate makes the device writes to alloc visible to the host, call it
+// between Map and reading memory the device wrote to. It does nothing for
+// host coherent memory.
+func (a *Allocator) Invalidate(alloc Allocation) error {
+	b := alloc.block
+	if b.coherent {
+		return nil
+	}
+	// the range must cover whole atoms, the end of the block counts as one.
+	offset := uint64(alloc.Offset) / a.atomSize * a.atomSize
+	size := alignUp(uint64(alloc.Offset+alloc.Size)-offset, a.atomSize)
+	if offset+size > b.size {
+		size = b.size - offset
+	}
+	ranges := []vk.MappedMemoryRange{{
+		SType:  vk.StructureTypeMappedMemoryRange,
+		Memory: b.memory,
+		Offset: vk.DeviceSize(offset),
+		Size:   vk.DeviceSize(size),
+	}}
+	err := vk.Error(vk.InvalidateMappedMemoryRanges(a.device, 1, ranges))
+	if err != nil {
+		err = fmt.Errorf("vk.InvalidateMappedMemoryRanges failed with %s", err)
+		return err
+	}
+	return nil
+}
+
+// Stats reports the blocks and allocations currently held.
+func (a *Allocator) Stats() MemoryStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var s MemoryStats
+	for _, blocks := range a.blocks {
+		for _, b := range blocks {
+			s.Blocks++
+			s.Allocations += b.count
+			s.Reserved += vk.DeviceSize(b.size)
+			s.Used += vk.DeviceSize(b.size - b.free.freeBytes())
+		}
+	}
+	return s
+}
+
+// Destroy frees all blocks, allocations still alive become invalid.
+// It must be called before the device is destroyed.
+func (a *Allocator) Destroy() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key, blocks := range a.blocks {
+		for _, b := range blocks {
+			if b.mapped != nil {
+				vk.UnmapMemory(a.device, b.memory)
+			}
+			vk.FreeMemory(a.device, b.memory, nil)
+		}
+		delete(a.blocks, key)
+	}
+}
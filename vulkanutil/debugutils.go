@@ -0,0 +1,279 @@
+package vulkanutil
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"unsafe"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// DebugMessageFilter selects the messages a debug messenger reports.
+type DebugMessageFilter struct {
+	// MinSeverity is the least severe message reported,
+	// e.g. with warnings the errors are reported too.
+	MinSeverity vk.DebugUtilsMessageSeverityFlagBits
+	// Types are the general, validation and performance messages reported.
+	Types vk.DebugUtilsMessageTypeFlags
+}
+
+// DefaultDebugMessageFilter reports the warnings and errors of all types.
+var DefaultDebugMessageFilter = DebugMessageFilter{
+	MinSeverity: vk.DebugUtilsMessageSeverityWarningBit,
+	Types: vk.DebugUtilsMessageTypeFlags(vk.DebugUtilsMessageTypeGeneralBit |
+		vk.DebugUtilsMessageTypeValidationBit | vk.DebugUtilsMessageTypePerformanceBit),
+}
+
+var messageSeverities = []struct {
+	name string
+	bit  vk.DebugUtilsMessageSeverityFlagBits
+}{
+	{"verbose", vk.DebugUtilsMessageSeverityVerboseBit},
+	{"info", vk.DebugUtilsMessageSeverityInfoBit},
+	{"warning", vk.DebugUtilsMessageSeverityWarningBit},
+	{"error", vk.DebugUtilsMessageSeverityErrorBit},
+}
+
+var messageTypes = []struct {
+	name string
+	bit  vk.DebugUtilsMessageTypeFlagBits
+}{
+	{"general", vk.DebugUtilsMessageTypeGeneralBit},
+	{"validation", vk.DebugUtilsMessageTypeValidationBit},
+	{"performance", vk.DebugUtilsMessageTypePerformanceBit},
+}
+
+// ParseDebugMessageFilter parses a minimum severity, one of verbose, info,
+// warning and error, and a comma separated list of the general, validation
+// and performance message types, as taken by the -validate-* flags.
+func ParseDebugMessageFilter(severity, types string) (DebugMessageFilter, error) {
+	var f DebugMessageFilter
+	for _, s := range messageSeverities {
+		if s.name == severity {
+			f.MinSeverity = s.bit
+		}
+	}
+	if f.MinSeverity == 0 {
+		err := fmt.Errorf("vulkanutil: unknown message severity %q", severity)
+		return f, err
+	}
+	for _, name := range strings.Split(types, ",") {
+		found := false
+		for _, t := range messageTypes {
+			if t.name == strings.TrimSpace(name) {
+				f.Types |= vk.DebugUtilsMessageTypeFlags(t.bit)
+				found = true
+			}
+		}
+		if !found {
+			err := fmt.Errorf("vulkanutil: unknown message type %q", name)
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// severities are MinSeverity and the ones above it.
+func (f DebugMessageFilter) severities() vk.DebugUtilsMessageSeverityFlags {
+	var mask vk.DebugUtilsMessageSeverityFlags
+	for _, s := range messageSeverities {
+		if s.bit >= f.MinSeverity {
+			mask |= vk.DebugUtilsMessageSeverityFlags(s.bit)
+		}
+	}
+	return mask
+}
+
+func debugMessengerCreateInfo(filter DebugMessageFilter) vk.DebugUtilsMessengerCreateInfo {
+	return vk.DebugUtilsMessengerCreateInfo{
+		SType:           vk.StructureTypeDebugUtilsMessengerCreateInfo,
+		MessageSeverity: filter.severities(),
+		MessageType:     filter.Types,
+		PfnUserCallback: debugMessengerFunc,
+	}
+}
+
+// ChainDebugMessenger adds a messenger selected by filter to the PNext chain
+// of info, so the messages of vk.CreateInstance and vk.DestroyInstance are
+// logged as well, the ones before and after the messenger of
+// CreateDebugMessenger exists. The instance must enable VK_EXT_debug_utils.
+// Call free once vk.CreateInstance returned.
+func ChainDebugMessenger(info *vk.InstanceCreateInfo, filter DebugMessageFilter) (free func()) {
+	createInfo := debugMessengerCreateInfo(filter)
+	createInfo.PNext = info.PNext
+	ref, allocs := createInfo.PassRef()
+	info.PNext = unsafe.Pointer(ref)
+	return allocs.Free
+}
+
+// CreateDebugMessenger logs the messages of the layers selected by filter,
+// instance must be created with VK_EXT_debug_utils. Create it right after
+// the instance, so the messages about creating the devices are logged, and
+// call EnableDebugUtils on the Tracker of each device of instance to name
+// and label their objects too.
+func CreateDebugMessenger(instance vk.Instance, filter DebugMessageFilter) (vk.DebugUtilsMessenger, error) {
+	createInfo := debugMessengerCreateInfo(filter)
+	var messenger vk.DebugUtilsMessenger
+	err := vk.Error(vk.CreateDebugUtilsMessenger(instance, &createInfo, nil, &messenger))
+	if err != nil {
+		err = fmt.Errorf("vk.CreateDebugUtilsMessenger failed with %s", err)
+		return vk.NullDebugUtilsMessenger, err
+	}
+	return messenger, nil
+}
+
+// DestroyDebugMessenger destroys a messenger made by CreateDebugMessenger,
+// call it before vk.DestroyInstance. Null messengers are ignored.
+func DestroyDebugMessenger(instance vk.Instance, messenger vk.DebugUtilsMessenger) {
+	if messenger == vk.NullDebugUtilsMessenger {
+		return
+	}
+	vk.DestroyDebugUtilsMessenger(instance, messenger, nil)
+}
+
+func debugMessengerFunc(messageSeverity vk.DebugUtilsMessageSeverityFlagBits,
+	messageTypes vk.DebugUtilsMessageTypeFlags, pCallbackData *vk.DebugUtilsMessengerCallbackData,
+	pUserData unsafe.Pointer) vk.Bool32 {
+
+	pCallbackData.Deref()
+	var names []string
+	for i := 0; i < int(pCallbackData.ObjectCount) && i < len(pCallbackData.PObjects); i++ {
+		object := pCallbackData.PObjects[i]
+		object.Deref()
+		if object.PObjectName != "" {
+			names = append(names, object.PObjectName)
+		}
+	}
+	log.Println(formatDebugMessage(messageSeverity, messageTypes,
+		pCallbackData.PMessageIdName, pCallbackData.PMessage, names))
+	// Returning false tells the layer not to stop when the event occurs, so
+	// they see the same behavior with and without validation layers enabled.
+	return vk.Bool32(vk.False)
+}
+
+// formatDebugMessage formats a message like the other log lines of the demos,
+// e.g. "[WARN validation] VUID-xyz: message (objects: depth image)".
+func formatDebugMessage(severity vk.DebugUtilsMessageSeverityFlagBits,
+	types vk.DebugUtilsMessageTypeFlags, id, message string, objects []string) string {
+
+	level := "DEBUG"
+	switch {
+	case severity >= vk.DebugUtilsMessageSeverityErrorBit:
+		level = "ERROR"
+	case severity >= vk.DebugUtilsMessageSeverityWarningBit:
+		level = "WARN"
+	case severity >= vk.DebugUtilsMessageSeverityInfoBit:
+		level = "INFO"
+	}
+	var kinds []string
+	for _, t := range messageTypes {
+		if types&vk.DebugUtilsMessageTypeFlags(t.bit) != 0 {
+			kinds = append(kinds, t.name)
+		}
+	}
+	line := fmt.Sprintf("[%s %s] ", level, strings.Join(kinds, ","))
+	if id != "" {
+		line += id + ": "
+	}
+	line += message
+	if len(objects) > 0 {
+		line += " (objects: " + strings.Join(objects, ", ") + ")"
+	}
+	return line
+}
+
+// EnableDebugUtils makes SetObjectName, BeginLabel and EndLabel work on the
+// device of t, call it once its instance has a debug messenger. It lasts
+// until t is closed.
+func (t *Tracker) EnableDebugUtils() {
+	t.mu.Lock()
+	t.debugUtils = true
+	t.mu.Unlock()
+}
+
+// debugUtilsEnabled reports whether EnableDebugUtils was called on the Tracker of device.
+func debugUtilsEnabled(device vk.Device) bool {
+	t := trackerFor(device)
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.debugUtils
+}
+
+// SetObjectName gives h a name that validation messages and frame captures
+// show for it. It does nothing for null handles and for devices without
+// debug utils, see EnableDebugUtils.
+func SetObjectName(device vk.Device, h interface{}, name string) {
+	if !debugUtilsEnabled(device) {
+		return
+	}
+	v := reflect.ValueOf(h)
+	if v.IsZero() {
+		return
+	}
+	handle := uint64(0)
+	switch v.Kind() {
+	case reflect.Ptr, reflect.UnsafePointer:
+		handle = uint64(v.Pointer())
+	default:
+		// non-dispatchable handles are integers on 32-bit platforms.
+		handle = v.Uint()
+	}
+	nameInfo := vk.DebugUtilsObjectNameInfo{
+		SType:        vk.StructureTypeDebugUtilsObjectNameInfo,
+		ObjectType:   objectType(h),
+		ObjectHandle: handle,
+		PObjectName:  name + "\x00",
+	}
+	if err := vk.Error(vk.SetDebugUtilsObjectName(device, &nameInfo)); err != nil {
+		log.Println("[WARN] vk.SetDebugUtilsObjectName failed with", err)
+	}
+}
+
+func objectType(h interface{}) vk.ObjectType {
+	switch h.(type) {
+	case vk.CommandBuffer:
+		return vk.ObjectTypeCommandBuffer
+	case vk.Buffer:
+		return vk.ObjectTypeBuffer
+	case vk.Image:
+		return vk.ObjectTypeImage
+	case vk.ImageView:
+		return vk.ObjectTypeImageView
+	case vk.Pipeline:
+		return vk.ObjectTypePipeline
+	case vk.Framebuffer:
+		return vk.ObjectTypeFramebuffer
+	case vk.RenderPass:
+		return vk.ObjectTypeRenderPass
+	case vk.Sampler:
+		return vk.ObjectTypeSampler
+	}
+	panic(fmt.Sprintf("vulkanutil: %T objects can not be named", h))
+}
+
+// BeginLabel starts a region of cmd, allocated on device, with the given name,
+// which validation messages and frame captures show for the commands up to
+// EndLabel. Both do nothing for devices without debug utils, see EnableDebugUtils.
+func BeginLabel(device vk.Device, cmd vk.CommandBuffer, name string) {
+	if !debugUtilsEnabled(device) {
+		return
+	}
+	label := vk.DebugUtilsLabel{
+		SType:      vk.StructureTypeDebugUtilsLabel,
+		PLabelName: name + "\x00",
+	}
+	vk.CmdBeginDebugUtilsLabel(cmd, &label)
+}
+
+// EndLabel ends the region started by BeginLabel.
+func EndLabel(device vk.Device, cmd vk.CommandBuffer) {
+	if !debugUtilsEnabled(device) {
+		return
+	}
+	vk.CmdEndDebugUtilsLabel(cmd)
+}
@@ -0,0 +1,45 @@
+package vulkanutil
+
+import (
+	"testing"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+func TestParseDebugMessageFilter(t *testing.T) {
+	f, err := ParseDebugMessageFilter("warning", "validation, performance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	severities := vk.DebugUtilsMessageSeverityFlags(vk.DebugUtilsMessageSeverityWarningBit |
+		vk.DebugUtilsMessageSeverityErrorBit)
+	if got := f.severities(); got != severities {
+		t.Errorf("severities() = %#x, want %#x", got, severities)
+	}
+	types := vk.DebugUtilsMessageTypeFlags(vk.DebugUtilsMessageTypeValidationBit |
+		vk.DebugUtilsMessageTypePerformanceBit)
+	if f.Types != types {
+		t.Errorf("Types = %#x, want %#x", f.Types, types)
+	}
+	if _, err := ParseDebugMessageFilter("fatal", "general"); err == nil {
+		t.Error("unknown severity parsed")
+	}
+	if _, err := ParseDebugMessageFilter("error", "general,loader"); err == nil {
+		t.Error("unknown message type parsed")
+	}
+}
+
+func TestFormatDebugMessage(t *testing.T) {
+	got := formatDebugMessage(vk.DebugUtilsMessageSeverityWarningBit,
+		vk.DebugUtilsMessageTypeFlags(vk.DebugUtilsMessageTypeValidationBit),
+		"VUID-x", "bad layout", []string{"depth image", "draw 0"})
+	want := "[WARN validation] VUID-x: bad layout (objects: depth image, draw 0)"
+	if got != want {
+		t.Errorf("formatDebugMessage = %q, want %q", got, want)
+	}
+	got = formatDebugMessage(vk.DebugUtilsMessageSeverityVerboseBit,
+		vk.DebugUtilsMessageTypeFlags(vk.DebugUtilsMessageTypeGeneralBit), "", "loaded", nil)
+	if want := "[DEBUG general] loaded"; got != want {
+		t.Errorf("formatDebugMessage = %q, want %q", got, want)
+	}
+}
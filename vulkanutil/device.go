@@ -0,0 +1,265 @@
+// Package vulkanutil contains the bits shared by the demos,
+// such as the physical device selection policy and the memory allocator.
+package vulkanutil
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// PhysicalDeviceInfo describes an enumerated physical device.
+type PhysicalDeviceInfo struct {
+	Index      int
+	Device     vk.PhysicalDevice
+	Name       string
+	Type       vk.PhysicalDeviceType
+	Extensions []string
+}
+
+func (d PhysicalDeviceInfo) String() string {
+	return fmt.Sprintf("%d: %s (%s)", d.Index, d.Name, DeviceTypeName(d.Type))
+}
+
+// DeviceFilter reports whether a physical device is acceptable.
+// A nil filter accepts any device.
+type DeviceFilter func(d PhysicalDeviceInfo) bool
+
+// WithIndex accepts only the device at the given enumeration index.
+func WithIndex(idx int) DeviceFilter {
+	return func(d PhysicalDeviceInfo) bool {
+		return d.Index == idx
+	}
+}
+
+// WithName accepts devices whose name contains substr, ignoring case.
+func WithName(substr string) DeviceFilter {
+	substr = strings.ToLower(substr)
+	return func(d PhysicalDeviceInfo) bool {
+		return strings.Contains(strings.ToLower(d.Name), substr)
+	}
+}
+
+// WithType accepts only devices of the given type.
+func WithType(t vk.PhysicalDeviceType) DeviceFilter {
+	return func(d PhysicalDeviceInfo) bool {
+		return d.Type == t
+	}
+}
+
+// WithExtensions accepts devices that support all of the named extensions.
+// Names may be given with or without the trailing NUL byte.
+func WithExtensions(names ...string) DeviceFilter {
+	return func(d PhysicalDeviceInfo) bool {
+		for _, name := range names {
+			if !hasString(d.Extensions, strings.TrimRight(name, "\x00")) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// WithPresentSupport accepts devices with a queue family that can present
+// to the surface.
+func WithPresentSupport(surface vk.Surface) DeviceFilter {
+	return func(d PhysicalDeviceInfo) bool {
+		var count uint32
+		vk.GetPhysicalDeviceQueueFamilyProperties(d.Device, &count, nil)
+		for i := uint32(0); i < count; i++ {
+			var supported vk.Bool32
+			ret := vk.GetPhysicalDeviceSurfaceSupport(d.Device, i, surface, &supported)
+			if ret == vk.Success && supported == vk.True {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// deviceTypes are the names ParseDeviceFilter accepts after "type:".
+var deviceTypes = map[string]vk.PhysicalDeviceType{
+	"discrete":   vk.PhysicalDeviceTypeDiscreteGpu,
+	"integrated": vk.PhysicalDeviceTypeIntegratedGpu,
+	"virtual":    vk.PhysicalDeviceTypeVirtualGpu,
+	"cpu":        vk.PhysicalDeviceTypeCpu,
+	"other":      vk.PhysicalDeviceTypeOther,
+}
+
+// ParseDeviceFilter turns a command line value into a filter. The value is a
+// comma separated list of terms that must all match: a number selects a device
+// by index, "type:discrete" (or integrated, virtual, cpu, other) by type,
+// "ext:VK_KHR_swapchain" by a required extension, and anything else is matched
+// against the device name. An empty string yields a nil filter.
+func ParseDeviceFilter(s string) (DeviceFilter, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	var filters []DeviceFilter
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		switch {
+		case strings.HasPrefix(term, "type:"):
+			t, ok := deviceTypes[strings.ToLower(strings.TrimPrefix(term, "type:"))]
+			if !ok {
+				err := fmt.Errorf("vulkanutil: unknown device type in %q", term)
+				return nil, err
+			}
+			filters = append(filters, WithType(t))
+		case strings.HasPrefix(term, "ext:"):
+			filters = append(filters, WithExtensions(strings.TrimPrefix(term, "ext:")))
+		default:
+			if idx, err := strconv.Atoi(term); err == nil {
+				filters = append(filters, WithIndex(idx))
+			} else {
+				filters = append(filters, WithName(term))
+			}
+		}
+	}
+	return func(d PhysicalDeviceInfo) bool {
+		return acceptDevice(d, filters)
+	}, nil
+}
+
+// TypeRank orders device types by preference, lower is better:
+// discrete > integrated > virtual > CPU > other.
+func TypeRank(t vk.PhysicalDeviceType) int {
+	switch t {
+	case vk.PhysicalDeviceTypeDiscreteGpu:
+		return 0
+	case vk.PhysicalDeviceTypeIntegratedGpu:
+		return 1
+	case vk.PhysicalDeviceTypeVirtualGpu:
+		return 2
+	case vk.PhysicalDeviceTypeCpu:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func DeviceTypeName(t vk.PhysicalDeviceType) string {
+	switch t {
+	case vk.PhysicalDeviceTypeIntegratedGpu:
+		return "Integrated GPU"
+	case vk.PhysicalDeviceTypeDiscreteGpu:
+		return "Discrete GPU"
+	case vk.PhysicalDeviceTypeVirtualGpu:
+		return "Virtual GPU"
+	case vk.PhysicalDeviceTypeCpu:
+		return "CPU"
+	case vk.PhysicalDeviceTypeOther:
+		return "Other"
+	default:
+		return "Unknown"
+	}
+}
+
+// DescribePhysicalDevices collects name, type and extensions of each device.
+func DescribePhysicalDevices(gpus []vk.PhysicalDevice) []PhysicalDeviceInfo {
+	devices := make([]PhysicalDeviceInfo, 0, len(gpus))
+	for i, gpu := range gpus {
+		var props vk.PhysicalDeviceProperties
+		vk.GetPhysicalDeviceProperties(gpu, &props)
+		props.Deref()
+		devices = append(devices, PhysicalDeviceInfo{
+			Index:      i,
+			Device:     gpu,
+			Name:       vk.ToString(props.DeviceName[:]),
+			Type:       props.DeviceType,
+			Extensions: deviceExtensions(gpu),
+		})
+	}
+	return devices
+}
+
+// SelectPhysicalDevice picks the device that passes all filters, preferring
+// device types by TypeRank and then the enumeration order, so the choice
+// is deterministic on machines with several GPUs.
+func SelectPhysicalDevice(gpus []vk.PhysicalDevice, filters ...DeviceFilter) (PhysicalDeviceInfo, error) {
+	return selectDevice(DescribePhysicalDevices(gpus), filters)
+}
+
+func selectDevice(devices []PhysicalDeviceInfo, filters []DeviceFilter) (PhysicalDeviceInfo, error) {
+	var candidates []PhysicalDeviceInfo
+	for _, d := range devices {
+		if acceptDevice(d, filters) {
+			candidates = append(candidates, d)
+		}
+	}
+	if len(candidates) == 0 {
+		names := make([]string, 0, len(devices))
+		for _, d := range devices {
+			names = append(names, d.String())
+		}
+		err := fmt.Errorf("no physical device matches the selection (available: %s)",
+			strings.Join(names, ", "))
+		return PhysicalDeviceInfo{}, err
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return TypeRank(candidates[i].Type) < TypeRank(candidates[j].Type)
+	})
+	return candidates[0], nil
+}
+
+// ClampSampleCount returns the highest sample count up to want that the
+// framebuffers of the device support for color attachments, and for depth
+// attachments too when depth is set. It is never below vk.SampleCount1Bit.
+func ClampSampleCount(gpu vk.PhysicalDevice, want vk.SampleCountFlagBits, depth bool) vk.SampleCountFlagBits {
+	var props vk.PhysicalDeviceProperties
+	vk.GetPhysicalDeviceProperties(gpu, &props)
+	props.Deref()
+	props.Limits.Deref()
+	supported := props.Limits.FramebufferColorSampleCounts
+	if depth {
+		supported &= props.Limits.FramebufferDepthSampleCounts
+	}
+	return clampSampleCount(want, supported)
+}
+
+func clampSampleCount(want vk.SampleCountFlagBits, supported vk.SampleCountFlags) vk.SampleCountFlagBits {
+	for count := vk.SampleCount64Bit; count > vk.SampleCount1Bit; count >>= 1 {
+		if count <= want && supported&vk.SampleCountFlags(count) != 0 {
+			return count
+		}
+	}
+	return vk.SampleCount1Bit
+}
+
+func acceptDevice(d PhysicalDeviceInfo, filters []DeviceFilter) bool {
+	for _, filter := range filters {
+		if filter != nil && !filter(d) {
+			return false
+		}
+	}
+	return true
+}
+
+func deviceExtensions(gpu vk.PhysicalDevice) (extNames []string) {
+	var deviceExtLen uint32
+	if vk.EnumerateDeviceExtensionProperties(gpu, "", &deviceExtLen, nil) != vk.Success {
+		return nil
+	}
+	deviceExt := make([]vk.ExtensionProperties, deviceExtLen)
+	if vk.EnumerateDeviceExtensionProperties(gpu, "", &deviceExtLen, deviceExt) != vk.Success {
+		return nil
+	}
+	for _, ext := range deviceExt {
+		ext.Deref()
+		extNames = append(extNames,
+			vk.ToString(ext.ExtensionName[:]))
+	}
+	return extNames
+}
+
+func hasString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
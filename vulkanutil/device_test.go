@@ -0,0 +1,123 @@
+package vulkanutil
+
+import (
+	"fmt"
+	"testing"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+func TestClampSampleCount(t *testing.T) {
+	supported := vk.SampleCountFlags(vk.SampleCount1Bit | vk.SampleCount2Bit | vk.SampleCount4Bit)
+	cases := []struct {
+		want, got vk.SampleCountFlagBits
+	}{
+		{0, vk.SampleCount1Bit},
+		{vk.SampleCount1Bit, vk.SampleCount1Bit},
+		{vk.SampleCount4Bit, vk.SampleCount4Bit},
+		{vk.SampleCount8Bit, vk.SampleCount4Bit},
+		{vk.SampleCount64Bit, vk.SampleCount4Bit},
+		// not a power of two, rounded down
+		{3, vk.SampleCount2Bit},
+	}
+	for _, c := range cases {
+		if got := clampSampleCount(c.want, supported); got != c.got {
+			t.Errorf("clampSampleCount(%d) = %d, want %d", c.want, got, c.got)
+		}
+	}
+	if got := clampSampleCount(vk.SampleCount8Bit, 0); got != vk.SampleCount1Bit {
+		t.Errorf("clampSampleCount without support = %d, want 1", got)
+	}
+}
+
+var testDevices = []PhysicalDeviceInfo{
+	{Index: 0, Name: "llvmpipe (LLVM 15.0.7, 256 bits)", Type: vk.PhysicalDeviceTypeCpu},
+	{Index: 1, Name: "Intel(R) UHD Graphics 620", Type: vk.PhysicalDeviceTypeIntegratedGpu,
+		Extensions: []string{"VK_KHR_swapchain"}},
+	{Index: 2, Name: "NVIDIA GeForce GTX 1080", Type: vk.PhysicalDeviceTypeDiscreteGpu,
+		Extensions: []string{"VK_KHR_swapchain", "VK_NV_ray_tracing"}},
+	{Index: 3, Name: "NVIDIA GeForce RTX 3070", Type: vk.PhysicalDeviceTypeDiscreteGpu,
+		Extensions: []string{"VK_KHR_swapchain", "VK_KHR_ray_query"}},
+}
+
+func TestParseDeviceFilter(t *testing.T) {
+	cases := []struct {
+		value string
+		// accepted are the indexes of the testDevices accepted.
+		accepted []int
+	}{
+		{"", []int{0, 1, 2, 3}},
+		{"2", []int{2}},
+		{"nvidia", []int{2, 3}},
+		{"RTX", []int{3}},
+		{"type:discrete", []int{2, 3}},
+		{"type:CPU", []int{0}},
+		{"type:virtual", nil},
+		{"ext:VK_KHR_swapchain", []int{1, 2, 3}},
+		{"type:discrete, ext:VK_KHR_ray_query", []int{3}},
+		{"intel,ext:VK_KHR_ray_query", nil},
+	}
+	for _, c := range cases {
+		filter, err := ParseDeviceFilter(c.value)
+		if err != nil {
+			t.Errorf("ParseDeviceFilter(%q) failed: %s", c.value, err)
+			continue
+		}
+		var accepted []int
+		for _, d := range testDevices {
+			if acceptDevice(d, []DeviceFilter{filter}) {
+				accepted = append(accepted, d.Index)
+			}
+		}
+		if fmt.Sprint(accepted) != fmt.Sprint(c.accepted) {
+			t.Errorf("ParseDeviceFilter(%q) accepts %v, want %v", c.value, accepted, c.accepted)
+		}
+	}
+	if _, err := ParseDeviceFilter("type:gpu"); err == nil {
+		t.Error("unknown device type parsed")
+	}
+}
+
+func TestTypeRank(t *testing.T) {
+	types := []vk.PhysicalDeviceType{
+		vk.PhysicalDeviceTypeDiscreteGpu,
+		vk.PhysicalDeviceTypeIntegratedGpu,
+		vk.PhysicalDeviceTypeVirtualGpu,
+		vk.PhysicalDeviceTypeCpu,
+		vk.PhysicalDeviceTypeOther,
+	}
+	for i := 1; i < len(types); i++ {
+		if TypeRank(types[i-1]) >= TypeRank(types[i]) {
+			t.Errorf("%s is not preferred over %s", DeviceTypeName(types[i-1]), DeviceTypeName(types[i]))
+		}
+	}
+}
+
+func TestSelectDevice(t *testing.T) {
+	cases := []struct {
+		name    string
+		filters []DeviceFilter
+		want    int
+	}{
+		// the first discrete GPU in enumeration order wins.
+		{"default", nil, 2},
+		{"nil filter", []DeviceFilter{nil}, 2},
+		{"integrated", []DeviceFilter{WithType(vk.PhysicalDeviceTypeIntegratedGpu)}, 1},
+		{"extension", []DeviceFilter{WithExtensions("VK_KHR_ray_query\x00")}, 3},
+		{"cpu by index", []DeviceFilter{WithIndex(0)}, 0},
+		{"swapchain", []DeviceFilter{WithName("intel"), WithExtensions("VK_KHR_swapchain")}, 1},
+	}
+	for _, c := range cases {
+		d, err := selectDevice(testDevices, c.filters)
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		if d.Index != c.want {
+			t.Errorf("%s: selected %s, want device %d", c.name, d, c.want)
+		}
+	}
+	if _, err := selectDevice(testDevices, []DeviceFilter{WithName("radeon")}); err == nil {
+		t.Error("no device matches, but selectDevice did not fail")
+	}
+}
@@ -0,0 +1,78 @@
+package vulkanutil
+
+import "sort"
+
+// span is a free range of a block.
+type span struct {
+	offset, size uint64
+}
+
+// freeList tracks the free ranges of a block sorted by offset,
+// adjacent ranges are always merged.
+type freeList struct {
+	spans []span
+}
+
+func newFreeList(size uint64) freeList {
+	return freeList{
+		spans: []span{{offset: 0, size: size}},
+	}
+}
+
+// alloc takes the first free range that fits size bytes at the given
+// alignment, the padding in front of the aligned offset stays free.
+func (l *freeList) alloc(size, alignment uint64) (uint64, bool) {
+	if alignment == 0 {
+		alignment = 1
+	}
+	for i, s := range l.spans {
+		offset := alignUp(s.offset, alignment)
+		end := s.offset + s.size
+		if offset+size > end {
+			continue
+		}
+		var parts []span
+		if offset > s.offset {
+			parts = append(parts, span{offset: s.offset, size: offset - s.offset})
+		}
+		if offset+size < end {
+			parts = append(parts, span{offset: offset + size, size: end - offset - size})
+		}
+		l.spans = append(l.spans[:i], append(parts, l.spans[i+1:]...)...)
+		return offset, true
+	}
+	return 0, false
+}
+
+// free returns a range taken by alloc and coalesces it with its neighbours.
+func (l *freeList) free(offset, size uint64) {
+	i := sort.Search(len(l.spans), func(i int) bool {
+		return l.spans[i].offset > offset
+	})
+	l.spans = append(l.spans, span{})
+	copy(l.spans[i+1:], l.spans[i:])
+	l.spans[i] = span{offset: offset, size: size}
+
+	// merge with the next range, then with the previous one.
+	if i+1 < len(l.spans) && l.spans[i].offset+l.spans[i].size == l.spans[i+1].offset {
+		l.spans[i].size += l.spans[i+1].size
+		l.spans = append(l.spans[:i+1], l.spans[i+2:]...)
+	}
+	if i > 0 && l.spans[i-1].offset+l.spans[i-1].size == l.spans[i].offset {
+		l.spans[i-1].size += l.spans[i].size
+		l.spans = append(l.spans[:i], l.spans[i+1:]...)
+	}
+}
+
+// freeBytes is the total size of the free ranges.
+func (l *freeList) freeBytes() uint64 {
+	var n uint64
+	for _, s := range l.spans {
+		n += s.size
+	}
+	return n
+}
+
+func alignUp(v, alignment uint64) uint64 {
+	return (v + alignment - 1) / alignment * alignment
+}
@@ -0,0 +1,46 @@
+package vulkanutil
+
+import "testing"
+
+func TestFreeListAlignment(t *testing.T) {
+	l := newFreeList(1024)
+	a, ok := l.alloc(10, 1)
+	if !ok || a != 0 {
+		t.Fatalf("first range at %d (%v), want 0", a, ok)
+	}
+	b, ok := l.alloc(100, 256)
+	if !ok || b != 256 {
+		t.Fatalf("aligned range at %d (%v), want 256", b, ok)
+	}
+	// the padding between 10 and 256 is still free.
+	c, ok := l.alloc(200, 4)
+	if !ok || c != 12 {
+		t.Fatalf("range in the padding at %d (%v), want 12", c, ok)
+	}
+	if _, ok := l.alloc(1024, 1); ok {
+		t.Error("range larger than the free space is allocated")
+	}
+	if n := l.freeBytes(); n != 1024-10-100-200 {
+		t.Errorf("%d bytes free, want %d", n, 1024-10-100-200)
+	}
+}
+
+func TestFreeListCoalesce(t *testing.T) {
+	l := newFreeList(300)
+	a, _ := l.alloc(100, 1)
+	b, _ := l.alloc(100, 1)
+	c, _ := l.alloc(100, 1)
+
+	l.free(a, 100)
+	l.free(c, 100)
+	if len(l.spans) != 2 {
+		t.Fatalf("got %d free ranges, want 2: %v", len(l.spans), l.spans)
+	}
+	l.free(b, 100)
+	if len(l.spans) != 1 || l.spans[0] != (span{offset: 0, size: 300}) {
+		t.Fatalf("free ranges are %v, want a single one of 300 bytes", l.spans)
+	}
+	if _, ok := l.alloc(300, 1); !ok {
+		t.Error("coalesced block can not be allocated in full")
+	}
+}
@@ -0,0 +1,228 @@
+package vulkanutil
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// Tracker records the objects created on a device together with the place
+// they were created at, so the objects still alive when the device is about
+// to be destroyed can be reported as leaks.
+//
+// Objects are registered with Track and released with Destroy, both look up
+// the tracker by device. Command buffers and descriptor sets are not tracked,
+// they are freed with their pools. Objects of types the tracker doesn't know
+// how to destroy are reported as unknown, Destroy only logs a warning for them.
+type Tracker struct {
+	mu     sync.Mutex
+	device vk.Device
+	seq    int
+	live   map[interface{}]trackedObject
+	// debugUtils is set by EnableDebugUtils.
+	debugUtils bool
+}
+
+type trackedObject struct {
+	seq  int
+	site string
+}
+
+// Leak is an object that was still alive in Tracker.Close.
+type Leak struct {
+	Handle interface{}
+	// Type is the kind of object, e.g. "buffer" or "image view".
+	Type string
+	// Site is the file:line the object was tracked at.
+	Site string
+}
+
+func (l Leak) String() string {
+	return fmt.Sprintf("%s %v created at %s", l.Type, l.Handle, l.Site)
+}
+
+var (
+	trackersMu sync.Mutex
+	trackers   = make(map[vk.Device]*Tracker)
+)
+
+// NewTracker starts tracking the objects of device, call it right after
+// vk.CreateDevice and Close it right before vk.DestroyDevice.
+func NewTracker(device vk.Device) *Tracker {
+	t := &Tracker{
+		device: device,
+		live:   make(map[interface{}]trackedObject),
+	}
+	trackersMu.Lock()
+	trackers[device] = t
+	trackersMu.Unlock()
+	return t
+}
+
+func trackerFor(device vk.Device) *Tracker {
+	trackersMu.Lock()
+	defer trackersMu.Unlock()
+	return trackers[device]
+}
+
+// Track records handles created on device, the caller is their creation site.
+// Call it once the creation succeeded, the handles of a failed create are
+// undefined. Null handles are skipped. It does nothing for devices without a Tracker.
+func Track(device vk.Device, handles ...interface{}) {
+	t := trackerFor(device)
+	if t == nil {
+		return
+	}
+	site := "unknown"
+	if _, file, line, ok := runtime.Caller(1); ok {
+		site = fmt.Sprintf("%s:%d", shortPath(file), line)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, h := range handles {
+		if reflect.ValueOf(h).IsZero() {
+			continue // null handles are never destroyed
+		}
+		t.seq++
+		t.live[h] = trackedObject{
+			seq:  t.seq,
+			site: site,
+		}
+	}
+}
+
+// Destroy destroys handles with the matching vk.Destroy function and stops
+// tracking them. Null handles are ignored by Vulkan, so they are fine here too.
+func Destroy(device vk.Device, handles ...interface{}) {
+	t := trackerFor(device)
+	for _, h := range handles {
+		_, _, destroy := describe(device, h)
+		destroy()
+		if t != nil {
+			t.mu.Lock()
+			delete(t.live, h)
+			t.mu.Unlock()
+		}
+	}
+}
+
+// Live lists the objects not destroyed yet, in the order Close destroys them.
+func (t *Tracker) Live() []Leak {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	type entry struct {
+		leak Leak
+		rank int
+		seq  int
+	}
+	entries := make([]entry, 0, len(t.live))
+	for h, obj := range t.live {
+		rank, name, _ := describe(t.device, h)
+		entries = append(entries, entry{
+			leak: Leak{Handle: h, Type: name, Site: obj.site},
+			rank: rank,
+			seq:  obj.seq,
+		})
+	}
+	// dependents first, within a kind the newest first.
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].rank != entries[j].rank {
+			return entries[i].rank < entries[j].rank
+		}
+		return entries[i].seq > entries[j].seq
+	})
+	leaks := make([]Leak, 0, len(entries))
+	for _, e := range entries {
+		leaks = append(leaks, e.leak)
+	}
+	return leaks
+}
+
+// Close destroys the objects still alive in dependency order and stops
+// tracking the device. The error lists the leaked objects, nil means none.
+func (t *Tracker) Close() error {
+	leaks := t.Live()
+	for _, l := range leaks {
+		Destroy(t.device, l.Handle)
+	}
+	trackersMu.Lock()
+	delete(trackers, t.device)
+	trackersMu.Unlock()
+	if len(leaks) == 0 {
+		return nil
+	}
+	lines := make([]string, 0, len(leaks))
+	for _, l := range leaks {
+		lines = append(lines, "\t"+l.String())
+	}
+	return fmt.Errorf("%d objects leaked:\n%s", len(leaks), strings.Join(lines, "\n"))
+}
+
+// describe returns the destruction rank of h, where objects referring to
+// others come first, its name and the function that destroys it.
+// Unknown types come first and their function only logs a warning.
+func describe(device vk.Device, h interface{}) (int, string, func()) {
+	switch h := h.(type) {
+	case vk.Framebuffer:
+		return 0, "framebuffer", func() { vk.DestroyFramebuffer(device, h, nil) }
+	case vk.Pipeline:
+		return 1, "pipeline", func() { vk.DestroyPipeline(device, h, nil) }
+	case vk.PipelineCache:
+		return 2, "pipeline cache", func() { vk.DestroyPipelineCache(device, h, nil) }
+	case vk.PipelineLayout:
+		return 2, "pipeline layout", func() { vk.DestroyPipelineLayout(device, h, nil) }
+	case vk.ShaderModule:
+		return 2, "shader module", func() { vk.DestroyShaderModule(device, h, nil) }
+	case vk.DescriptorPool:
+		return 3, "descriptor pool", func() { vk.DestroyDescriptorPool(device, h, nil) }
+	case vk.DescriptorSetLayout:
+		return 4, "descriptor set layout", func() { vk.DestroyDescriptorSetLayout(device, h, nil) }
+	case vk.RenderPass:
+		return 4, "render pass", func() { vk.DestroyRenderPass(device, h, nil) }
+	case vk.ImageView:
+		return 5, "image view", func() { vk.DestroyImageView(device, h, nil) }
+	case vk.BufferView:
+		return 5, "buffer view", func() { vk.DestroyBufferView(device, h, nil) }
+	case vk.Sampler:
+		return 5, "sampler", func() { vk.DestroySampler(device, h, nil) }
+	case vk.Image:
+		return 6, "image", func() { vk.DestroyImage(device, h, nil) }
+	case vk.Buffer:
+		return 6, "buffer", func() { vk.DestroyBuffer(device, h, nil) }
+	case vk.CommandPool:
+		return 7, "command pool", func() { vk.DestroyCommandPool(device, h, nil) }
+	case vk.Fence:
+		return 7, "fence", func() { vk.DestroyFence(device, h, nil) }
+	case vk.Semaphore:
+		return 7, "semaphore", func() { vk.DestroySemaphore(device, h, nil) }
+	case vk.Event:
+		return 7, "event", func() { vk.DestroyEvent(device, h, nil) }
+	case vk.QueryPool:
+		return 7, "query pool", func() { vk.DestroyQueryPool(device, h, nil) }
+	case vk.DeviceMemory:
+		// freed after the buffers and images bound to it.
+		return 7, "device memory", func() { vk.FreeMemory(device, h, nil) }
+	case vk.Swapchain:
+		return 8, "swapchain", func() { vk.DestroySwapchain(device, h, nil) }
+	}
+	return -1, fmt.Sprintf("unknown %T", h), func() {
+		if !reflect.ValueOf(h).IsZero() {
+			log.Printf("[WARN] vulkanutil: %T objects can not be destroyed, %v is left alive", h, h)
+		}
+	}
+}
+
+// shortPath keeps the package directory and the file name.
+func shortPath(file string) string {
+	parts := strings.Split(file, "/")
+	if len(parts) > 2 {
+		parts = parts[len(parts)-2:]
+	}
+	return strings.Join(parts, "/")
+}
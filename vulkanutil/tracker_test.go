@@ -0,0 +1,42 @@
+package vulkanutil
+
+import (
+	"strings"
+	"testing"
+
+	vk "github.com/vulkan-go/vulkan"
+)
+
+// unknownHandle is a handle type the tracker can't destroy.
+type unknownHandle struct{ id int }
+
+func TestDescribe(t *testing.T) {
+	cases := []struct {
+		handle interface{}
+		name   string
+	}{
+		{vk.DeviceMemory(nil), "device memory"},
+		{vk.QueryPool(nil), "query pool"},
+		{vk.BufferView(nil), "buffer view"},
+		{vk.Event(nil), "event"},
+		{unknownHandle{1}, "unknown vulkanutil.unknownHandle"},
+	}
+	for _, c := range cases {
+		if _, name, _ := describe(nil, c.handle); name != c.name {
+			t.Errorf("describe(%T) = %q, want %q", c.handle, name, c.name)
+		}
+	}
+}
+
+func TestTrackUnknown(t *testing.T) {
+	tracker := NewTracker(nil)
+	Track(nil, unknownHandle{1}, unknownHandle{})
+	leaks := tracker.Live()
+	if len(leaks) != 1 || leaks[0].Type != "unknown vulkanutil.unknownHandle" {
+		t.Fatalf("live objects %v, want the unknown handle", leaks)
+	}
+	err := tracker.Close()
+	if err == nil || !strings.Contains(err.Error(), "unknown vulkanutil.unknownHandle") {
+		t.Errorf("Close = %v, want the unknown handle reported", err)
+	}
+}
@@ -0,0 +1,63 @@
+package vulkanutil
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ValidationEnv is the environment variable that enables validation in the
+// demos when set to a true value such as 1, in addition to their options.
+const ValidationEnv = "VK_DEMOS_VALIDATION"
+
+// ValidationRequested reports whether ValidationEnv is set to a true value.
+func ValidationRequested() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv(ValidationEnv))
+	return enabled
+}
+
+// ValidationLayers are the validation layers in order of preference: the
+// Khronos layer, and the meta layer it replaced in the older SDKs and NDKs.
+// Each of them runs all of the checks, so only one is ever enabled.
+var ValidationLayers = []string{
+	"VK_LAYER_KHRONOS_validation",
+	"VK_LAYER_LUNARG_standard_validation",
+}
+
+// SelectValidationLayers returns the NUL-terminated name of the first of
+// ValidationLayers found in available, ready to be passed to vk.CreateInstance
+// or vk.CreateDevice. A missing layer is logged as a warning and gives no
+// layers, so the demos run unvalidated instead of failing.
+func SelectValidationLayers(available []string) []string {
+	for _, name := range ValidationLayers {
+		if hasString(available, name) {
+			return []string{name + "\x00"}
+		}
+	}
+	log.Printf("[WARN] validation requested, but none of the layers %s is available",
+		strings.Join(ValidationLayers, ", "))
+	return nil
+}
+
+// DebugExtensions are the instance extensions that report the validation
+// messages, in order of preference: VK_EXT_debug_utils also names objects
+// and labels command buffers, VK_EXT_debug_report only reports.
+var DebugExtensions = []string{
+	"VK_EXT_debug_utils",
+	"VK_EXT_debug_report",
+}
+
+// SelectDebugExtension returns the first of DebugExtensions found in
+// available. Without any of them it logs a warning and returns "",
+// validation still works but its messages are not reported.
+func SelectDebugExtension(available []string) string {
+	for _, name := range DebugExtensions {
+		if hasString(available, name) {
+			return name
+		}
+	}
+	log.Printf("[WARN] none of the extensions %s is available, validation messages are not reported",
+		strings.Join(DebugExtensions, ", "))
+	return ""
+}
@@ -0,0 +1,40 @@
+package vulkanutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectValidationLayers(t *testing.T) {
+	cases := []struct {
+		available []string
+		want      []string
+	}{
+		{nil, nil},
+		{[]string{"VK_LAYER_LUNARG_api_dump"}, nil},
+		{[]string{"VK_LAYER_LUNARG_standard_validation"}, []string{"VK_LAYER_LUNARG_standard_validation\x00"}},
+		// only the Khronos layer when both are installed
+		{[]string{"VK_LAYER_LUNARG_standard_validation", "VK_LAYER_KHRONOS_validation"}, []string{"VK_LAYER_KHRONOS_validation\x00"}},
+	}
+	for _, c := range cases {
+		if got := SelectValidationLayers(c.available); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("SelectValidationLayers(%q) = %q, want %q", c.available, got, c.want)
+		}
+	}
+}
+
+func TestSelectDebugExtension(t *testing.T) {
+	cases := []struct {
+		available []string
+		want      string
+	}{
+		{nil, ""},
+		{[]string{"VK_KHR_surface", "VK_EXT_debug_report"}, "VK_EXT_debug_report"},
+		{[]string{"VK_EXT_debug_report", "VK_EXT_debug_utils"}, "VK_EXT_debug_utils"},
+	}
+	for _, c := range cases {
+		if got := SelectDebugExtension(c.available); got != c.want {
+			t.Errorf("SelectDebugExtension(%q) = %q, want %q", c.available, got, c.want)
+		}
+	}
+}